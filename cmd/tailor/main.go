@@ -9,6 +9,7 @@ import (
 	"github.com/alecthomas/kingpin"
 	"github.com/opendevstack/tailor/pkg/cli"
 	"github.com/opendevstack/tailor/pkg/commands"
+	"github.com/opendevstack/tailor/pkg/openshift"
 )
 
 var (
@@ -33,17 +34,37 @@ var (
 		"oc-binary",
 		"oc binary to use",
 	).Default("oc").String()
+	backendFlag = app.Flag(
+		"backend",
+		"Backend to talk to the cluster: 'oc' runs the oc binary, 'api' talks to the API server directly using the kubeconfig.",
+	).Default("oc").Enum("oc", "api")
 	fileFlag = app.Flag(
 		"file",
 		"Tailorfile with flags.",
 	).Short('f').Default("Tailorfile").String()
+	profileFlag = app.Flag(
+		"profile",
+		"Profile of the (YAML) Tailorfile to use.",
+	).String()
 	forceFlag = app.Flag(
 		"force",
 		"Force to continue despite warning (e.g. deleting all resources).",
 	).Bool()
+	platformManagedFlag = app.Flag(
+		"platform-managed",
+		"Path(s) per kind/name managed by the platform, which are ignored when comparing (can be given multiple times, ^ starts a regular expression).",
+	).PlaceHolder("dc:/spec/foo").Strings()
+	immutableFlag = app.Flag(
+		"immutable",
+		"Path(s) per kind/name which cannot be changed without re-creating the resource (can be given multiple times).",
+	).PlaceHolder("svc:/spec/clusterIP").Strings()
+	fieldRulesFlag = app.Flag(
+		"field-rules",
+		"YAML file with platform-managed and immutable paths extending the built-in ones.",
+	).String()
 	namespaceFlag = app.Flag(
 		"namespace",
-		"Namespace (omit to use current)",
+		"Namespace (omit to use current). Multiple namespaces can be given comma-separated.",
 	).Short('n').String()
 	selectorFlag = app.Flag(
 		"selector",
@@ -53,14 +74,38 @@ var (
 		"exclude",
 		"Exclude kinds, names and labels (comma separated)",
 	).Short('e').String()
+	kindsFlag = app.Flag(
+		"kinds",
+		"Kinds managed by Tailor when no resource is given (comma separated)",
+	).String()
 	templateDirFlag = app.Flag(
 		"template-dir",
-		"Path to local templates",
-	).Short('t').Default(".").String()
+		"Path to local templates (can be given multiple times, defaults to working directory)",
+	).Short('t').Strings()
+	recursiveFlag = app.Flag(
+		"recursive",
+		"Find templates in subdirectories of the template dirs as well",
+	).Bool()
+	templateIncludeFlag = app.Flag(
+		"template-include",
+		"Glob pattern of templates to process (defaults to *.yml and *.yaml). Patterns without / match the file name.",
+	).PlaceHolder("*.yml").Strings()
+	templateExcludeFlag = app.Flag(
+		"template-exclude",
+		"Glob pattern of templates or directories to skip. Patterns without / match the file name.",
+	).PlaceHolder("legacy").Strings()
+	rendererFlag = app.Flag(
+		"renderer",
+		"Render templates or directories matching PATTERN by running COMMAND, which writes manifests to STDOUT (can be given multiple times)",
+	).PlaceHolder("PATTERN=COMMAND").Strings()
 	paramDirFlag = app.Flag(
 		"param-dir",
 		"Path to parameter files for local templates (defaults to <NAMESPACE> or working directory)",
 	).Short('p').Default(".").String()
+	overlayDirFlag = app.Flag(
+		"overlay-dir",
+		"Path to overlays patching processed templates, in subdirectories per namespace",
+	).Default("overlays").String()
 	publicKeyDirFlag = app.Flag(
 		"public-key-dir",
 		"Path to public key files",
@@ -74,6 +119,15 @@ var (
 		"Passphrase to unlock key",
 	).String()
 
+	encryptionFlag = app.Flag(
+		"encryption",
+		"Encryption backend for new secrets: 'pgp' or 'age' (X25519)",
+	).Default("pgp").Enum("pgp", "age")
+	recipientsPolicyFlag = app.Flag(
+		"recipients-policy",
+		"Path to policy restricting the recipients of secrets per param file and key",
+	).Default("recipients.yml").String()
+
 	versionCommand = app.Command(
 		"version",
 		"Show version",
@@ -111,6 +165,14 @@ var (
 		"ignore-unknown-parameters",
 		"If true, will not stop processing if a provided parameter does not exist in the template.",
 	).Bool()
+	diffLocalProcessingFlag = diffCommand.Flag(
+		"local-processing",
+		"Process templates within Tailor instead of using 'oc process'.",
+	).Bool()
+	diffSubstituteParamsFlag = diffCommand.Flag(
+		"substitute-params",
+		"Substitute ${PARAM} references in plain manifests with the values of params.",
+	).Bool()
 	diffUpsertOnlyFlag = diffCommand.Flag(
 		"upsert-only",
 		"Don't delete resource, only create / update.",
@@ -123,6 +185,30 @@ var (
 		"reveal-secrets",
 		"Reveal drift of Secret resources (might show secret values in clear text).",
 	).Bool()
+	diffFormatFlag = diffCommand.Flag(
+		"format",
+		"Output format of the changeset (text, json or yaml).",
+	).Default("text").Enum("text", "json", "yaml")
+	diffDiffStyleFlag = diffCommand.Flag(
+		"diff-style",
+		"How drift is displayed: as unified diff of the whole resource (text) or per changed field (fields).",
+	).Default("text").Enum("text", "fields")
+	diffShowOrderFlag = diffCommand.Flag(
+		"show-order",
+		"Show the order in which changes are applied, based on references between resources.",
+	).Bool()
+	diffOutFlag = diffCommand.Flag(
+		"out",
+		"Save the changeset as plan to the given file, which can be applied later with 'apply --plan'.",
+	).PlaceHolder("plan.yml").String()
+	diffCurrentStateFileFlag = diffCommand.Flag(
+		"current-state-file",
+		"Read the current state from the given file (as recorded by 'snapshot') instead of the cluster. Templates are processed locally then.",
+	).PlaceHolder("snapshot.yml").String()
+	diffParallelFlag = diffCommand.Flag(
+		"parallel",
+		"When multiple namespaces are given, process them in parallel instead of in order.",
+	).Bool()
 	diffResourceArg = diffCommand.Arg(
 		"resource", "Remote resource (defaults to all)",
 	).String()
@@ -159,6 +245,14 @@ var (
 		"ignore-unknown-parameters",
 		"If true, will not stop processing if a provided parameter does not exist in the template.",
 	).Bool()
+	applyLocalProcessingFlag = applyCommand.Flag(
+		"local-processing",
+		"Process templates within Tailor instead of using 'oc process'.",
+	).Bool()
+	applySubstituteParamsFlag = applyCommand.Flag(
+		"substitute-params",
+		"Substitute ${PARAM} references in plain manifests with the values of params.",
+	).Bool()
 	applyUpsertOnlyFlag = applyCommand.Flag(
 		"upsert-only",
 		"Don't delete resource, only create / apply.",
@@ -175,6 +269,30 @@ var (
 		"verify",
 		"Verify if resources are in sync after changes are applied.",
 	).Bool()
+	applyAtomicFlag = applyCommand.Flag(
+		"atomic",
+		"Snapshot current state before applying, and roll back all changes if applying fails.",
+	).Bool()
+	applyFormatFlag = applyCommand.Flag(
+		"format",
+		"Output format of the changeset (text, json or yaml).",
+	).Default("text").Enum("text", "json", "yaml")
+	applyDiffStyleFlag = applyCommand.Flag(
+		"diff-style",
+		"How drift is displayed: as unified diff of the whole resource (text) or per changed field (fields).",
+	).Default("text").Enum("text", "fields")
+	applyShowOrderFlag = applyCommand.Flag(
+		"show-order",
+		"Show the order in which changes are applied, based on references between resources.",
+	).Bool()
+	applyPlanFlag = applyCommand.Flag(
+		"plan",
+		"Apply the plan saved with 'diff --out' instead of the drift to the templates. Refuses if the current state changed since.",
+	).PlaceHolder("plan.yml").String()
+	applyParallelFlag = applyCommand.Flag(
+		"parallel",
+		"When multiple namespaces are given, process them in parallel instead of in order (requires --non-interactive).",
+	).Bool()
 	applyResourceArg = applyCommand.Arg(
 		"resource", "Remote resource (defaults to all)",
 	).String()
@@ -187,10 +305,51 @@ var (
 		"with-annotations",
 		"Export annotations as well.",
 	).Bool()
+	exportOutputDirFlag = exportCommand.Flag(
+		"output-dir",
+		"Write templates into this directory instead of STDOUT.",
+	).String()
+	exportSplitByFlag = exportCommand.Flag(
+		"split-by",
+		"How to split resources into templates in --output-dir: app (label), kind or resource.",
+	).Default("app").Enum("app", "kind", "resource")
+	exportParameterizeFlag = exportCommand.Flag(
+		"parameterize",
+		"Replace environment-specific values (namespace, route hosts, images, replicas) with parameters, and write param files.",
+	).Bool()
+	exportParamFileFlag = exportCommand.Flag(
+		"param-file",
+		"Param file whose values are replaced by their param name (with --parameterize, can be given multiple times).",
+	).Strings()
 	exportResourceArg = exportCommand.Arg(
 		"resource", "Remote resource (defaults to all)",
 	).String()
 
+	snapshotCommand = app.Command(
+		"snapshot",
+		"Record current state in a file to diff against offline",
+	)
+	snapshotOutFlag = snapshotCommand.Flag(
+		"out",
+		"File to record the current state in.",
+	).Default("snapshot.yml").String()
+	snapshotResourceArg = snapshotCommand.Arg(
+		"resource", "Remote resource (defaults to all)",
+	).String()
+
+	lintCommand = app.Command(
+		"lint",
+		"Validate templates, param files and Tailorfile offline",
+	)
+	lintParamFlag = lintCommand.Flag(
+		"param",
+		"Specify a key-value pair (eg. -p FOO=BAR) to set/override a parameter value in the template.",
+	).Strings()
+	lintParamFileFlag = lintCommand.Flag(
+		"param-file",
+		"File(s) containing template parameter values to set/override in the template.",
+	).Strings()
+
 	secretsCommand = app.Command(
 		"secrets",
 		"Work with secrets",
@@ -218,6 +377,18 @@ var (
 	revealFileArg = revealCommand.Arg(
 		"file", "File to show",
 	).Required().String()
+	revealShowRecipientsFlag = revealCommand.Flag(
+		"show-recipients",
+		"Show for which recipients each secret is encrypted instead of the secrets",
+	).Bool()
+
+	verifyCommand = secretsCommand.Command(
+		"verify",
+		"Verify that param file(s) are encrypted for the expected recipients",
+	).Alias("audit")
+	verifyFileArg = verifyCommand.Arg(
+		"file", "File to verify (defaults to all files in param dir)",
+	).String()
 
 	generateKeyCommand = secretsCommand.Command(
 		"generate-key",
@@ -230,6 +401,19 @@ var (
 	generateKeyEmailArg = generateKeyCommand.Arg(
 		"email", "Emil of keypair",
 	).Required().String()
+
+	configCommand = app.Command(
+		"config",
+		"Work with the Tailorfile",
+	)
+	configMigrateCommand = configCommand.Command(
+		"migrate",
+		"Convert the Tailorfile to the YAML format",
+	)
+	configMigrateWriteFlag = configMigrateCommand.Flag(
+		"write",
+		"Replace the Tailorfile instead of printing the result (the legacy file is kept as <file>.legacy)",
+	).Bool()
 )
 
 func main() {
@@ -251,7 +435,11 @@ func main() {
 	if command == editCommand.FullCommand() ||
 		command == revealCommand.FullCommand() ||
 		command == reEncryptCommand.FullCommand() ||
-		command == generateKeyCommand.FullCommand() {
+		command == verifyCommand.FullCommand() ||
+		command == generateKeyCommand.FullCommand() ||
+		command == configMigrateCommand.FullCommand() ||
+		command == lintCommand.FullCommand() ||
+		(command == diffCommand.FullCommand() && len(*diffCurrentStateFileFlag) > 0) {
 		clusterRequired = false
 	}
 
@@ -262,11 +450,21 @@ func main() {
 		*debugFlag,
 		*nonInteractiveFlag,
 		*ocBinaryFlag,
+		*backendFlag,
 		*forceFlag,
+		*profileFlag,
+		*platformManagedFlag,
+		*immutableFlag,
+		*fieldRulesFlag,
+		*recipientsPolicyFlag,
 	)
 	if err != nil {
 		log.Fatalln("Options could not be processed:", err)
 	}
+	err = openshift.ConfigureFieldRules(globalOptions)
+	if err != nil {
+		log.Fatalln("Options could not be processed:", err)
+	}
 
 	switch command {
 	case editCommand.FullCommand():
@@ -276,6 +474,7 @@ func main() {
 			*publicKeyDirFlag,
 			*privateKeyFlag,
 			*passphraseFlag,
+			*encryptionFlag,
 		)
 		if err != nil {
 			log.Fatalln("Options could not be processed:", err)
@@ -292,6 +491,7 @@ func main() {
 			*publicKeyDirFlag,
 			*privateKeyFlag,
 			*passphraseFlag,
+			*encryptionFlag,
 		)
 		if err != nil {
 			log.Fatalln("Options could not be processed:", err)
@@ -308,61 +508,136 @@ func main() {
 			*publicKeyDirFlag,
 			*privateKeyFlag,
 			*passphraseFlag,
+			*encryptionFlag,
 		)
 		if err != nil {
 			log.Fatalln("Options could not be processed:", err)
 		}
-		err = commands.Reveal(secretsOptions, *revealFileArg)
+		err = commands.Reveal(secretsOptions, *revealFileArg, *revealShowRecipientsFlag)
 		if err != nil {
 			log.Fatalf("Failed to reveal file: %s.", err)
 		}
 
-	case generateKeyCommand.FullCommand():
+	case verifyCommand.FullCommand():
 		secretsOptions, err := cli.NewSecretsOptions(
 			globalOptions,
 			*paramDirFlag,
 			*publicKeyDirFlag,
 			*privateKeyFlag,
 			*passphraseFlag,
+			*encryptionFlag,
 		)
 		if err != nil {
 			log.Fatalln("Options could not be processed:", err)
 		}
-		err = commands.GenerateKey(secretsOptions, *generateKeyEmailArg, *generateKeyNameFlag)
+		err = commands.Verify(secretsOptions, *verifyFileArg)
 		if err != nil {
-			log.Fatalf("Failed to generate keypair: %s.", err)
+			log.Fatalf("Verification failed: %s.", err)
 		}
 
-	case diffCommand.FullCommand():
-		preservePathFlag := *diffPreservePathFlag
-		preservePathFlag = append(preservePathFlag, *diffIgnorePathFlag...)
-		compareOptions, err := cli.NewCompareOptions(
+	case configMigrateCommand.FullCommand():
+		err := commands.MigrateConfig(globalOptions, *configMigrateWriteFlag)
+		if err != nil {
+			log.Fatalf("Failed to migrate Tailorfile: %s.", err)
+		}
+
+	case lintCommand.FullCommand():
+		lintOptions, err := cli.NewLintOptions(
 			globalOptions,
 			*namespaceFlag,
-			*selectorFlag,
-			*excludeFlag,
+			*kindsFlag,
 			*templateDirFlag,
+			*recursiveFlag,
+			*templateIncludeFlag,
+			*templateExcludeFlag,
+			*rendererFlag,
+			*paramDirFlag,
+			*lintParamFlag,
+			*lintParamFileFlag,
+		)
+		if err != nil {
+			log.Fatalln("Options could not be processed:", err)
+		}
+		err = commands.Lint(lintOptions)
+		if err != nil {
+			log.Fatalf("Lint failed: %s.", err)
+		}
+
+	case generateKeyCommand.FullCommand():
+		secretsOptions, err := cli.NewSecretsOptions(
+			globalOptions,
 			*paramDirFlag,
 			*publicKeyDirFlag,
 			*privateKeyFlag,
 			*passphraseFlag,
-			*diffLabelsFlag,
-			*diffParamFlag,
-			*diffParamFileFlag,
-			preservePathFlag,
-			*diffPreserveImmutableFieldsFlag,
-			*diffIgnoreUnknownParametersFlag,
-			*diffUpsertOnlyFlag,
-			*diffAllowRecreateFlag,
-			*diffRevealSecretsFlag,
-			false, // verification only when changes are applied
-			*diffResourceArg,
+			*encryptionFlag,
 		)
 		if err != nil {
 			log.Fatalln("Options could not be processed:", err)
 		}
+		err = commands.GenerateKey(secretsOptions, *generateKeyEmailArg, *generateKeyNameFlag)
+		if err != nil {
+			log.Fatalf("Failed to generate keypair: %s.", err)
+		}
+
+	case diffCommand.FullCommand():
+		preservePathFlag := *diffPreservePathFlag
+		preservePathFlag = append(preservePathFlag, *diffIgnorePathFlag...)
+		namespaces, err := globalOptions.ResolveNamespaces(*namespaceFlag)
+		if err != nil {
+			log.Fatalln("Options could not be processed:", err)
+		}
+		compareOptionsList := []*cli.CompareOptions{}
+		for _, namespace := range namespaces {
+			compareOptions, err := cli.NewCompareOptions(
+				globalOptions,
+				namespace,
+				*selectorFlag,
+				*excludeFlag,
+				*kindsFlag,
+				*templateDirFlag,
+				*recursiveFlag,
+				*templateIncludeFlag,
+				*templateExcludeFlag,
+				*rendererFlag,
+				*paramDirFlag,
+				*overlayDirFlag,
+				*publicKeyDirFlag,
+				*privateKeyFlag,
+				*passphraseFlag,
+				*diffLabelsFlag,
+				*diffParamFlag,
+				*diffParamFileFlag,
+				preservePathFlag,
+				*diffPreserveImmutableFieldsFlag,
+				*diffIgnoreUnknownParametersFlag,
+				*diffLocalProcessingFlag,
+				*diffSubstituteParamsFlag,
+				*diffUpsertOnlyFlag,
+				*diffAllowRecreateFlag,
+				*diffRevealSecretsFlag,
+				false, // verification only when changes are applied
+				false, // rollback only when changes are applied
+				*diffFormatFlag,
+				*diffDiffStyleFlag,
+				*diffShowOrderFlag,
+				*diffOutFlag,
+				"", // plans are only applied by apply
+				*diffCurrentStateFileFlag,
+				*diffResourceArg,
+			)
+			if err != nil {
+				log.Fatalln("Options could not be processed:", err)
+			}
+			compareOptionsList = append(compareOptionsList, compareOptions)
+		}
 
-		driftDectected, err := commands.Diff(compareOptions)
+		var driftDectected bool
+		if len(compareOptionsList) == 1 {
+			driftDectected, err = commands.Diff(compareOptionsList[0])
+		} else {
+			driftDectected, err = commands.DiffNamespaces(compareOptionsList, *diffParallelFlag)
+		}
 		if err != nil {
 			log.Fatalln(err)
 		}
@@ -373,33 +648,61 @@ func main() {
 	case applyCommand.FullCommand():
 		preservePathFlag := *applyPreservePathFlag
 		preservePathFlag = append(preservePathFlag, *applyIgnorePathFlag...)
-		compareOptions, err := cli.NewCompareOptions(
-			globalOptions,
-			*namespaceFlag,
-			*selectorFlag,
-			*excludeFlag,
-			*templateDirFlag,
-			*paramDirFlag,
-			*publicKeyDirFlag,
-			*privateKeyFlag,
-			*passphraseFlag,
-			*applyLabelsFlag,
-			*applyParamFlag,
-			*applyParamFileFlag,
-			preservePathFlag,
-			*applyPreserveImmutableFieldsFlag,
-			*applyIgnoreUnknownParametersFlag,
-			*applyUpsertOnlyFlag,
-			*applyAllowRecreateFlag,
-			*applyRevealSecretsFlag,
-			*applyVerifyFlag,
-			*applyResourceArg,
-		)
+		namespaces, err := globalOptions.ResolveNamespaces(*namespaceFlag)
 		if err != nil {
 			log.Fatalln("Options could not be processed:", err)
 		}
+		compareOptionsList := []*cli.CompareOptions{}
+		for _, namespace := range namespaces {
+			compareOptions, err := cli.NewCompareOptions(
+				globalOptions,
+				namespace,
+				*selectorFlag,
+				*excludeFlag,
+				*kindsFlag,
+				*templateDirFlag,
+				*recursiveFlag,
+				*templateIncludeFlag,
+				*templateExcludeFlag,
+				*rendererFlag,
+				*paramDirFlag,
+				*overlayDirFlag,
+				*publicKeyDirFlag,
+				*privateKeyFlag,
+				*passphraseFlag,
+				*applyLabelsFlag,
+				*applyParamFlag,
+				*applyParamFileFlag,
+				preservePathFlag,
+				*applyPreserveImmutableFieldsFlag,
+				*applyIgnoreUnknownParametersFlag,
+				*applyLocalProcessingFlag,
+				*applySubstituteParamsFlag,
+				*applyUpsertOnlyFlag,
+				*applyAllowRecreateFlag,
+				*applyRevealSecretsFlag,
+				*applyVerifyFlag,
+				*applyAtomicFlag,
+				*applyFormatFlag,
+				*applyDiffStyleFlag,
+				*applyShowOrderFlag,
+				"", // plans are only saved by diff
+				*applyPlanFlag,
+				"", // changes are only applied against the cluster
+				*applyResourceArg,
+			)
+			if err != nil {
+				log.Fatalln("Options could not be processed:", err)
+			}
+			compareOptionsList = append(compareOptionsList, compareOptions)
+		}
 
-		driftDectected, err := commands.Apply(globalOptions.NonInteractive, compareOptions)
+		var driftDectected bool
+		if len(compareOptionsList) == 1 {
+			driftDectected, err = commands.Apply(globalOptions.NonInteractive, compareOptionsList[0])
+		} else {
+			driftDectected, err = commands.ApplyNamespaces(globalOptions.NonInteractive, compareOptionsList, *applyParallelFlag)
+		}
 		if err != nil {
 			log.Fatalln(err)
 		}
@@ -413,9 +716,14 @@ func main() {
 			*namespaceFlag,
 			*selectorFlag,
 			*excludeFlag,
+			*kindsFlag,
 			*templateDirFlag,
 			*paramDirFlag,
 			*exportWithAnnotationsFlag,
+			*exportOutputDirFlag,
+			*exportSplitByFlag,
+			*exportParameterizeFlag,
+			*exportParamFileFlag,
 			*exportResourceArg,
 		)
 		if err != nil {
@@ -425,5 +733,29 @@ func main() {
 		if err != nil {
 			log.Fatalln(err)
 		}
+
+	case snapshotCommand.FullCommand():
+		exportOptions, err := cli.NewExportOptions(
+			globalOptions,
+			*namespaceFlag,
+			*selectorFlag,
+			*excludeFlag,
+			*kindsFlag,
+			*templateDirFlag,
+			*paramDirFlag,
+			true, // annotations are required to compare
+			"",
+			"app",
+			false,
+			[]string{},
+			*snapshotResourceArg,
+		)
+		if err != nil {
+			log.Fatalln("Options could not be processed:", err)
+		}
+		err = commands.Snapshot(exportOptions, *snapshotOutFlag)
+		if err != nil {
+			log.Fatalln(err)
+		}
 	}
 }
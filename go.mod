@@ -1,20 +1,24 @@
 module github.com/opendevstack/tailor
 
 require (
+	filippo.io/age v1.1.1
 	github.com/alecthomas/kingpin v2.2.6+incompatible
-	github.com/alecthomas/template v0.0.0-20160405071501-a0175ee3bccc // indirect
-	github.com/alecthomas/units v0.0.0-20151022065526-2efee857e7cf // indirect
 	github.com/fatih/color v1.7.0
 	github.com/ghodss/yaml v1.0.0
 	github.com/google/go-cmp v0.3.1
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/xeipuuv/gojsonpointer v0.0.0-20180127040702-4e3ac2762d5f
+	golang.org/x/crypto v0.4.0
+	gopkg.in/yaml.v2 v2.2.1
+)
+
+require (
+	github.com/alecthomas/template v0.0.0-20160405071501-a0175ee3bccc // indirect
+	github.com/alecthomas/units v0.0.0-20151022065526-2efee857e7cf // indirect
 	github.com/mattn/go-colorable v0.0.9 // indirect
 	github.com/mattn/go-isatty v0.0.3 // indirect
-	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.3.0 // indirect
-	github.com/xeipuuv/gojsonpointer v0.0.0-20180127040702-4e3ac2762d5f
-	golang.org/x/crypto v0.0.0-20180820150726-614d502a4dac
-	golang.org/x/sys v0.0.0-20190801041406-cbf593c0f2f3 // indirect
-	gopkg.in/yaml.v2 v2.2.1 // indirect
+	golang.org/x/sys v0.3.0 // indirect
 )
 
-go 1.13
+go 1.19
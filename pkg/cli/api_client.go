@@ -0,0 +1,482 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+const lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// APIClient talks to the API server over HTTP instead of running "oc".
+type APIClient struct {
+	namespace  string
+	config     *APIConfig
+	httpClient *http.Client
+	resources  []APIResource
+	discovered bool
+}
+
+// apiStatus is the error response of the API server.
+type apiStatus struct {
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+}
+
+// apiError is returned when the API server responds with an error.
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func isNotFound(err error) bool {
+	if e, ok := err.(*apiError); ok {
+		return e.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// NewAPIClient creates a new client for given namespace, using config.
+func NewAPIClient(namespace string, config *APIConfig) *APIClient {
+	return &APIClient{
+		namespace:  namespace,
+		config:     config,
+		httpClient: config.httpClient(),
+		resources:  defaultAPIResources,
+	}
+}
+
+// Version returns the server version in the same format as "oc version".
+func (c *APIClient) Version() ([]byte, []byte, error) {
+	versions := []string{}
+	for _, v := range []struct{ name, path string }{
+		{"openshift", "/version/openshift"},
+		{"kubernetes", "/version"},
+	} {
+		b, err := c.request("GET", v.path, "", nil)
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, []byte(err.Error()), err
+		}
+		info := struct {
+			GitVersion string `json:"gitVersion"`
+		}{}
+		err = json.Unmarshal(b, &info)
+		if err != nil {
+			return nil, []byte(err.Error()), err
+		}
+		versions = append(versions, v.name+" "+info.GitVersion)
+	}
+	return []byte(strings.Join(versions, "\n") + "\n"), nil, nil
+}
+
+// CurrentProject returns the namespace of the current kubeconfig context.
+func (c *APIClient) CurrentProject() (string, error) {
+	if len(c.config.Namespace) == 0 {
+		return "", errors.New("No namespace set in current kubeconfig context")
+	}
+	return c.config.Namespace, nil
+}
+
+// CheckProjectExists returns true if the given project (namespace) exists.
+func (c *APIClient) CheckProjectExists(p string) (bool, error) {
+	_, err := c.request("GET", "/apis/project.openshift.io/v1/projects/"+p, "", nil)
+	if err == nil {
+		return true, nil
+	}
+	// Fall back to namespaces for clusters without the project API
+	_, nsErr := c.request("GET", "/api/v1/namespaces/"+p, "", nil)
+	if nsErr == nil {
+		return true, nil
+	}
+	return false, err
+}
+
+// CheckLoggedIn returns true if the credentials are accepted by the server.
+func (c *APIClient) CheckLoggedIn() (bool, error) {
+	_, err := c.request("GET", "/apis/user.openshift.io/v1/users/~", "", nil)
+	if err != nil {
+		if e, ok := err.(*apiError); ok && e.StatusCode != http.StatusUnauthorized && e.StatusCode != http.StatusForbidden {
+			return true, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Process processes an OpenShift template on the server. It accepts the same
+// arguments as "oc process".
+func (c *APIClient) Process(args []string) ([]byte, []byte, error) {
+	filename := ""
+	labels := ""
+	params := map[string]string{}
+	paramOrder := []string{}
+	ignoreUnknownParameters := false
+	setParam := func(pair string) {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return
+		}
+		if _, ok := params[kv[0]]; !ok {
+			paramOrder = append(paramOrder, kv[0])
+		}
+		params[kv[0]] = kv[1]
+	}
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--filename="):
+			filename = strings.TrimPrefix(arg, "--filename=")
+		case strings.HasPrefix(arg, "--labels="):
+			labels = strings.TrimPrefix(arg, "--labels=")
+		case strings.HasPrefix(arg, "--param="):
+			setParam(strings.TrimPrefix(arg, "--param="))
+		case strings.HasPrefix(arg, "--param-file="):
+			b, err := ioutil.ReadFile(strings.TrimPrefix(arg, "--param-file="))
+			if err != nil {
+				return nil, []byte(err.Error()), err
+			}
+			for _, line := range strings.Split(string(b), "\n") {
+				line = strings.TrimSpace(line)
+				if len(line) == 0 || strings.HasPrefix(line, "#") {
+					continue
+				}
+				setParam(line)
+			}
+		case arg == "--ignore-unknown-parameters=true":
+			ignoreUnknownParameters = true
+		}
+	}
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, []byte(err.Error()), err
+	}
+	var template map[string]interface{}
+	err = yaml.Unmarshal(b, &template)
+	if err != nil {
+		return nil, []byte(err.Error()), err
+	}
+
+	templateParams, _ := template["parameters"].([]interface{})
+	for _, name := range paramOrder {
+		found := false
+		for _, p := range templateParams {
+			pm, ok := p.(map[string]interface{})
+			if ok && pm["name"] == name {
+				pm["value"] = params[name]
+				delete(pm, "generate")
+				found = true
+			}
+		}
+		if !found && !ignoreUnknownParameters {
+			err := fmt.Errorf("unknown parameter name %q", name)
+			return nil, []byte("error: " + err.Error()), err
+		}
+	}
+
+	if len(labels) > 0 {
+		templateLabels, ok := template["labels"].(map[string]interface{})
+		if !ok {
+			templateLabels = map[string]interface{}{}
+		}
+		for _, l := range strings.Split(labels, ",") {
+			kv := strings.SplitN(l, "=", 2)
+			if len(kv) == 2 {
+				templateLabels[kv[0]] = kv[1]
+			}
+		}
+		template["labels"] = templateLabels
+	}
+	template["apiVersion"] = "template.openshift.io/v1"
+	template["kind"] = "Template"
+
+	body, err := json.Marshal(template)
+	if err != nil {
+		return nil, []byte(err.Error()), err
+	}
+	processedPath := "/apis/template.openshift.io/v1/namespaces/" + c.namespace + "/processedtemplates"
+	out, err := c.request("POST", processedPath, "application/json", body)
+	if err != nil {
+		return nil, []byte(err.Error()), err
+	}
+
+	processed := map[string]interface{}{}
+	err = json.Unmarshal(out, &processed)
+	if err != nil {
+		return nil, []byte(err.Error()), err
+	}
+	objects, ok := processed["objects"].([]interface{})
+	if !ok {
+		objects = []interface{}{}
+	}
+	list := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"metadata":   map[string]interface{}{},
+		"items":      objects,
+	}
+	outBytes, err := yaml.Marshal(list)
+	if err != nil {
+		return nil, []byte(err.Error()), err
+	}
+	return outBytes, nil, nil
+}
+
+// Export exports resources from the server as a template.
+func (c *APIClient) Export(target string, label string) ([]byte, error) {
+	items := []interface{}{}
+	for _, kind := range strings.Split(target, ",") {
+		r, err := c.resourceFor(kind)
+		if err != nil {
+			return []byte{}, err
+		}
+		path := r.collectionPath(c.namespace)
+		if len(label) > 0 {
+			path = path + "?labelSelector=" + url.QueryEscape(label)
+		}
+		b, err := c.request("GET", path, "", nil)
+		if err != nil {
+			return []byte{}, fmt.Errorf(
+				"Failed to export %s resources.\n"+
+					"%s\n",
+				kind,
+				err,
+			)
+		}
+		list := struct {
+			Items []map[string]interface{} `json:"items"`
+		}{}
+		err = json.Unmarshal(b, &list)
+		if err != nil {
+			return []byte{}, err
+		}
+		for _, item := range list.Items {
+			// Items of a list do not carry their kind
+			item["apiVersion"] = r.groupVersion()
+			item["kind"] = r.Kind
+			items = append(items, item)
+		}
+	}
+
+	if len(items) == 0 {
+		return []byte{}, nil
+	}
+
+	return exportAsTemplate(items)
+}
+
+// Apply applies given resource configuration in the same way as "oc apply":
+// the configuration is stored in the last-applied annotation, and a three-way
+// merge patch between last-applied, desired and current state is sent.
+func (c *APIClient) Apply(config string, selector string) ([]byte, error) {
+	var desired map[string]interface{}
+	err := yaml.Unmarshal([]byte(config), &desired)
+	if err != nil {
+		return []byte(err.Error()), err
+	}
+	kind, _ := desired["kind"].(string)
+	r, err := c.resourceFor(kind)
+	if err != nil {
+		return []byte(err.Error()), err
+	}
+	metadata, ok := desired["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = map[string]interface{}{}
+		desired["metadata"] = metadata
+	}
+	name, _ := metadata["name"].(string)
+
+	if len(selector) > 0 && !matchesSelector(metadata, selector) {
+		VerboseMsg(r.Kind+"/"+name, "does not match selector", selector)
+		return nil, nil
+	}
+
+	// Legacy configurations use "v1" for all OpenShift kinds
+	if apiVersion, _ := desired["apiVersion"].(string); !strings.Contains(apiVersion, "/") {
+		desired["apiVersion"] = r.groupVersion()
+	}
+
+	// Store configuration without previous last-applied annotation
+	annotations, ok := metadata["annotations"].(map[string]interface{})
+	if !ok {
+		annotations = map[string]interface{}{}
+	}
+	delete(annotations, lastAppliedConfigAnnotation)
+	if len(annotations) == 0 {
+		delete(metadata, "annotations")
+	}
+	lastApplied, err := json.Marshal(desired)
+	if err != nil {
+		return []byte(err.Error()), err
+	}
+	annotations[lastAppliedConfigAnnotation] = string(lastApplied)
+	metadata["annotations"] = annotations
+
+	itemPath := r.collectionPath(c.namespace) + "/" + name
+	currentBytes, err := c.request("GET", itemPath, "", nil)
+	if err != nil {
+		if !isNotFound(err) {
+			return []byte(err.Error()), err
+		}
+		body, err := json.Marshal(desired)
+		if err != nil {
+			return []byte(err.Error()), err
+		}
+		_, err = c.request("POST", r.collectionPath(c.namespace), "application/json", body)
+		if err != nil {
+			return []byte(err.Error()), err
+		}
+		return nil, nil
+	}
+
+	current := map[string]interface{}{}
+	err = json.Unmarshal(currentBytes, &current)
+	if err != nil {
+		return []byte(err.Error()), err
+	}
+	original := map[string]interface{}{}
+	if cm, ok := current["metadata"].(map[string]interface{}); ok {
+		if ca, ok := cm["annotations"].(map[string]interface{}); ok {
+			if s, ok := ca[lastAppliedConfigAnnotation].(string); ok {
+				_ = json.Unmarshal([]byte(s), &original)
+			}
+		}
+	}
+
+	patch := threeWayMergePatch(original, desired, current)
+	if len(patch) == 0 {
+		return nil, nil
+	}
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return []byte(err.Error()), err
+	}
+	_, err = c.request("PATCH", itemPath, "application/merge-patch+json", body)
+	if err != nil {
+		return []byte(err.Error()), err
+	}
+	return nil, nil
+}
+
+// Delete deletes given resource.
+func (c *APIClient) Delete(kind string, name string) ([]byte, error) {
+	r, err := c.resourceFor(kind)
+	if err != nil {
+		return []byte(err.Error()), err
+	}
+	_, err = c.request("DELETE", r.collectionPath(c.namespace)+"/"+name, "", nil)
+	if err != nil {
+		return []byte(err.Error()), err
+	}
+	return nil, nil
+}
+
+// resourceFor finds the resource serving given kind. If the kind is not one
+// of the defaults, the resources are discovered from the server.
+func (c *APIClient) resourceFor(kind string) (APIResource, error) {
+	for _, r := range c.resources {
+		if r.matches(kind) {
+			return r, nil
+		}
+	}
+	if !c.discovered {
+		if _, err := c.APIResources(); err != nil {
+			return APIResource{}, err
+		}
+		return c.resourceFor(kind)
+	}
+	return APIResource{}, fmt.Errorf("Unknown resource kind: %s", kind)
+}
+
+func (c *APIClient) request(method string, path string, contentType string, body []byte) ([]byte, error) {
+	VerboseMsg(method, c.config.Server+path)
+	req, err := http.NewRequest(method, c.config.Server+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if len(c.config.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		status := apiStatus{}
+		msg := strings.TrimSpace(string(b))
+		if json.Unmarshal(b, &status) == nil && len(status.Message) > 0 {
+			msg = status.Message
+		}
+		return nil, &apiError{StatusCode: res.StatusCode, Message: msg}
+	}
+	return b, nil
+}
+
+// matchesSelector returns true if the labels in metadata contain all
+// key=value pairs of the comma-separated selector.
+func matchesSelector(metadata map[string]interface{}, selector string) bool {
+	labels, _ := metadata["labels"].(map[string]interface{})
+	for _, s := range strings.Split(selector, ",") {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || labels[kv[0]] != kv[1] {
+			return false
+		}
+	}
+	return true
+}
+
+// threeWayMergePatch calculates a JSON merge patch (RFC 7386) which turns
+// current into modified. Fields present in original (the last applied
+// configuration) but not in modified are deleted, fields which are present
+// in current only are left untouched as they are managed by someone else.
+func threeWayMergePatch(original, modified, current map[string]interface{}) map[string]interface{} {
+	patch := map[string]interface{}{}
+	for k, mv := range modified {
+		cv, inCurrent := current[k]
+		if mm, ok := mv.(map[string]interface{}); ok {
+			if cm, ok := cv.(map[string]interface{}); ok {
+				om, _ := original[k].(map[string]interface{})
+				sub := threeWayMergePatch(om, mm, cm)
+				if len(sub) > 0 {
+					patch[k] = sub
+				}
+				continue
+			}
+		}
+		if !inCurrent || !reflect.DeepEqual(mv, cv) {
+			patch[k] = mv
+		}
+	}
+	for k := range original {
+		if _, ok := modified[k]; ok {
+			continue
+		}
+		if _, ok := current[k]; ok {
+			patch[k] = nil
+		}
+	}
+	return patch
+}
@@ -0,0 +1,421 @@
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeAPIServer is a minimal in-memory API server. Objects are keyed by the
+// path of their collection and their name.
+type fakeAPIServer struct {
+	mu        sync.Mutex
+	objects   map[string]map[string]map[string]interface{}
+	patches   []map[string]interface{}
+	documents map[string]interface{}
+}
+
+func newFakeAPIServer(t *testing.T) (*fakeAPIServer, *httptest.Server) {
+	f := &fakeAPIServer{
+		objects:   map[string]map[string]map[string]interface{}{},
+		documents: map[string]interface{}{},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.serve(t, w, r)
+	}))
+	return f, ts
+}
+
+func (f *fakeAPIServer) add(collection string, obj map[string]interface{}) {
+	if _, ok := f.objects[collection]; !ok {
+		f.objects[collection] = map[string]map[string]interface{}{}
+	}
+	name := obj["metadata"].(map[string]interface{})["name"].(string)
+	f.objects[collection][name] = obj
+}
+
+func (f *fakeAPIServer) serve(t *testing.T, w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	path := r.URL.Path
+
+	if doc, ok := f.documents[path]; ok {
+		writeJSON(w, http.StatusOK, doc)
+		return
+	}
+	if path == "/apis/project.openshift.io/v1/projects/foo" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"metadata": map[string]interface{}{"name": "foo"}})
+		return
+	}
+	if strings.HasSuffix(path, "/processedtemplates") {
+		template := map[string]interface{}{}
+		_ = json.Unmarshal(body, &template)
+		objects, _ := json.Marshal(template["objects"])
+		s := string(objects)
+		for _, p := range template["parameters"].([]interface{}) {
+			pm := p.(map[string]interface{})
+			value, _ := pm["value"].(string)
+			s = strings.Replace(s, "${"+pm["name"].(string)+"}", value, -1)
+		}
+		processed := []interface{}{}
+		_ = json.Unmarshal([]byte(s), &processed)
+		for _, o := range processed {
+			metadata := o.(map[string]interface{})["metadata"].(map[string]interface{})
+			metadata["labels"] = template["labels"]
+		}
+		template["objects"] = processed
+		writeJSON(w, http.StatusCreated, template)
+		return
+	}
+
+	if r.Method == "POST" {
+		obj := map[string]interface{}{}
+		_ = json.Unmarshal(body, &obj)
+		f.add(path, obj)
+		writeJSON(w, http.StatusCreated, obj)
+		return
+	}
+	if collection, ok := f.objects[path]; ok {
+		switch r.Method {
+		case "GET":
+			items := []interface{}{}
+			for _, o := range collection {
+				if sel := r.URL.Query().Get("labelSelector"); len(sel) > 0 {
+					if !matchesSelector(o["metadata"].(map[string]interface{}), sel) {
+						continue
+					}
+				}
+				items = append(items, o)
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"kind": "List", "items": items})
+		}
+		return
+	}
+
+	collectionPath := path[:strings.LastIndex(path, "/")]
+	name := path[strings.LastIndex(path, "/")+1:]
+	collection, ok := f.objects[collectionPath]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"message": "the server could not find the requested resource"})
+		return
+	}
+	obj, ok := collection[name]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"message": name + " not found"})
+		return
+	}
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, obj)
+	case "PATCH":
+		if r.Header.Get("Content-Type") != "application/merge-patch+json" {
+			t.Errorf("Unexpected content type %s", r.Header.Get("Content-Type"))
+		}
+		patch := map[string]interface{}{}
+		_ = json.Unmarshal(body, &patch)
+		f.patches = append(f.patches, patch)
+		writeJSON(w, http.StatusOK, obj)
+	case "DELETE":
+		delete(collection, name)
+		writeJSON(w, http.StatusOK, map[string]interface{}{})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newTestAPIClient(ts *httptest.Server) *APIClient {
+	return NewAPIClient("foo", &APIConfig{Server: ts.URL, Token: "s3cr3t", Namespace: "foo"})
+}
+
+func TestAPIClientExport(t *testing.T) {
+	f, ts := newFakeAPIServer(t)
+	defer ts.Close()
+	f.add("/api/v1/namespaces/foo/services", map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":            "bar",
+			"namespace":       "foo",
+			"uid":             "123",
+			"resourceVersion": "42",
+			"labels":          map[string]interface{}{"app": "bar"},
+		},
+		"spec":   map[string]interface{}{"clusterIP": "172.30.0.1", "ports": []interface{}{}},
+		"status": map[string]interface{}{"loadBalancer": map[string]interface{}{}},
+	})
+	f.add("/api/v1/namespaces/foo/configmaps", map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "baz", "labels": map[string]interface{}{"app": "baz"}},
+		"data":     map[string]interface{}{"a": "b"},
+	})
+
+	c := newTestAPIClient(ts)
+	out, err := c.Export("svc,ConfigMap", "app=bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: template.openshift.io/v1
+kind: Template
+metadata:
+  name: tailor
+objects:
+- apiVersion: v1
+  kind: Service
+  metadata:
+    labels:
+      app: bar
+    name: bar
+  spec:
+    ports: []
+`
+	if diff := cmp.Diff(want, string(out)); diff != "" {
+		t.Fatalf("Export mismatch (-want +got):\n%s", diff)
+	}
+
+	out, err = c.Export("svc", "app=none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 0 {
+		t.Fatalf("Expected empty export, got: %s", out)
+	}
+
+	_, err = c.Export("foobar", "")
+	if err == nil {
+		t.Fatal("Expected error for unknown kind")
+	}
+}
+
+func TestAPIClientApply(t *testing.T) {
+	f, ts := newFakeAPIServer(t)
+	defer ts.Close()
+	f.add("/api/v1/namespaces/foo/configmaps", map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name": "existing",
+			"annotations": map[string]interface{}{
+				lastAppliedConfigAnnotation: `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"existing"},"data":{"a":"b","removed":"x"}}`,
+				"unmanaged":                 "yes",
+			},
+		},
+		"data": map[string]interface{}{"a": "b", "removed": "x", "external": "y"},
+	})
+
+	c := newTestAPIClient(ts)
+
+	// Creation
+	_, err := c.Apply("apiVersion: v1\nkind: DeploymentConfig\nmetadata:\n  name: new\nspec:\n  replicas: 1\n", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, ok := f.objects["/apis/apps.openshift.io/v1/namespaces/foo/deploymentconfigs"]["new"]
+	if !ok {
+		t.Fatal("Expected DeploymentConfig to be created")
+	}
+	if created["apiVersion"] != "apps.openshift.io/v1" {
+		t.Fatalf("Expected legacy apiVersion to be replaced, got: %s", created["apiVersion"])
+	}
+	annotations := created["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	if _, ok := annotations[lastAppliedConfigAnnotation]; !ok {
+		t.Fatal("Expected last-applied annotation to be set")
+	}
+
+	// Update
+	_, err = c.Apply("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: existing\ndata:\n  a: c\n", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.patches) != 1 {
+		t.Fatalf("Expected one patch, got: %d", len(f.patches))
+	}
+	patchedData := f.patches[0]["data"]
+	wantData := map[string]interface{}{"a": "c", "removed": nil}
+	if diff := cmp.Diff(wantData, patchedData); diff != "" {
+		t.Fatalf("Patch mismatch (-want +got):\n%s", diff)
+	}
+
+	// Not matching selector is skipped
+	_, err = c.Apply("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: skipped\n", "app=foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.objects["/api/v1/namespaces/foo/configmaps"]["skipped"]; ok {
+		t.Fatal("Expected ConfigMap not matching selector to be skipped")
+	}
+}
+
+func TestAPIClientDelete(t *testing.T) {
+	f, ts := newFakeAPIServer(t)
+	defer ts.Close()
+	f.add("/api/v1/namespaces/foo/secrets", map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "bar"},
+	})
+	c := newTestAPIClient(ts)
+	_, err := c.Delete("Secret", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.objects["/api/v1/namespaces/foo/secrets"]["bar"]; ok {
+		t.Fatal("Expected secret to be deleted")
+	}
+	errBytes, err := c.Delete("Secret", "bar")
+	if err == nil {
+		t.Fatal("Expected error when deleting non-existing secret")
+	}
+	if !strings.Contains(string(errBytes), "not found") {
+		t.Fatalf("Expected not found error, got: %s", errBytes)
+	}
+}
+
+func TestAPIClientProcess(t *testing.T) {
+	_, ts := newFakeAPIServer(t)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "tailor-api-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	templateFile := filepath.Join(dir, "template.yml")
+	err = ioutil.WriteFile(templateFile, []byte(`apiVersion: v1
+kind: Template
+objects:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: ${NAME}
+  data:
+    foo: ${FOO}
+parameters:
+- name: NAME
+  required: true
+- name: FOO
+  value: default
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paramFile := filepath.Join(dir, "template.env")
+	err = ioutil.WriteFile(paramFile, []byte("# comment\nFOO=fromfile\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestAPIClient(ts)
+	out, _, err := c.Process([]string{
+		"--filename=" + templateFile,
+		"--output=yaml",
+		"--labels=app=bar",
+		"--param=NAME=baz",
+		"--param-file=" + paramFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: v1
+items:
+- apiVersion: v1
+  data:
+    foo: fromfile
+  kind: ConfigMap
+  metadata:
+    labels:
+      app: bar
+    name: baz
+kind: List
+metadata: {}
+`
+	if diff := cmp.Diff(want, string(out)); diff != "" {
+		t.Fatalf("Process mismatch (-want +got):\n%s", diff)
+	}
+
+	_, errBytes, err := c.Process([]string{"--filename=" + templateFile, "--param=UNKNOWN=x"})
+	if err == nil {
+		t.Fatal("Expected error for unknown parameter")
+	}
+	if !strings.Contains(string(errBytes), "unknown parameter") {
+		t.Fatalf("Expected unknown parameter error, got: %s", errBytes)
+	}
+	_, _, err = c.Process([]string{"--filename=" + templateFile, "--param=UNKNOWN=x", "--ignore-unknown-parameters=true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAPIClientChecks(t *testing.T) {
+	_, ts := newFakeAPIServer(t)
+	defer ts.Close()
+	c := newTestAPIClient(ts)
+	exists, err := c.CheckProjectExists("foo")
+	if !exists || err != nil {
+		t.Fatalf("Expected project foo to exist, got: %v", err)
+	}
+	exists, _ = c.CheckProjectExists("bar")
+	if exists {
+		t.Fatal("Expected project bar to not exist")
+	}
+	loggedIn, _ := c.CheckLoggedIn()
+	if !loggedIn {
+		t.Fatal("Expected to be logged in")
+	}
+	anonymous := NewAPIClient("foo", &APIConfig{Server: ts.URL})
+	loggedIn, _ = anonymous.CheckLoggedIn()
+	if loggedIn {
+		t.Fatal("Expected to be logged out without token")
+	}
+}
+
+func TestParseKubeConfig(t *testing.T) {
+	kubeConfig := []byte(`apiVersion: v1
+kind: Config
+current-context: foo/example-com:8443/developer
+contexts:
+- name: foo/example-com:8443/developer
+  context:
+    cluster: example-com:8443
+    namespace: foo
+    user: developer/example-com:8443
+clusters:
+- name: example-com:8443
+  cluster:
+    server: https://example.com:8443/
+    insecure-skip-tls-verify: true
+users:
+- name: developer/example-com:8443
+  user:
+    token: s3cr3t
+`)
+	c, err := parseKubeConfig(kubeConfig, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server != "https://example.com:8443" {
+		t.Fatalf("Unexpected server: %s", c.Server)
+	}
+	if c.Token != "s3cr3t" || c.Namespace != "foo" || !c.TLSConfig.InsecureSkipVerify {
+		t.Fatalf("Unexpected config: %#v", c)
+	}
+
+	broken := map[string]interface{}{}
+	_ = yaml.Unmarshal(kubeConfig, &broken)
+	broken["current-context"] = "other"
+	b, _ := yaml.Marshal(broken)
+	_, err = parseKubeConfig(b, ".")
+	if err == nil {
+		t.Fatal("Expected error for missing context")
+	}
+}
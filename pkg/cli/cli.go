@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 
 	"github.com/fatih/color"
 )
@@ -17,6 +18,10 @@ import (
 var verbose bool
 var debug bool
 var ocBinary string
+var backend string
+var apiConfig *APIConfig
+var apiConfigMu sync.Mutex
+var exportWithGet bool
 
 // PrintGreenf prints in green.
 var PrintGreenf func(format string, a ...interface{})
@@ -0,0 +1,237 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/opendevstack/tailor/pkg/utils"
+)
+
+// APIResource describes how a kind is served by the API server.
+type APIResource struct {
+	Group      string
+	Version    string
+	Name       string
+	Kind       string
+	ShortNames []string
+}
+
+var defaultAPIResources = []APIResource{
+	{Version: "v1", Name: "services", Kind: "Service", ShortNames: []string{"svc"}},
+	{Version: "v1", Name: "persistentvolumeclaims", Kind: "PersistentVolumeClaim", ShortNames: []string{"pvc"}},
+	{Version: "v1", Name: "configmaps", Kind: "ConfigMap", ShortNames: []string{"cm"}},
+	{Version: "v1", Name: "secrets", Kind: "Secret"},
+	{Version: "v1", Name: "serviceaccounts", Kind: "ServiceAccount", ShortNames: []string{"sa"}},
+	{Group: "route.openshift.io", Version: "v1", Name: "routes", Kind: "Route"},
+	{Group: "apps.openshift.io", Version: "v1", Name: "deploymentconfigs", Kind: "DeploymentConfig", ShortNames: []string{"dc"}},
+	{Group: "build.openshift.io", Version: "v1", Name: "buildconfigs", Kind: "BuildConfig", ShortNames: []string{"bc"}},
+	{Group: "image.openshift.io", Version: "v1", Name: "imagestreams", Kind: "ImageStream", ShortNames: []string{"is"}},
+	{Group: "template.openshift.io", Version: "v1", Name: "templates", Kind: "Template"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Name: "rolebindings", Kind: "RoleBinding"},
+	{Group: "batch", Version: "v1beta1", Name: "cronjobs", Kind: "CronJob", ShortNames: []string{"cj"}},
+}
+
+// matches returns true if s refers to the resource by kind, name or short name.
+func (r APIResource) matches(s string) bool {
+	s = strings.ToLower(s)
+	if s == strings.ToLower(r.Kind) || s == r.Name || s == strings.TrimSuffix(r.Name, "s") {
+		return true
+	}
+	for _, sn := range r.ShortNames {
+		if s == sn {
+			return true
+		}
+	}
+	return false
+}
+
+func (r APIResource) groupVersion() string {
+	if len(r.Group) == 0 {
+		return r.Version
+	}
+	return r.Group + "/" + r.Version
+}
+
+// collectionPath returns the path of the namespaced collection.
+func (r APIResource) collectionPath(namespace string) string {
+	prefix := "/apis/" + r.groupVersion()
+	if len(r.Group) == 0 {
+		prefix = "/api/" + r.Version
+	}
+	return prefix + "/namespaces/" + namespace + "/" + r.Name
+}
+
+// OcClientDiscoverer allows to discover the resources served by the cluster.
+type OcClientDiscoverer interface {
+	APIResources() ([]APIResource, error)
+}
+
+// APIResources returns the namespaced, listable resources known to the
+// cluster, as reported by "oc api-resources".
+func (c *OcClient) APIResources() ([]APIResource, error) {
+	args := []string{"api-resources", "--namespaced=true", "--verbs=list"}
+	cmd := c.execPlainOcCmd(args)
+	outBytes, errBytes, err := c.runCmd(cmd)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Failed to discover API resources.\n"+
+				"%s\n",
+			string(errBytes),
+		)
+	}
+	return parseAPIResourcesTable(outBytes)
+}
+
+// parseAPIResourcesTable parses the table printed by "oc api-resources".
+// Columns are located by the position of their header as cells may be empty.
+// Older clients print an APIGROUP column, newer ones an APIVERSION column.
+func parseAPIResourcesTable(b []byte) ([]APIResource, error) {
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "NAME") {
+		return nil, fmt.Errorf("Unexpected output of api-resources: %s", string(b))
+	}
+	header := lines[0]
+	columns := []string{"NAME", "SHORTNAMES", "APIGROUP", "APIVERSION", "NAMESPACED", "KIND"}
+	offsets := map[string]int{}
+	for _, column := range columns {
+		if i := strings.Index(header, column+" "); i > -1 {
+			offsets[column] = i
+		} else if strings.HasSuffix(header, column) {
+			offsets[column] = len(header) - len(column)
+		}
+	}
+	if _, ok := offsets["KIND"]; !ok {
+		return nil, fmt.Errorf("Unexpected header of api-resources: %s", header)
+	}
+	cell := func(line string, column string) string {
+		start, ok := offsets[column]
+		if !ok || start >= len(line) {
+			return ""
+		}
+		end := len(line)
+		for _, o := range offsets {
+			if o > start && o < end {
+				end = o
+			}
+		}
+		return strings.TrimSpace(line[start:end])
+	}
+
+	resources := []APIResource{}
+	for _, line := range lines[1:] {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		r := APIResource{
+			Name: cell(line, "NAME"),
+			Kind: cell(line, "KIND"),
+		}
+		if shortNames := cell(line, "SHORTNAMES"); len(shortNames) > 0 {
+			r.ShortNames = strings.Split(shortNames, ",")
+		}
+		if _, ok := offsets["APIVERSION"]; ok {
+			gv := strings.SplitN(cell(line, "APIVERSION"), "/", 2)
+			if len(gv) == 2 {
+				r.Group, r.Version = gv[0], gv[1]
+			} else {
+				r.Version = gv[0]
+			}
+		} else {
+			r.Group = cell(line, "APIGROUP")
+		}
+		if len(r.Name) == 0 || len(r.Kind) == 0 {
+			continue
+		}
+		resources = append(resources, r)
+	}
+	return resources, nil
+}
+
+// APIResources returns the namespaced, listable resources known to the
+// server, using the discovery endpoints. Only the preferred version of each
+// group is taken into account. The client uses the discovered resources from
+// then on.
+func (c *APIClient) APIResources() ([]APIResource, error) {
+	groupVersions := []string{"v1"}
+	b, err := c.request("GET", "/apis", "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to discover API groups: %s", err)
+	}
+	groupList := struct {
+		Groups []struct {
+			PreferredVersion struct {
+				GroupVersion string `json:"groupVersion"`
+			} `json:"preferredVersion"`
+		} `json:"groups"`
+	}{}
+	err = json.Unmarshal(b, &groupList)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groupList.Groups {
+		groupVersions = append(groupVersions, g.PreferredVersion.GroupVersion)
+	}
+
+	resources := []APIResource{}
+	for _, gv := range groupVersions {
+		path := "/apis/" + gv
+		if gv == "v1" {
+			path = "/api/v1"
+		}
+		b, err := c.request("GET", path, "", nil)
+		if err != nil {
+			// Aggregated APIs might be unavailable, which should not prevent
+			// working with the other resources.
+			DebugMsg("Skipping discovery of", gv+":", err.Error())
+			continue
+		}
+		rs, err := parseAPIResourceList(b)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, rs...)
+	}
+	c.resources = resources
+	c.discovered = true
+	return resources, nil
+}
+
+// parseAPIResourceList extracts the namespaced, listable resources from a
+// discovery document. Subresources such as "deploymentconfigs/scale" are
+// skipped.
+func parseAPIResourceList(b []byte) ([]APIResource, error) {
+	list := struct {
+		GroupVersion string `json:"groupVersion"`
+		Resources    []struct {
+			Name       string   `json:"name"`
+			Namespaced bool     `json:"namespaced"`
+			Kind       string   `json:"kind"`
+			Verbs      []string `json:"verbs"`
+			ShortNames []string `json:"shortNames"`
+		} `json:"resources"`
+	}{}
+	err := json.Unmarshal(b, &list)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse discovery document: %s", err)
+	}
+	group := ""
+	version := list.GroupVersion
+	if gv := strings.SplitN(list.GroupVersion, "/", 2); len(gv) == 2 {
+		group, version = gv[0], gv[1]
+	}
+	resources := []APIResource{}
+	for _, r := range list.Resources {
+		if !r.Namespaced || strings.Contains(r.Name, "/") || !utils.Includes(r.Verbs, "list") {
+			continue
+		}
+		resources = append(resources, APIResource{
+			Group:      group,
+			Version:    version,
+			Name:       r.Name,
+			Kind:       r.Kind,
+			ShortNames: r.ShortNames,
+		})
+	}
+	return resources, nil
+}
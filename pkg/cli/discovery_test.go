@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/tailor/internal/test/helper"
+)
+
+func TestParseAPIResourcesTable(t *testing.T) {
+	tests := map[string]struct {
+		fixture  string
+		expected []APIResource
+	}{
+		"APIGROUP column": {
+			fixture: "apigroup.txt",
+			expected: []APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", ShortNames: []string{"cm"}},
+				{Name: "pods", Kind: "Pod", ShortNames: []string{"po"}},
+				{Group: "apps.openshift.io", Name: "deploymentconfigs", Kind: "DeploymentConfig", ShortNames: []string{"dc"}},
+				{Group: "apps", Name: "deployments", Kind: "Deployment", ShortNames: []string{"deploy"}},
+				{Group: "autoscaling", Name: "horizontalpodautoscalers", Kind: "HorizontalPodAutoscaler", ShortNames: []string{"hpa"}},
+				{Group: "networking.k8s.io", Name: "networkpolicies", Kind: "NetworkPolicy", ShortNames: []string{"netpol"}},
+				{Group: "example.com", Name: "widgets", Kind: "Widget"},
+			},
+		},
+		"APIVERSION column": {
+			fixture: "apiversion.txt",
+			expected: []APIResource{
+				{Version: "v1", Name: "configmaps", Kind: "ConfigMap", ShortNames: []string{"cm"}},
+				{Version: "v1", Name: "pods", Kind: "Pod", ShortNames: []string{"po"}},
+				{Group: "apps.openshift.io", Version: "v1", Name: "deploymentconfigs", Kind: "DeploymentConfig", ShortNames: []string{"dc"}},
+				{Group: "apps", Version: "v1", Name: "deployments", Kind: "Deployment", ShortNames: []string{"deploy"}},
+				{Group: "autoscaling", Version: "v1", Name: "horizontalpodautoscalers", Kind: "HorizontalPodAutoscaler", ShortNames: []string{"hpa"}},
+				{Group: "networking.k8s.io", Version: "v1", Name: "networkpolicies", Kind: "NetworkPolicy", ShortNames: []string{"netpol"}},
+				{Group: "example.com", Version: "v1alpha1", Name: "widgets", Kind: "Widget"},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := parseAPIResourcesTable(helper.ReadFixtureFile(t, "api-resources/"+tc.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Fatalf("Resources mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAPIClientAPIResources(t *testing.T) {
+	f, ts := newFakeAPIServer(t)
+	defer ts.Close()
+	f.documents["/api/v1"] = map[string]interface{}{
+		"groupVersion": "v1",
+		"resources": []interface{}{
+			map[string]interface{}{"name": "configmaps", "namespaced": true, "kind": "ConfigMap", "verbs": []string{"get", "list"}, "shortNames": []string{"cm"}},
+			map[string]interface{}{"name": "namespaces", "namespaced": false, "kind": "Namespace", "verbs": []string{"get", "list"}, "shortNames": []string{"ns"}},
+			map[string]interface{}{"name": "pods/log", "namespaced": true, "kind": "Pod", "verbs": []string{"get"}},
+		},
+	}
+	f.documents["/apis"] = map[string]interface{}{
+		"groups": []interface{}{
+			map[string]interface{}{"name": "apps", "preferredVersion": map[string]interface{}{"groupVersion": "apps/v1"}},
+			map[string]interface{}{"name": "metrics.k8s.io", "preferredVersion": map[string]interface{}{"groupVersion": "metrics.k8s.io/v1beta1"}},
+		},
+	}
+	f.documents["/apis/apps/v1"] = map[string]interface{}{
+		"groupVersion": "apps/v1",
+		"resources": []interface{}{
+			map[string]interface{}{"name": "deployments", "namespaced": true, "kind": "Deployment", "verbs": []string{"get", "list"}, "shortNames": []string{"deploy"}},
+			map[string]interface{}{"name": "deployments/scale", "namespaced": true, "kind": "Scale", "verbs": []string{"get"}},
+		},
+	}
+	f.add("/apis/apps/v1/namespaces/foo/deployments", map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "bar", "namespace": "foo", "uid": "123"},
+		"spec":     map[string]interface{}{"replicas": 1},
+	})
+
+	c := newTestAPIClient(ts)
+	// Deployments are not known by default, so they need to be discovered.
+	out, err := c.Export("deploy", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.discovered {
+		t.Fatal("Expected resources to be discovered")
+	}
+	want := `apiVersion: template.openshift.io/v1
+kind: Template
+metadata:
+  name: tailor
+objects:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: bar
+  spec:
+    replicas: 1
+`
+	if diff := cmp.Diff(want, string(out)); diff != "" {
+		t.Fatalf("Export mismatch (-want +got):\n%s", diff)
+	}
+
+	expectedResources := []APIResource{
+		{Version: "v1", Name: "configmaps", Kind: "ConfigMap", ShortNames: []string{"cm"}},
+		{Group: "apps", Version: "v1", Name: "deployments", Kind: "Deployment", ShortNames: []string{"deploy"}},
+	}
+	if diff := cmp.Diff(expectedResources, c.resources); diff != "" {
+		t.Fatalf("Resources mismatch (-want +got):\n%s", diff)
+	}
+}
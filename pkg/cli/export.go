@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+var (
+	// Metadata fields set by the server, which are removed on export.
+	serverManagedMetadataFields = []string{
+		"uid",
+		"selfLink",
+		"resourceVersion",
+		"creationTimestamp",
+		"deletionTimestamp",
+		"deletionGracePeriodSeconds",
+		"generation",
+		"namespace",
+		"managedFields",
+	}
+)
+
+// exportAsTemplate wraps the given items into a template named "tailor",
+// which is the shape "oc export --as-template=tailor" produces. Fields managed
+// by the server are removed from each item.
+func exportAsTemplate(items []interface{}) ([]byte, error) {
+	objects := []interface{}{}
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		cleanupExportedItem(m)
+		objects = append(objects, m)
+	}
+	template := map[string]interface{}{
+		"apiVersion": "template.openshift.io/v1",
+		"kind":       "Template",
+		"metadata": map[string]interface{}{
+			"name": "tailor",
+		},
+		"objects": objects,
+	}
+	return yaml.Marshal(template)
+}
+
+// exportListAsTemplate converts a list as returned by "oc get --output=yaml"
+// into a template. If the list does not contain any items, nothing is returned,
+// which is the same behaviour as "oc export" when no resources are found.
+func exportListAsTemplate(listBytes []byte) ([]byte, error) {
+	var list map[string]interface{}
+	err := yaml.Unmarshal(listBytes, &list)
+	if err != nil {
+		return []byte{}, fmt.Errorf("Could not parse exported resources: %s", err)
+	}
+	items, _ := list["items"].([]interface{})
+	if len(items) == 0 {
+		return []byte{}, nil
+	}
+	return exportAsTemplate(items)
+}
+
+// cleanupExportedItem removes cluster-specific information from an item, in
+// the same way as "oc export" did.
+func cleanupExportedItem(m map[string]interface{}) {
+	delete(m, "status")
+
+	metadata, ok := m["metadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, f := range serverManagedMetadataFields {
+		delete(metadata, f)
+	}
+	name, _ := metadata["name"].(string)
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+
+	spec, _ := m["spec"].(map[string]interface{})
+
+	switch m["kind"] {
+	case "Service":
+		if spec != nil && spec["clusterIP"] != "None" {
+			delete(spec, "clusterIP")
+			delete(spec, "clusterIPs")
+		}
+	case "Route":
+		if spec != nil && annotations["openshift.io/host.generated"] == "true" {
+			delete(spec, "host")
+		}
+	case "ServiceAccount":
+		// Token and dockercfg secrets are generated by the platform.
+		generatedPrefixes := []string{name + "-token-", name + "-dockercfg-"}
+		for _, field := range []string{"secrets", "imagePullSecrets"} {
+			refs, ok := m[field].([]interface{})
+			if !ok {
+				continue
+			}
+			kept := []interface{}{}
+			for _, ref := range refs {
+				refName, _ := ref.(map[string]interface{})["name"].(string)
+				generated := false
+				for _, prefix := range generatedPrefixes {
+					if strings.HasPrefix(refName, prefix) {
+						generated = true
+					}
+				}
+				if !generated {
+					kept = append(kept, ref)
+				}
+			}
+			if len(kept) == 0 {
+				delete(m, field)
+			} else {
+				m[field] = kept
+			}
+		}
+	}
+}
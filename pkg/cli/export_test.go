@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/tailor/internal/test/helper"
+)
+
+func TestExportListAsTemplate(t *testing.T) {
+	tests := map[string]struct {
+		fixture        string
+		expectedGolden string
+	}{
+		"Service and route": {
+			fixture:        "service-and-route.yml",
+			expectedGolden: "service-and-route.yml",
+		},
+		"Empty list": {
+			fixture:        "empty.yml",
+			expectedGolden: "",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, err := exportListAsTemplate(helper.ReadFixtureFile(t, "export-list/"+tc.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := ""
+			if len(tc.expectedGolden) > 0 {
+				want = string(helper.ReadGoldenFile(t, "export-list/"+tc.expectedGolden))
+			}
+			got := string(b)
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("Template mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// APIConfig holds everything needed to talk to the API server.
+type APIConfig struct {
+	Server    string
+	Token     string
+	Namespace string
+	TLSConfig *tls.Config
+}
+
+type kubeConfig struct {
+	CurrentContext string `json:"current-context"`
+	Contexts       []struct {
+		Name    string `json:"name"`
+		Context struct {
+			Cluster   string `json:"cluster"`
+			User      string `json:"user"`
+			Namespace string `json:"namespace"`
+		} `json:"context"`
+	} `json:"contexts"`
+	Clusters []struct {
+		Name    string `json:"name"`
+		Cluster struct {
+			Server                   string `json:"server"`
+			CertificateAuthority     string `json:"certificate-authority"`
+			CertificateAuthorityData string `json:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify"`
+		} `json:"cluster"`
+	} `json:"clusters"`
+	Users []struct {
+		Name string `json:"name"`
+		User struct {
+			Token                 string `json:"token"`
+			ClientCertificate     string `json:"client-certificate"`
+			ClientCertificateData string `json:"client-certificate-data"`
+			ClientKey             string `json:"client-key"`
+			ClientKeyData         string `json:"client-key-data"`
+		} `json:"user"`
+	} `json:"users"`
+}
+
+// LoadAPIConfig reads the kubeconfig file (from $KUBECONFIG or ~/.kube/config)
+// and returns the configuration of the current context.
+func LoadAPIConfig() (*APIConfig, error) {
+	filename, err := kubeConfigFilename()
+	if err != nil {
+		return nil, err
+	}
+	DebugMsg("Reading kubeconfig", filename)
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseKubeConfig(b, filepath.Dir(filename))
+}
+
+// currentAPIConfig returns the kubeconfig used by the API backend, loading it
+// on first use. It is safe to call from several goroutines.
+func currentAPIConfig() (*APIConfig, error) {
+	apiConfigMu.Lock()
+	defer apiConfigMu.Unlock()
+	if apiConfig == nil {
+		c, err := LoadAPIConfig()
+		if err != nil {
+			return nil, fmt.Errorf("Could not load kubeconfig: %s", err)
+		}
+		apiConfig = c
+	}
+	return apiConfig, nil
+}
+
+// kubeConfigFilename returns the first existing file listed in $KUBECONFIG,
+// or ~/.kube/config.
+func kubeConfigFilename() (string, error) {
+	if val := os.Getenv("KUBECONFIG"); len(val) > 0 {
+		for _, f := range filepath.SplitList(val) {
+			if _, err := os.Stat(f); err == nil {
+				return f, nil
+			}
+		}
+		return "", fmt.Errorf("None of the files in KUBECONFIG (%s) exist", val)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".kube", "config"), nil
+}
+
+func parseKubeConfig(b []byte, baseDir string) (*APIConfig, error) {
+	kc := &kubeConfig{}
+	err := yaml.Unmarshal(b, kc)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse kubeconfig: %s", err)
+	}
+	if len(kc.CurrentContext) == 0 {
+		return nil, errors.New("No current context set in kubeconfig")
+	}
+
+	c := &APIConfig{}
+	clusterName := ""
+	userName := ""
+	for _, ctx := range kc.Contexts {
+		if ctx.Name == kc.CurrentContext {
+			clusterName = ctx.Context.Cluster
+			userName = ctx.Context.User
+			c.Namespace = ctx.Context.Namespace
+		}
+	}
+	if len(clusterName) == 0 {
+		return nil, fmt.Errorf("No such context in kubeconfig: %s", kc.CurrentContext)
+	}
+
+	tlsConfig := &tls.Config{}
+	for _, cluster := range kc.Clusters {
+		if cluster.Name != clusterName {
+			continue
+		}
+		c.Server = strings.TrimSuffix(cluster.Cluster.Server, "/")
+		tlsConfig.InsecureSkipVerify = cluster.Cluster.InsecureSkipTLSVerify
+		caData, err := fileOrData(cluster.Cluster.CertificateAuthority, cluster.Cluster.CertificateAuthorityData, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read certificate authority: %s", err)
+		}
+		if len(caData) > 0 {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caData) {
+				return nil, errors.New("Could not parse certificate authority")
+			}
+			tlsConfig.RootCAs = pool
+		}
+	}
+	if len(c.Server) == 0 {
+		return nil, fmt.Errorf("No server configured for cluster %s", clusterName)
+	}
+
+	for _, user := range kc.Users {
+		if user.Name != userName {
+			continue
+		}
+		c.Token = user.User.Token
+		certData, err := fileOrData(user.User.ClientCertificate, user.User.ClientCertificateData, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read client certificate: %s", err)
+		}
+		keyData, err := fileOrData(user.User.ClientKey, user.User.ClientKeyData, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read client key: %s", err)
+		}
+		if len(certData) > 0 && len(keyData) > 0 {
+			cert, err := tls.X509KeyPair(certData, keyData)
+			if err != nil {
+				return nil, fmt.Errorf("Could not load client certificate: %s", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+	c.TLSConfig = tlsConfig
+
+	return c, nil
+}
+
+// fileOrData returns the base64-decoded data if present, otherwise the
+// content of the file (relative to baseDir).
+func fileOrData(file string, data string, baseDir string) ([]byte, error) {
+	if len(data) > 0 {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if len(file) > 0 {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(baseDir, file)
+		}
+		return ioutil.ReadFile(file)
+	}
+	return nil, nil
+}
+
+func (c *APIConfig) httpClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: c.TLSConfig,
+		},
+	}
+}
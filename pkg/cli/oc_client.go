@@ -39,6 +39,33 @@ type OcClientVersioner interface {
 	Version() ([]byte, []byte, error)
 }
 
+// Client is implemented by all backends which Tailor can use to talk to the
+// cluster.
+type Client interface {
+	ClientProcessorExporter
+	OcClientApplier
+	OcClientDeleter
+	OcClientVersioner
+	OcClientDiscoverer
+	CurrentProject() (string, error)
+	CheckProjectExists(p string) (bool, error)
+	CheckLoggedIn() (bool, error)
+}
+
+// NewClient creates a new client for the configured backend: either the "oc"
+// binary, or the API server. The kubeconfig used by the API server backend
+// is loaded on first use.
+func NewClient(namespace string) (Client, error) {
+	if backend == "api" {
+		config, err := currentAPIConfig()
+		if err != nil {
+			return nil, err
+		}
+		return NewAPIClient(namespace, config), nil
+	}
+	return NewOcClient(namespace), nil
+}
+
 // OcClient is a wrapper around the "oc" binary (client).
 type OcClient struct {
 	namespace string
@@ -86,8 +113,13 @@ func (c *OcClient) Process(args []string) ([]byte, []byte, error) {
 }
 
 // Export exports resources from OpenShift as a template.
+// As "oc export" is not available in oc 4 anymore, the resources are
+// retrieved with "oc get" instead and cleaned up locally in that case.
 func (c *OcClient) Export(target string, label string) ([]byte, error) {
 	args := []string{"export", target, "--output=yaml", "--as-template=tailor"}
+	if exportWithGet {
+		args = []string{"get", target, "--output=yaml"}
+	}
 	cmd := c.execOcCmd(
 		args,
 		c.namespace,
@@ -110,6 +142,9 @@ func (c *OcClient) Export(target string, label string) ([]byte, error) {
 		)
 	}
 
+	if exportWithGet {
+		return exportListAsTemplate(outBytes)
+	}
 	return outBytes, nil
 }
 
@@ -15,6 +15,13 @@ func (ov openshiftVersion) ExactMatch() bool {
 	return !ov.Incomplete() && ov.client == ov.server
 }
 
+// ExportSupported is false when the client does not have the "oc export"
+// command anymore, which was removed in oc 4. If the client version is
+// unknown, "oc export" is assumed to be present.
+func (ov openshiftVersion) ExportSupported() bool {
+	return ov.client == "?" || strings.HasPrefix(ov.client, "v3.")
+}
+
 // Incomplete returns true if at least one version could not be detected properly.
 func (ov openshiftVersion) Incomplete() bool {
 	return ov.client == "?" || ov.server == "?"
@@ -37,9 +44,24 @@ func ocVersion(ocClient OcClientVersioner) openshiftVersion {
 		return strings.Join(ocVersionParts[:len(ocVersionParts)-1], ".")
 	}
 
+	// Starting with oc 4, the output looks like "Client Version: 4.4.0".
+	// Versions are normalized to the "v3.11" format of older releases.
+	extractNewVersion := func(versionPart string) string {
+		versionPart = strings.TrimPrefix(strings.TrimSpace(versionPart), "openshift-clients-")
+		return "v" + extractVersion(strings.TrimPrefix(versionPart, "v"))
+	}
+
 	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
 	for _, line := range lines {
 		if len(line) > 0 {
+			if strings.HasPrefix(line, "Client Version:") {
+				ocClientVersion = extractNewVersion(strings.TrimPrefix(line, "Client Version:"))
+				continue
+			}
+			if strings.HasPrefix(line, "Server Version:") {
+				ocServerVersion = extractNewVersion(strings.TrimPrefix(line, "Server Version:"))
+				continue
+			}
 			parts := strings.SplitN(line, " ", 2)
 			if parts[0] == "oc" {
 				ocClientVersion = extractVersion(parts[1])
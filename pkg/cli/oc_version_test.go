@@ -18,24 +18,40 @@ func (c *mockOcVersionClient) Version() ([]byte, []byte, error) {
 
 func TestOcVersion(t *testing.T) {
 	tests := map[string]struct {
-		fixture        string
-		expectedClient string
-		expectedServer string
+		fixture                 string
+		expectedClient          string
+		expectedServer          string
+		expectedExportSupported bool
 	}{
 		"client=3.9 and server=3.11": {
-			fixture:        "client-3_9-and-server-3_11.txt",
-			expectedClient: "v3.9",
-			expectedServer: "v3.11",
+			fixture:                 "client-3_9-and-server-3_11.txt",
+			expectedClient:          "v3.9",
+			expectedServer:          "v3.11",
+			expectedExportSupported: true,
 		},
 		"client=3.11 and server=3.11": {
-			fixture:        "client-3_11-and-server-3_11.txt",
-			expectedClient: "v3.11",
-			expectedServer: "v3.11",
+			fixture:                 "client-3_11-and-server-3_11.txt",
+			expectedClient:          "v3.11",
+			expectedServer:          "v3.11",
+			expectedExportSupported: true,
 		},
 		"client=3.11 and server=?": {
-			fixture:        "client-3_11-and-server-unknown.txt",
-			expectedClient: "v3.11",
-			expectedServer: "?",
+			fixture:                 "client-3_11-and-server-unknown.txt",
+			expectedClient:          "v3.11",
+			expectedServer:          "?",
+			expectedExportSupported: true,
+		},
+		"client=4.4 and server=4.4": {
+			fixture:                 "client-4_4-and-server-4_4.txt",
+			expectedClient:          "v4.4",
+			expectedServer:          "v4.4",
+			expectedExportSupported: false,
+		},
+		"client=4.3 and server=3.11": {
+			fixture:                 "client-4_3-and-server-3_11.txt",
+			expectedClient:          "v4.3",
+			expectedServer:          "v3.11",
+			expectedExportSupported: false,
 		},
 	}
 
@@ -49,6 +65,9 @@ func TestOcVersion(t *testing.T) {
 			if ov.server != tc.expectedServer {
 				t.Fatalf("Expected client version: '%s', got: '%s'", tc.expectedServer, ov.server)
 			}
+			if ov.ExportSupported() != tc.expectedExportSupported {
+				t.Fatalf("Expected export supported: %t, got: %t", tc.expectedExportSupported, ov.ExportSupported())
+			}
 		})
 	}
 }
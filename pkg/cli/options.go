@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
+	"reflect"
 	"strings"
 
 	"github.com/opendevstack/tailor/pkg/utils"
@@ -17,10 +19,20 @@ type GlobalOptions struct {
 	Debug          bool
 	NonInteractive bool
 	OcBinary       string
+	Backend        string
 	File           string
+	Profile        string
 	Force          bool
-	IsLoggedIn     bool
-	fs             utils.FileStater
+	// PlatformManagedFields and ImmutableFields extend the built-in field
+	// catalogs, and are scoped like preserved paths (e.g. bc:foo:/spec/bar).
+	PlatformManagedFields []string
+	ImmutableFields       []string
+	FieldRulesFile        string
+	// RecipientsPolicy is never treated as template, as it might be located
+	// in the template dir.
+	RecipientsPolicy string
+	IsLoggedIn       bool
+	fs               utils.FileStater
 }
 
 // NamespaceOptions define which namespace Tailor works against.
@@ -35,8 +47,14 @@ type CompareOptions struct {
 	*NamespaceOptions
 	Selector                string
 	Exclude                 string
-	TemplateDir             string
+	Kinds                   string
+	TemplateDirs            []string
+	Recursive               bool
+	TemplateInclude         []string
+	TemplateExclude         []string
+	Renderers               []string
 	ParamDir                string
+	OverlayDir              string
 	PrivateKey              string
 	Passphrase              string
 	Labels                  string
@@ -45,10 +63,19 @@ type CompareOptions struct {
 	PreservePaths           []string
 	PreserveImmutableFields bool
 	IgnoreUnknownParameters bool
+	LocalProcessing         bool
+	SubstituteParams        bool
 	UpsertOnly              bool
 	AllowRecreate           bool
 	RevealSecrets           bool
 	Verify                  bool
+	Atomic                  bool
+	Format                  string
+	DiffStyle               string
+	ShowOrder               bool
+	PlanOut                 string
+	PlanFile                string
+	CurrentStateFile        string
 	Resource                string
 }
 
@@ -58,9 +85,14 @@ type ExportOptions struct {
 	*NamespaceOptions
 	Selector        string
 	Exclude         string
-	TemplateDir     string
+	Kinds           string
+	TemplateDirs    []string
 	ParamDir        string
 	WithAnnotations bool
+	OutputDir       string
+	SplitBy         string
+	Parameterize    bool
+	ParamFiles      []string
 	Resource        string
 }
 
@@ -71,6 +103,22 @@ type SecretsOptions struct {
 	PublicKeyDir string
 	PrivateKey   string
 	Passphrase   string
+	Encryption   string
+}
+
+// LintOptions define what to validate offline.
+type LintOptions struct {
+	*GlobalOptions
+	*NamespaceOptions
+	Kinds           string
+	TemplateDirs    []string
+	Recursive       bool
+	TemplateInclude []string
+	TemplateExclude []string
+	Renderers       []string
+	ParamDir        string
+	Params          []string
+	ParamFiles      []string
 }
 
 // InitGlobalOptions creates a new pointer to GlobalOptions with a given filesystem.
@@ -87,10 +135,17 @@ func NewGlobalOptions(
 	debugFlag bool,
 	nonInteractiveFlag bool,
 	ocBinaryFlag string,
-	forceFlag bool) (*GlobalOptions, error) {
+	backendFlag string,
+	forceFlag bool,
+	profileFlag string,
+	platformManagedFlag []string,
+	immutableFlag []string,
+	fieldRulesFlag string,
+	recipientsPolicyFlag string) (*GlobalOptions, error) {
 	o := InitGlobalOptions(&utils.OsFS{})
+	o.Profile = profileFlag
 
-	fileFlags, err := getFileFlags(fileFlag, verbose)
+	fileFlags, err := getFileFlags(fileFlag, profileFlag, verbose)
 	if err != nil {
 		return o, fmt.Errorf("Could not read %s: %s", fileFlag, err)
 	}
@@ -123,15 +178,48 @@ func NewGlobalOptions(
 		o.OcBinary = val
 	}
 
+	o.Backend = "oc"
+	if backendFlag != "oc" {
+		o.Backend = backendFlag
+	} else if val, ok := fileFlags["backend"]; ok {
+		o.Backend = val
+	}
+
 	if forceFlag {
 		o.Force = true
 	} else if fileFlags["force"] == "true" {
 		o.Force = true
 	}
 
+	if len(platformManagedFlag) > 0 {
+		o.PlatformManagedFields = platformManagedFlag
+	} else if val, ok := fileFlags["platform-managed"]; ok {
+		o.PlatformManagedFields = strings.Split(val, "\n")
+	}
+
+	if len(immutableFlag) > 0 {
+		o.ImmutableFields = immutableFlag
+	} else if val, ok := fileFlags["immutable"]; ok {
+		o.ImmutableFields = strings.Split(val, "\n")
+	}
+
+	if len(fieldRulesFlag) > 0 {
+		o.FieldRulesFile = fieldRulesFlag
+	} else if val, ok := fileFlags["field-rules"]; ok {
+		o.FieldRulesFile = val
+	}
+
+	o.RecipientsPolicy = "recipients.yml"
+	if recipientsPolicyFlag != "recipients.yml" {
+		o.RecipientsPolicy = recipientsPolicyFlag
+	} else if val, ok := fileFlags["recipients-policy"]; ok {
+		o.RecipientsPolicy = val
+	}
+
 	verbose = o.Verbose || o.Debug
 	debug = o.Debug
 	ocBinary = o.OcBinary
+	backend = o.Backend
 
 	DebugMsg(fmt.Sprintf("%#v", o))
 
@@ -144,8 +232,14 @@ func NewCompareOptions(
 	namespaceFlag string,
 	selectorFlag string,
 	excludeFlag string,
-	templateDirFlag string,
+	kindsFlag string,
+	templateDirFlag []string,
+	recursiveFlag bool,
+	templateIncludeFlag []string,
+	templateExcludeFlag []string,
+	rendererFlag []string,
 	paramDirFlag string,
+	overlayDirFlag string,
 	publicKeyDirFlag string,
 	privateKeyFlag string,
 	passphraseFlag string,
@@ -155,10 +249,19 @@ func NewCompareOptions(
 	preserveFlag []string,
 	preserveImmutableFieldsFlag bool,
 	ignoreUnknownParametersFlag bool,
+	localProcessingFlag bool,
+	substituteParamsFlag bool,
 	upsertOnlyFlag bool,
 	allowRecreateFlag bool,
 	revealSecretsFlag bool,
 	verifyFlag bool,
+	atomicFlag bool,
+	formatFlag string,
+	diffStyleFlag string,
+	showOrderFlag bool,
+	outFlag string,
+	planFlag string,
+	currentStateFileFlag string,
 	resourceArg string) (*CompareOptions, error) {
 	o := &CompareOptions{
 		GlobalOptions:    globalOptions,
@@ -166,7 +269,7 @@ func NewCompareOptions(
 	}
 	filename := o.resolvedFile(namespaceFlag)
 
-	fileFlags, err := getFileFlags(filename, verbose)
+	fileFlags, err := getFileFlags(filename, o.Profile, verbose)
 	if err != nil {
 		return o, fmt.Errorf("Could not read %s: %s", filename, err)
 	}
@@ -189,11 +292,43 @@ func NewCompareOptions(
 		o.Exclude = val
 	}
 
-	o.TemplateDir = "."
-	if templateDirFlag != "." {
-		o.TemplateDir = templateDirFlag
+	if len(kindsFlag) > 0 {
+		o.Kinds = kindsFlag
+	} else if val, ok := fileFlags["kinds"]; ok {
+		o.Kinds = val
+	}
+
+	o.TemplateDirs = []string{"."}
+	if len(templateDirFlag) > 0 {
+		o.TemplateDirs = templateDirFlag
 	} else if val, ok := fileFlags["template-dir"]; ok {
-		o.TemplateDir = val
+		o.TemplateDirs = strings.Split(val, "\n")
+	}
+
+	if recursiveFlag {
+		o.Recursive = true
+	} else if fileFlags["recursive"] == "true" {
+		o.Recursive = true
+	}
+
+	if len(templateIncludeFlag) > 0 {
+		o.TemplateInclude = templateIncludeFlag
+	} else if val, ok := fileFlags["template-include"]; ok {
+		o.TemplateInclude = strings.Split(val, "\n")
+	}
+
+	if len(templateExcludeFlag) > 0 {
+		o.TemplateExclude = templateExcludeFlag
+	} else if val, ok := fileFlags["template-exclude"]; ok {
+		o.TemplateExclude = strings.Split(val, "\n")
+	}
+
+	// Commands might contain commas, so the renderers are separated by
+	// newlines in the Tailorfile flags.
+	if len(rendererFlag) > 0 {
+		o.Renderers = rendererFlag
+	} else if val, ok := fileFlags["renderer"]; ok {
+		o.Renderers = strings.Split(val, "\n")
 	}
 
 	o.ParamDir = "."
@@ -203,6 +338,13 @@ func NewCompareOptions(
 		o.ParamDir = val
 	}
 
+	o.OverlayDir = "overlays"
+	if overlayDirFlag != "overlays" {
+		o.OverlayDir = overlayDirFlag
+	} else if val, ok := fileFlags["overlay-dir"]; ok {
+		o.OverlayDir = val
+	}
+
 	o.PrivateKey = "private.key"
 	if privateKeyFlag != "private.key" {
 		o.PrivateKey = privateKeyFlag
@@ -223,7 +365,7 @@ func NewCompareOptions(
 	}
 
 	if val, ok := fileFlags["param"]; ok {
-		o.Params = strings.Split(val, ",")
+		o.Params = strings.Split(val, "\n")
 	}
 	if len(paramFlag) > 0 {
 		params := map[string]string{}
@@ -254,15 +396,15 @@ func NewCompareOptions(
 	if len(paramFileFlag) > 0 {
 		o.ParamFiles = paramFileFlag
 	} else if val, ok := fileFlags["param-file"]; ok {
-		o.ParamFiles = strings.Split(val, ",")
+		o.ParamFiles = strings.Split(val, "\n")
 	}
 
 	if len(preserveFlag) > 0 {
 		o.PreservePaths = preserveFlag
 	} else if val, ok := fileFlags["ignore-path"]; ok {
-		o.PreservePaths = strings.Split(val, ",")
+		o.PreservePaths = strings.Split(val, "\n")
 	} else if val, ok := fileFlags["preserve"]; ok {
-		o.PreservePaths = strings.Split(val, ",")
+		o.PreservePaths = strings.Split(val, "\n")
 	}
 
 	if preserveImmutableFieldsFlag {
@@ -277,6 +419,18 @@ func NewCompareOptions(
 		o.IgnoreUnknownParameters = true
 	}
 
+	if localProcessingFlag {
+		o.LocalProcessing = true
+	} else if fileFlags["local-processing"] == "true" {
+		o.LocalProcessing = true
+	}
+
+	if substituteParamsFlag {
+		o.SubstituteParams = true
+	} else if fileFlags["substitute-params"] == "true" {
+		o.SubstituteParams = true
+	}
+
 	if upsertOnlyFlag {
 		o.UpsertOnly = true
 	} else if fileFlags["upsert-only"] == "true" {
@@ -301,6 +455,44 @@ func NewCompareOptions(
 		o.Verify = true
 	}
 
+	if atomicFlag {
+		o.Atomic = true
+	} else if fileFlags["atomic"] == "true" {
+		o.Atomic = true
+	}
+
+	o.Format = "text"
+	if formatFlag != "text" {
+		o.Format = formatFlag
+	} else if val, ok := fileFlags["format"]; ok {
+		o.Format = val
+	}
+
+	o.DiffStyle = "text"
+	if diffStyleFlag != "text" {
+		o.DiffStyle = diffStyleFlag
+	} else if val, ok := fileFlags["diff-style"]; ok {
+		o.DiffStyle = val
+	}
+
+	if showOrderFlag {
+		o.ShowOrder = true
+	} else if fileFlags["show-order"] == "true" {
+		o.ShowOrder = true
+	}
+
+	// Plans are specific to one invocation, so they cannot be set in the
+	// Tailorfile.
+	o.PlanOut = outFlag
+	o.PlanFile = planFlag
+
+	// Same for recorded snapshots of the current state. As the cluster is
+	// not available then, templates need to be processed locally.
+	o.CurrentStateFile = currentStateFileFlag
+	if len(o.CurrentStateFile) > 0 {
+		o.LocalProcessing = true
+	}
+
 	if len(resourceArg) > 0 {
 		o.Resource = resourceArg
 	} else if val, ok := fileFlags["resource"]; ok {
@@ -318,9 +510,14 @@ func NewExportOptions(
 	namespaceFlag string,
 	selectorFlag string,
 	excludeFlag string,
-	templateDirFlag string,
+	kindsFlag string,
+	templateDirFlag []string,
 	paramDirFlag string,
 	withAnnotationsFlag bool,
+	outputDirFlag string,
+	splitByFlag string,
+	parameterizeFlag bool,
+	paramFileFlag []string,
 	resourceArg string) (*ExportOptions, error) {
 	o := &ExportOptions{
 		GlobalOptions:    globalOptions,
@@ -328,7 +525,7 @@ func NewExportOptions(
 	}
 	filename := o.resolvedFile(namespaceFlag)
 
-	fileFlags, err := getFileFlags(filename, verbose)
+	fileFlags, err := getFileFlags(filename, o.Profile, verbose)
 	if err != nil {
 		return o, fmt.Errorf("Could not read %s: %s", filename, err)
 	}
@@ -351,11 +548,17 @@ func NewExportOptions(
 		o.Exclude = val
 	}
 
-	o.TemplateDir = "."
-	if templateDirFlag != "." {
-		o.TemplateDir = templateDirFlag
+	if len(kindsFlag) > 0 {
+		o.Kinds = kindsFlag
+	} else if val, ok := fileFlags["kinds"]; ok {
+		o.Kinds = val
+	}
+
+	o.TemplateDirs = []string{"."}
+	if len(templateDirFlag) > 0 {
+		o.TemplateDirs = templateDirFlag
 	} else if val, ok := fileFlags["template-dir"]; ok {
-		o.TemplateDir = val
+		o.TemplateDirs = strings.Split(val, "\n")
 	}
 
 	o.ParamDir = "."
@@ -371,6 +574,31 @@ func NewExportOptions(
 		o.WithAnnotations = true
 	}
 
+	if len(outputDirFlag) > 0 {
+		o.OutputDir = outputDirFlag
+	} else if val, ok := fileFlags["output-dir"]; ok {
+		o.OutputDir = val
+	}
+
+	o.SplitBy = "app"
+	if splitByFlag != "app" {
+		o.SplitBy = splitByFlag
+	} else if val, ok := fileFlags["split-by"]; ok {
+		o.SplitBy = val
+	}
+
+	if parameterizeFlag {
+		o.Parameterize = true
+	} else if fileFlags["parameterize"] == "true" {
+		o.Parameterize = true
+	}
+
+	if len(paramFileFlag) > 0 {
+		o.ParamFiles = paramFileFlag
+	} else if val, ok := fileFlags["param-file"]; ok {
+		o.ParamFiles = strings.Split(val, "\n")
+	}
+
 	if len(resourceArg) > 0 {
 		o.Resource = resourceArg
 	} else if val, ok := fileFlags["resource"]; ok {
@@ -388,14 +616,15 @@ func NewSecretsOptions(
 	paramDirFlag string,
 	publicKeyDirFlag string,
 	privateKeyFlag string,
-	passphraseFlag string) (*SecretsOptions, error) {
+	passphraseFlag string,
+	encryptionFlag string) (*SecretsOptions, error) {
 	o := &SecretsOptions{
 		GlobalOptions: globalOptions,
 	}
 	namespaceFlag := "" // namespace does not make sense for secrets
 	filename := o.resolvedFile(namespaceFlag)
 
-	fileFlags, err := getFileFlags(filename, verbose)
+	fileFlags, err := getFileFlags(filename, o.Profile, verbose)
 	if err != nil {
 		return o, fmt.Errorf("Could not read %s: %s", filename, err)
 	}
@@ -421,6 +650,109 @@ func NewSecretsOptions(
 		o.PrivateKey = val
 	}
 
+	o.Encryption = "pgp"
+	if encryptionFlag != "pgp" {
+		o.Encryption = encryptionFlag
+	} else if val, ok := fileFlags["encryption"]; ok {
+		o.Encryption = val
+	}
+
+	DebugMsg(fmt.Sprintf("%#v", o))
+
+	return o, o.check()
+}
+
+// NewLintOptions returns new options for the lint command based on file/flags.
+// In contrast to other commands, the namespace is not looked up in the
+// cluster if it is not given.
+func NewLintOptions(
+	globalOptions *GlobalOptions,
+	namespaceFlag string,
+	kindsFlag string,
+	templateDirFlag []string,
+	recursiveFlag bool,
+	templateIncludeFlag []string,
+	templateExcludeFlag []string,
+	rendererFlag []string,
+	paramDirFlag string,
+	paramFlag []string,
+	paramFileFlag []string) (*LintOptions, error) {
+	o := &LintOptions{
+		GlobalOptions:    globalOptions,
+		NamespaceOptions: &NamespaceOptions{},
+	}
+	filename := o.resolvedFile(namespaceFlag)
+
+	fileFlags, err := getFileFlags(filename, o.Profile, verbose)
+	if err != nil {
+		return o, fmt.Errorf("Could not read %s: %s", filename, err)
+	}
+
+	if len(namespaceFlag) > 0 {
+		o.Namespace = namespaceFlag
+	} else if val, ok := fileFlags["namespace"]; ok {
+		o.Namespace = val
+	}
+
+	if len(kindsFlag) > 0 {
+		o.Kinds = kindsFlag
+	} else if val, ok := fileFlags["kinds"]; ok {
+		o.Kinds = val
+	}
+
+	o.TemplateDirs = []string{"."}
+	if len(templateDirFlag) > 0 {
+		o.TemplateDirs = templateDirFlag
+	} else if val, ok := fileFlags["template-dir"]; ok {
+		o.TemplateDirs = strings.Split(val, "\n")
+	}
+
+	if recursiveFlag {
+		o.Recursive = true
+	} else if fileFlags["recursive"] == "true" {
+		o.Recursive = true
+	}
+
+	if len(templateIncludeFlag) > 0 {
+		o.TemplateInclude = templateIncludeFlag
+	} else if val, ok := fileFlags["template-include"]; ok {
+		o.TemplateInclude = strings.Split(val, "\n")
+	}
+
+	if len(templateExcludeFlag) > 0 {
+		o.TemplateExclude = templateExcludeFlag
+	} else if val, ok := fileFlags["template-exclude"]; ok {
+		o.TemplateExclude = strings.Split(val, "\n")
+	}
+
+	// Commands might contain commas, so the renderers are separated by
+	// newlines in the Tailorfile flags.
+	if len(rendererFlag) > 0 {
+		o.Renderers = rendererFlag
+	} else if val, ok := fileFlags["renderer"]; ok {
+		o.Renderers = strings.Split(val, "\n")
+	}
+
+	o.ParamDir = "."
+	if paramDirFlag != "." {
+		o.ParamDir = paramDirFlag
+	} else if val, ok := fileFlags["param-dir"]; ok {
+		o.ParamDir = val
+	}
+
+	// Only the keys of params matter, so params given as flags do not need
+	// to replace the ones from the Tailorfile.
+	if val, ok := fileFlags["param"]; ok {
+		o.Params = strings.Split(val, "\n")
+	}
+	o.Params = append(o.Params, paramFlag...)
+
+	if len(paramFileFlag) > 0 {
+		o.ParamFiles = paramFileFlag
+	} else if val, ok := fileFlags["param-file"]; ok {
+		o.ParamFiles = strings.Split(val, "\n")
+	}
+
 	DebugMsg(fmt.Sprintf("%#v", o))
 
 	return o, o.check()
@@ -442,6 +774,31 @@ func (o *GlobalOptions) resolvedFile(namespaceFlag string) string {
 	return namespacedFile
 }
 
+// ResolveNamespaces returns the namespaces to work against. Multiple
+// namespaces can be given comma-separated, either via flag or in the
+// Tailorfile. If there is only one namespace, namespaceFlag is returned as-is.
+func (o *GlobalOptions) ResolveNamespaces(namespaceFlag string) ([]string, error) {
+	value := namespaceFlag
+	if len(value) == 0 {
+		fileFlags, err := getFileFlags(o.File, o.Profile, verbose)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read %s: %s", o.File, err)
+		}
+		value = fileFlags["namespace"]
+	}
+	if !strings.Contains(value, ",") {
+		return []string{namespaceFlag}, nil
+	}
+	namespaces := []string{}
+	for _, n := range strings.Split(value, ",") {
+		n = strings.TrimSpace(n)
+		if len(n) > 0 && !utils.Includes(namespaces, n) {
+			namespaces = append(namespaces, n)
+		}
+	}
+	return namespaces, nil
+}
+
 // FileExists checks whether given file exists.
 func (o *GlobalOptions) FileExists(file string) bool {
 	_, err := o.fs.Stat(file)
@@ -449,15 +806,36 @@ func (o *GlobalOptions) FileExists(file string) bool {
 }
 
 func (o *GlobalOptions) check(clusterRequired bool) error {
-	if !o.checkOcBinary() {
-		return fmt.Errorf("No such oc binary: %s", o.OcBinary)
+	if len(o.FieldRulesFile) > 0 {
+		if _, err := os.Stat(o.FieldRulesFile); os.IsNotExist(err) {
+			return fmt.Errorf("Field rules file %s does not exist", o.FieldRulesFile)
+		}
+	}
+	if o.Backend == "api" {
+		return o.checkAPI(clusterRequired)
 	}
+	if o.Backend != "oc" {
+		return fmt.Errorf("Unknown backend '%s', must be one of: oc, api", o.Backend)
+	}
+	// Without a cluster, templates are processed locally, so the oc binary
+	// is not needed either.
 	if clusterRequired {
+		if !o.checkOcBinary() {
+			return fmt.Errorf("No such oc binary: %s", o.OcBinary)
+		}
 		if !o.checkLoggedIn() {
 			return errors.New("You need to login with 'oc login' first")
 		}
-		c := NewOcClient("")
-		if v := ocVersion(c); !v.ExactMatch() {
+		c, err := NewClient("")
+		if err != nil {
+			return err
+		}
+		v := ocVersion(c)
+		exportWithGet = !v.ExportSupported()
+		if exportWithGet {
+			VerboseMsg(fmt.Sprintf("Client (%s) does not support 'oc export', using 'oc get' instead.", v.client))
+		}
+		if !v.ExactMatch() {
 			if v.Incomplete() {
 				VerboseMsg(fmt.Sprintf("Version information is incomplete: client (%s) and server (%s) detected. "+
 					"This is likely due to a local cluster setup. "+
@@ -475,9 +853,29 @@ func (o *GlobalOptions) check(clusterRequired bool) error {
 	return nil
 }
 
+// checkAPI loads the kubeconfig used by the API backend. The versions of
+// client and server are not compared as no "oc" binary is involved.
+func (o *GlobalOptions) checkAPI(clusterRequired bool) error {
+	if !clusterRequired {
+		return nil
+	}
+	_, err := currentAPIConfig()
+	if err != nil {
+		return err
+	}
+	if !o.checkLoggedIn() {
+		return errors.New("You need to login with 'oc login' first")
+	}
+	return nil
+}
+
 func (o *GlobalOptions) checkLoggedIn() bool {
 	if !o.IsLoggedIn {
-		c := NewOcClient("")
+		c, err := NewClient("")
+		if err != nil {
+			VerboseMsg(err.Error())
+			return false
+		}
 		loggedIn, err := c.CheckLoggedIn()
 		if err != nil {
 			VerboseMsg(err.Error())
@@ -497,13 +895,27 @@ func (o *GlobalOptions) checkOcBinary() bool {
 }
 
 func (o *CompareOptions) check() error {
-	// Check if template dir exists
-	if o.TemplateDir != "." {
-		td := o.TemplateDir
-		if _, err := os.Stat(td); os.IsNotExist(err) {
-			return fmt.Errorf("Template directory %s does not exist", td)
+	if !utils.Includes([]string{"text", "json", "yaml"}, o.Format) {
+		return fmt.Errorf("Unknown format '%s', must be one of: text, json, yaml", o.Format)
+	}
+	if !utils.Includes([]string{"text", "fields"}, o.DiffStyle) {
+		return fmt.Errorf("Unknown diff style '%s', must be one of: text, fields", o.DiffStyle)
+	}
+	if len(o.PlanFile) > 0 {
+		if _, err := os.Stat(o.PlanFile); os.IsNotExist(err) {
+			return fmt.Errorf("Plan %s does not exist", o.PlanFile)
+		}
+		if o.Format != "text" {
+			return errors.New("A plan can only be applied with format text")
+		}
+		if len(o.Resource) > 0 {
+			return errors.New("A plan cannot be limited to a resource")
 		}
 	}
+	err := checkTemplateDirs(o.TemplateDirs, o.TemplateInclude, o.TemplateExclude, o.Renderers)
+	if err != nil {
+		return err
+	}
 	// Check if param dir exists
 	if o.ParamDir != "." {
 		pd := o.ParamDir
@@ -511,31 +923,53 @@ func (o *CompareOptions) check() error {
 			return fmt.Errorf("Param directory %s does not exist", pd)
 		}
 	}
+	// Check if overlay dir exists (the default one is optional)
+	if o.OverlayDir != "overlays" {
+		if _, err := os.Stat(o.OverlayDir); os.IsNotExist(err) {
+			return fmt.Errorf("Overlay directory %s does not exist", o.OverlayDir)
+		}
+	}
 
 	if strings.Contains(o.Resource, "/") && len(o.Selector) > 0 {
 		DebugMsg("Ignoring selector", o.Selector, "as resource is given")
 		o.Selector = ""
 	}
 
+	if len(o.CurrentStateFile) > 0 {
+		if _, err := os.Stat(o.CurrentStateFile); os.IsNotExist(err) {
+			return fmt.Errorf("Current state file %s does not exist", o.CurrentStateFile)
+		}
+		// Without a cluster, the namespace can neither be looked up nor checked.
+		if len(o.Namespace) == 0 {
+			return errors.New("A namespace is required when the current state is read from a file")
+		}
+		return nil
+	}
+
 	return o.setNamespace()
 }
 
-func (o *CompareOptions) PathsToPreserve() []string {
+// PathsToPreserve returns the preserved paths, including the given paths of
+// immutable fields if those are preserved as well.
+func (o *CompareOptions) PathsToPreserve(immutablePaths []string) []string {
 	pathsToPreserve := []string{}
 	if o.PreserveImmutableFields {
-		pathsToPreserve = append(
-			pathsToPreserve,
-			"pvc:/spec/accessModes",
-			"pvc:/spec/storageClassName",
-			"pvc:/spec/resources/requests/storage",
-			"route:/spec/host",
-			"secret:/type",
-		)
+		pathsToPreserve = append(pathsToPreserve, immutablePaths...)
 	}
 	return append(pathsToPreserve, o.PreservePaths...)
 }
 
 func (o *ExportOptions) check() error {
+	if !utils.Includes([]string{"app", "kind", "resource"}, o.SplitBy) {
+		return fmt.Errorf("Unknown split-by '%s', must be one of: app, kind, resource", o.SplitBy)
+	}
+	if o.Parameterize {
+		for _, f := range o.ParamFiles {
+			if _, err := os.Stat(f); os.IsNotExist(err) {
+				return fmt.Errorf("Param file %s does not exist", f)
+			}
+		}
+	}
 	if strings.Contains(o.Resource, "/") && len(o.Selector) > 0 {
 		DebugMsg("Ignoring selector", o.Selector, "as resource is given")
 		o.Selector = ""
@@ -545,6 +979,45 @@ func (o *ExportOptions) check() error {
 }
 
 func (o *SecretsOptions) check() error {
+	if !utils.Includes(utils.EncryptionBackends, o.Encryption) {
+		return fmt.Errorf("Unknown encryption '%s', must be one of: %s", o.Encryption, strings.Join(utils.EncryptionBackends, ", "))
+	}
+	return nil
+}
+
+func (o *LintOptions) check() error {
+	err := checkTemplateDirs(o.TemplateDirs, o.TemplateInclude, o.TemplateExclude, o.Renderers)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(o.ParamDir); os.IsNotExist(err) {
+		return fmt.Errorf("Param directory %s does not exist", o.ParamDir)
+	}
+	return nil
+}
+
+// checkTemplateDirs checks that all template dirs exist, and that the
+// patterns to include or exclude templates are valid.
+func checkTemplateDirs(dirs []string, include []string, exclude []string, renderers []string) error {
+	for _, td := range dirs {
+		if _, err := os.Stat(td); os.IsNotExist(err) {
+			return fmt.Errorf("Template directory %s does not exist", td)
+		}
+	}
+	for _, p := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("Invalid template pattern '%s': %s", p, err)
+		}
+	}
+	for _, r := range renderers {
+		pair := strings.SplitN(r, "=", 2)
+		if len(pair) != 2 || len(pair[0]) == 0 || len(strings.TrimSpace(pair[1])) == 0 {
+			return fmt.Errorf("Invalid renderer '%s': must be of form PATTERN=COMMAND", r)
+		}
+		if _, err := path.Match(pair[0], ""); err != nil {
+			return fmt.Errorf("Invalid renderer pattern '%s': %s", pair[0], err)
+		}
+	}
 	return nil
 }
 
@@ -568,7 +1041,10 @@ func (o *NamespaceOptions) checkOcNamespace(n string) error {
 	if utils.Includes(o.CheckedNamespaces, n) {
 		return nil
 	}
-	c := NewOcClient("")
+	c, err := NewClient("")
+	if err != nil {
+		return err
+	}
 	exists, err := c.CheckProjectExists(n)
 	if exists {
 		o.CheckedNamespaces = append(o.CheckedNamespaces, n)
@@ -577,14 +1053,19 @@ func (o *NamespaceOptions) checkOcNamespace(n string) error {
 }
 
 func getOcNamespace() (string, error) {
-	c := NewOcClient("")
+	c, err := NewClient("")
+	if err != nil {
+		return "", err
+	}
 	return c.CurrentProject()
 }
 
-func getFileFlags(filename string, verbose bool) (map[string]string, error) {
+// getFileFlags reads the flags set in given Tailorfile. YAML Tailorfiles are
+// read for given profile, which is not supported by legacy Tailorfiles.
+func getFileFlags(filename string, profile string, verbose bool) (map[string]string, error) {
 	fileFlags := make(map[string]string)
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		if filename == "Tailorfile" {
+		if filename == "Tailorfile" && len(profile) == 0 {
 			if verbose {
 				PrintBluef("--> No file '%s' found.\n", filename)
 			}
@@ -597,6 +1078,12 @@ func getFileFlags(filename string, verbose bool) (map[string]string, error) {
 	if err != nil {
 		return fileFlags, err
 	}
+	if isYAMLTailorfile(b) {
+		return readYAMLTailorfile(filename, profile)
+	}
+	if len(profile) > 0 {
+		return fileFlags, fmt.Errorf("Profile '%s' given, but profiles are only supported by YAML Tailorfiles (see 'tailor config migrate')", profile)
+	}
 	content := string(b)
 	text := strings.TrimSuffix(content, "\n")
 	lines := strings.Split(text, "\n")
@@ -610,8 +1097,18 @@ func getFileFlags(filename string, verbose bool) (map[string]string, error) {
 		if len(pair) == 2 {
 			key := pair[0]
 			value := strings.TrimSpace(pair[1])
+			// Lists are comma-separated in the legacy format, but kept as
+			// lists in the flags (see tailorfileSettings.flags).
+			typ := tailorfileFields()[key]
+			if typ == reflect.TypeOf(valueList{}) {
+				value = strings.Replace(value, ",", "\n", -1)
+			}
 			if val, ok := fileFlags[key]; ok {
-				value = val + "," + value
+				separator := ","
+				if typ == reflect.TypeOf(lineList{}) || typ == reflect.TypeOf(valueList{}) {
+					separator = "\n"
+				}
+				value = val + separator + value
 			}
 			fileFlags[key] = value
 		} else {
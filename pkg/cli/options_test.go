@@ -1,8 +1,12 @@
 package cli
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/opendevstack/tailor/internal/test/helper"
 	"github.com/opendevstack/tailor/pkg/utils"
 )
@@ -56,3 +60,192 @@ func TestResolvedFile(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveNamespaces(t *testing.T) {
+	tests := map[string]struct {
+		namespaceFlag string
+		tailorfile    string
+		expected      []string
+	}{
+		"single namespace flag": {
+			namespaceFlag: "foo",
+			tailorfile:    "namespace bar,baz",
+			expected:      []string{"foo"},
+		},
+		"multiple namespaces in flag": {
+			namespaceFlag: "foo-dev, foo-test,foo-dev",
+			expected:      []string{"foo-dev", "foo-test"},
+		},
+		"multiple namespaces in Tailorfile": {
+			tailorfile: "namespace foo-dev\nnamespace foo-test\n",
+			expected:   []string{"foo-dev", "foo-test"},
+		},
+		"single namespace in Tailorfile": {
+			tailorfile: "namespace foo-dev\n",
+			expected:   []string{""},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "tailor")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			file := filepath.Join(dir, "Tailorfile")
+			err = ioutil.WriteFile(file, []byte(tc.tailorfile), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			o := InitGlobalOptions(&utils.OsFS{})
+			o.File = file
+			actual, err := o.ResolveNamespaces(tc.namespaceFlag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Fatalf("Namespaces mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCompareOptionsCurrentStateFile(t *testing.T) {
+	tests := map[string]struct {
+		namespace        string
+		currentStateFile string
+		expectedErr      string
+	}{
+		"existing file and namespace": {
+			namespace:        "foo",
+			currentStateFile: "../../internal/test/fixtures/export/is.yml",
+		},
+		"missing file": {
+			namespace:        "foo",
+			currentStateFile: "does-not-exist.yml",
+			expectedErr:      "Current state file does-not-exist.yml does not exist",
+		},
+		"missing namespace": {
+			currentStateFile: "../../internal/test/fixtures/export/is.yml",
+			expectedErr:      "A namespace is required when the current state is read from a file",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := &CompareOptions{
+				GlobalOptions:    InitGlobalOptions(&utils.OsFS{}),
+				NamespaceOptions: &NamespaceOptions{Namespace: tc.namespace},
+				TemplateDirs:     []string{"."},
+				ParamDir:         ".",
+				OverlayDir:       "overlays",
+				Format:           "text",
+				DiffStyle:        "text",
+				CurrentStateFile: tc.currentStateFile,
+			}
+			err := o.check()
+			actualErr := ""
+			if err != nil {
+				actualErr = err.Error()
+			}
+			if actualErr != tc.expectedErr {
+				t.Fatalf("Expected error '%s', got: '%s'", tc.expectedErr, actualErr)
+			}
+		})
+	}
+}
+
+func TestNewGlobalOptionsOcBinary(t *testing.T) {
+	defer func(b, oc string) { backend, ocBinary = b, oc }(backend, ocBinary)
+	tests := map[string]struct {
+		clusterRequired bool
+		backend         string
+		expectedErr     string
+	}{
+		"oc is not required without cluster": {
+			backend: "oc",
+		},
+		"oc is not required without cluster for API backend": {
+			backend: "api",
+		},
+		"oc is required with cluster": {
+			clusterRequired: true,
+			backend:         "oc",
+			expectedErr:     "No such oc binary: does-not-exist/oc",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewGlobalOptions(
+				tc.clusterRequired, "Tailorfile", false, false, false,
+				"does-not-exist/oc", tc.backend, false, "",
+				[]string{}, []string{}, "", "recipients.yml",
+			)
+			actualErr := ""
+			if err != nil {
+				actualErr = err.Error()
+			}
+			if actualErr != tc.expectedErr {
+				t.Fatalf("Expected error '%s', got: '%s'", tc.expectedErr, actualErr)
+			}
+		})
+	}
+}
+
+func TestNewClientLoadsKubeConfigLazily(t *testing.T) {
+	defer func(b string, c *APIConfig) { backend, apiConfig = b, c }(backend, apiConfig)
+	defer os.Setenv("KUBECONFIG", os.Getenv("KUBECONFIG"))
+	dir, err := ioutil.TempDir("", "tailor-kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kubeconfig := filepath.Join(dir, "config")
+	os.Setenv("KUBECONFIG", kubeconfig)
+
+	_, err = NewGlobalOptions(
+		false, "Tailorfile", false, false, false,
+		"oc", "api", false, "",
+		[]string{}, []string{}, "", "recipients.yml",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewClient("foo")
+	expectedErr := "Could not load kubeconfig: None of the files in KUBECONFIG (" + kubeconfig + ") exist"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("Expected error '%s', got: %v", expectedErr, err)
+	}
+
+	err = ioutil.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+current-context: foo
+contexts:
+- name: foo
+  context:
+    cluster: foo
+    user: foo
+    namespace: foo
+clusters:
+- name: foo
+  cluster:
+    server: https://127.0.0.1:8443
+users:
+- name: foo
+  user:
+    token: s3cret
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := c.CurrentProject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != "foo" {
+		t.Fatalf("Expected namespace of current context, got: %s", p)
+	}
+}
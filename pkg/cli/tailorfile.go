@@ -0,0 +1,417 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Tailorfiles come in two formats: the legacy line-based format ("key value"
+// per line), and a structured YAML format with typed fields, profiles and
+// includes, e.g.:
+//
+//   include:
+//   - ../shared/Tailorfile.yml
+//   template-dir: ocp-templates
+//   param:
+//   - FOO=bar
+//   upsert-only: true
+//   profiles:
+//     dev:
+//       namespace: foo-dev
+//     prod:
+//       extends: dev
+//       namespace: foo-prod
+//
+// Both are turned into the same flags (see getFileFlags).
+
+// tailorfile is the structured (YAML) Tailorfile. The settings on the top
+// level are the base of all profiles.
+type tailorfile struct {
+	Include            []string                       `yaml:"include"`
+	Profiles           map[string]*tailorfileSettings `yaml:"profiles"`
+	tailorfileSettings `yaml:",inline"`
+}
+
+// tailorfileSettings are the flags which can be set in a Tailorfile. Unset
+// fields are nil, so that profiles only override what they set.
+type tailorfileSettings struct {
+	Extends                 *string    `yaml:"extends"`
+	Verbose                 *bool      `yaml:"verbose"`
+	Debug                   *bool      `yaml:"debug"`
+	NonInteractive          *bool      `yaml:"non-interactive"`
+	OcBinary                *string    `yaml:"oc-binary"`
+	Backend                 *string    `yaml:"backend"`
+	Force                   *bool      `yaml:"force"`
+	PlatformManaged         valueList  `yaml:"platform-managed"`
+	Immutable               valueList  `yaml:"immutable"`
+	FieldRules              *string    `yaml:"field-rules"`
+	Namespace               stringList `yaml:"namespace"`
+	Selector                *string    `yaml:"selector"`
+	Exclude                 stringList `yaml:"exclude"`
+	Kinds                   stringList `yaml:"kinds"`
+	TemplateDir             valueList  `yaml:"template-dir"`
+	Recursive               *bool      `yaml:"recursive"`
+	TemplateInclude         valueList  `yaml:"template-include"`
+	TemplateExclude         valueList  `yaml:"template-exclude"`
+	Renderer                lineList   `yaml:"renderer"`
+	ParamDir                *string    `yaml:"param-dir"`
+	OverlayDir              *string    `yaml:"overlay-dir"`
+	PublicKeyDir            *string    `yaml:"public-key-dir"`
+	PrivateKey              *string    `yaml:"private-key"`
+	Passphrase              *string    `yaml:"passphrase"`
+	Encryption              *string    `yaml:"encryption"`
+	RecipientsPolicy        *string    `yaml:"recipients-policy"`
+	Labels                  *string    `yaml:"labels"`
+	Param                   valueList  `yaml:"param"`
+	ParamFile               valueList  `yaml:"param-file"`
+	Preserve                valueList  `yaml:"preserve"`
+	IgnorePath              valueList  `yaml:"ignore-path"`
+	PreserveImmutableFields *bool      `yaml:"preserve-immutable-fields"`
+	IgnoreUnknownParameters *bool      `yaml:"ignore-unknown-parameters"`
+	LocalProcessing         *bool      `yaml:"local-processing"`
+	SubstituteParams        *bool      `yaml:"substitute-params"`
+	UpsertOnly              *bool      `yaml:"upsert-only"`
+	AllowRecreate           *bool      `yaml:"allow-recreate"`
+	RevealSecrets           *bool      `yaml:"reveal-secrets"`
+	Verify                  *bool      `yaml:"verify"`
+	Atomic                  *bool      `yaml:"atomic"`
+	Format                  *string    `yaml:"format"`
+	DiffStyle               *string    `yaml:"diff-style"`
+	ShowOrder               *bool      `yaml:"show-order"`
+	WithAnnotations         *bool      `yaml:"with-annotations"`
+	OutputDir               *string    `yaml:"output-dir"`
+	SplitBy                 *string    `yaml:"split-by"`
+	Parameterize            *bool      `yaml:"parameterize"`
+	Resource                stringList `yaml:"resource"`
+}
+
+// stringList accepts either a list of strings, or a single string.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*l = stringList(list)
+	return nil
+}
+
+// lineList is a stringList whose entries might contain commas, so they are
+// separated by newlines in the flags.
+type lineList []string
+
+func (l *lineList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list stringList
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*l = lineList(list)
+	return nil
+}
+
+// valueList is a list whose entries are passed on as they are, so they might
+// contain commas (e.g. "URL=http://foo?a=1,b=2"). Entries are separated by
+// newlines in the flags. In the legacy format, they are comma-separated.
+type valueList []string
+
+func (l *valueList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list stringList
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*l = valueList(list)
+	return nil
+}
+
+var (
+	yamlTailorfileLineRegex = regexp.MustCompile(`^(---|[A-Za-z0-9-]+:(\s|$))`)
+	yamlTypeErrorRegex      = regexp.MustCompile(` (in type|into) cli\.[a-zA-Z]+`)
+)
+
+// isYAMLTailorfile returns true if the first line which is neither blank nor
+// a comment is a YAML document marker or a "key:" mapping.
+func isYAMLTailorfile(content []byte) bool {
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return yamlTailorfileLineRegex.MatchString(line)
+	}
+	return false
+}
+
+// readYAMLTailorfile returns the flags of the YAML Tailorfile, including its
+// includes, for given profile (none if empty).
+func readYAMLTailorfile(filename string, profile string) (map[string]string, error) {
+	base := &tailorfileSettings{}
+	profiles := map[string]*tailorfileSettings{}
+	err := loadYAMLTailorfile(filename, base, profiles, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	fileFlags := base.flags()
+	if len(profile) == 0 {
+		return fileFlags, nil
+	}
+	// Resolve the chain of profiles, starting with the one extending the base
+	chain := []*tailorfileSettings{}
+	seen := []string{}
+	for name := profile; len(name) > 0; {
+		for _, s := range seen {
+			if s == name {
+				return nil, fmt.Errorf("Profiles extend each other: %s", strings.Join(append(seen, name), " -> "))
+			}
+		}
+		p, ok := profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("No profile '%s', must be one of: %s", name, strings.Join(profileNames(profiles), ", "))
+		}
+		seen = append(seen, name)
+		chain = append([]*tailorfileSettings{p}, chain...)
+		name = ""
+		if p.Extends != nil {
+			name = *p.Extends
+		}
+	}
+	for _, p := range chain {
+		for k, v := range p.flags() {
+			fileFlags[k] = v
+		}
+	}
+	return fileFlags, nil
+}
+
+// loadYAMLTailorfile merges the settings and profiles of filename into base
+// and profiles. Included files are loaded first, so that the including file
+// takes precedence.
+func loadYAMLTailorfile(filename string, base *tailorfileSettings, profiles map[string]*tailorfileSettings, including []string) error {
+	for _, f := range including {
+		if f == filename {
+			return fmt.Errorf("%s includes itself: %s", filename, strings.Join(append(including, filename), " -> "))
+		}
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	t := &tailorfile{}
+	err = yaml.UnmarshalStrict(b, t)
+	if err != nil {
+		msg := yamlTypeErrorRegex.ReplaceAllString(err.Error(), "")
+		return fmt.Errorf("%s: %s", filename, strings.Replace(msg, "yaml: unmarshal errors:\n  ", "", 1))
+	}
+	if t.Extends != nil {
+		return fmt.Errorf("%s: extends is only allowed within profiles", filename)
+	}
+
+	for _, include := range t.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(filename), include)
+		}
+		err := loadYAMLTailorfile(include, base, profiles, append(including, filename))
+		if err != nil {
+			return err
+		}
+	}
+	base.merge(&t.tailorfileSettings)
+	for name, p := range t.Profiles {
+		if existing, ok := profiles[name]; ok {
+			existing.merge(p)
+		} else {
+			profiles[name] = p
+		}
+	}
+	return nil
+}
+
+// merge sets all fields which are set in other.
+func (s *tailorfileSettings) merge(other *tailorfileSettings) {
+	sv := reflect.ValueOf(s).Elem()
+	ov := reflect.ValueOf(other).Elem()
+	for i := 0; i < sv.NumField(); i++ {
+		if !ov.Field(i).IsNil() {
+			sv.Field(i).Set(ov.Field(i))
+		}
+	}
+}
+
+// flags returns the set fields in the format of the legacy Tailorfile: lists
+// are comma-separated (lineLists and valueLists newline-separated), and
+// booleans are "true" or "false".
+func (s *tailorfileSettings) flags() map[string]string {
+	fileFlags := map[string]string{}
+	v := reflect.ValueOf(s).Elem()
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		key := t.Field(i).Tag.Get("yaml")
+		f := v.Field(i)
+		if f.IsNil() || key == "extends" {
+			continue
+		}
+		switch val := f.Interface().(type) {
+		case *string:
+			fileFlags[key] = *val
+		case *bool:
+			fileFlags[key] = strconv.FormatBool(*val)
+		case stringList:
+			fileFlags[key] = strings.Join(val, ",")
+		case lineList:
+			fileFlags[key] = strings.Join(val, "\n")
+		case valueList:
+			fileFlags[key] = strings.Join(val, "\n")
+		}
+	}
+	return fileFlags
+}
+
+func profileNames(profiles map[string]*tailorfileSettings) []string {
+	names := []string{}
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MigrateTailorfile converts the legacy Tailorfile to the YAML format. Flags
+// given multiple times are turned into lists.
+func MigrateTailorfile(filename string) ([]byte, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if isYAMLTailorfile(b) {
+		return nil, fmt.Errorf("%s is a YAML Tailorfile already", filename)
+	}
+
+	values := map[string][]string{}
+	keys := []string{}
+	for _, untrimmedLine := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		line := strings.TrimSpace(untrimmedLine)
+		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		pair := strings.SplitN(line, " ", 2)
+		key := "resource"
+		value := pair[0]
+		if len(pair) == 2 {
+			key = pair[0]
+			value = strings.TrimSpace(pair[1])
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = append(values[key], value)
+	}
+
+	fields := tailorfileFields()
+	out := yaml.MapSlice{}
+	for _, key := range keys {
+		vals := values[key]
+		typ, ok := fields[key]
+		if !ok || key == "extends" {
+			return nil, fmt.Errorf("Unknown flag '%s' in %s", key, filename)
+		}
+		var value interface{}
+		switch typ {
+		case reflect.TypeOf(stringList{}), reflect.TypeOf(valueList{}):
+			list := []string{}
+			for _, v := range vals {
+				list = append(list, strings.Split(v, ",")...)
+			}
+			value = list
+			if len(list) == 1 {
+				value = list[0]
+			}
+		case reflect.TypeOf(lineList{}):
+			value = vals
+			if len(vals) == 1 {
+				value = vals[0]
+			}
+		case reflect.TypeOf(new(bool)):
+			b, err := strconv.ParseBool(vals[len(vals)-1])
+			if err != nil {
+				return nil, fmt.Errorf("Flag '%s' in %s is not a boolean: %s", key, filename, vals[len(vals)-1])
+			}
+			value = b
+		default:
+			value = strings.Join(vals, ",")
+		}
+		out = append(out, yaml.MapItem{Key: key, Value: value})
+	}
+	if len(out) == 0 {
+		return nil, errors.New("No flags found to migrate")
+	}
+	return yaml.Marshal(out)
+}
+
+// tailorfileFields returns the type of each flag which can be set in a
+// Tailorfile.
+func tailorfileFields() map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	st := reflect.TypeOf(tailorfileSettings{})
+	for i := 0; i < st.NumField(); i++ {
+		fields[st.Field(i).Tag.Get("yaml")] = st.Field(i).Type
+	}
+	return fields
+}
+
+// LintTailorfile returns the problems of the Tailorfile used for the
+// namespace, such as unknown flags or booleans which cannot be parsed. Those
+// are silently ignored otherwise.
+func (o *LintOptions) LintTailorfile() []string {
+	filename := o.resolvedFile(o.Namespace)
+	if !o.FileExists(filename) {
+		return []string{}
+	}
+	fileFlags, err := getFileFlags(filename, o.Profile, false)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %s", filename, err)}
+	}
+	keys := []string{}
+	for key := range fileFlags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	problems := []string{}
+	fields := tailorfileFields()
+	for _, key := range keys {
+		val := fileFlags[key]
+		typ, ok := fields[key]
+		if !ok || key == "extends" {
+			problems = append(problems, fmt.Sprintf("%s: unknown flag '%s'", filename, key))
+			continue
+		}
+		if typ == reflect.TypeOf(new(bool)) {
+			if _, err := strconv.ParseBool(val); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: flag '%s' is not a boolean: %s", filename, key, val))
+			}
+		}
+		if key == "param" {
+			for _, p := range strings.Split(val, "\n") {
+				if !strings.Contains(p, "=") {
+					problems = append(problems, fmt.Sprintf("%s: param '%s' is not of form KEY=VALUE", filename, p))
+				}
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,332 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/tailor/pkg/utils"
+)
+
+func writeTailorfiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "tailor-tailorfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		f := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(f), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(f, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGetFileFlagsYAML(t *testing.T) {
+	dir := writeTailorfiles(t, map[string]string{
+		"shared/Tailorfile.yml": `
+selector: app=foo
+param: SHARED=true
+profiles:
+  prod:
+    allow-recreate: false
+`,
+		"Tailorfile": `# Structured Tailorfile
+include:
+- shared/Tailorfile.yml
+template-dir: templates
+param:
+- FOO=bar
+- BAZ=qux
+upsert-only: true
+profiles:
+  dev:
+    namespace: foo-dev
+    allow-recreate: true
+  prod:
+    extends: dev
+    namespace: foo-prod
+    upsert-only: false
+`,
+	})
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "Tailorfile")
+
+	tests := map[string]struct {
+		profile  string
+		expected map[string]string
+	}{
+		"base": {
+			expected: map[string]string{
+				"selector":     "app=foo",
+				"param":        "FOO=bar\nBAZ=qux",
+				"template-dir": "templates",
+				"upsert-only":  "true",
+			},
+		},
+		"profile": {
+			profile: "dev",
+			expected: map[string]string{
+				"selector":       "app=foo",
+				"param":          "FOO=bar\nBAZ=qux",
+				"template-dir":   "templates",
+				"upsert-only":    "true",
+				"namespace":      "foo-dev",
+				"allow-recreate": "true",
+			},
+		},
+		"extending profile": {
+			profile: "prod",
+			expected: map[string]string{
+				"selector":       "app=foo",
+				"param":          "FOO=bar\nBAZ=qux",
+				"template-dir":   "templates",
+				"upsert-only":    "false",
+				"namespace":      "foo-prod",
+				"allow-recreate": "false",
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := getFileFlags(filename, tc.profile, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Fatalf("Flags mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetFileFlagsYAMLErrors(t *testing.T) {
+	dir := writeTailorfiles(t, map[string]string{
+		"unknown-key": "template-dir: foo\nupsert-only: true\nupsert_only: true\n",
+		"wrong-type":  "upsert-only: yes please\n",
+		"cycle-a":     "include: [cycle-b]\n",
+		"cycle-b":     "include: [cycle-a]\n",
+		"profiles":    "profiles:\n  a:\n    extends: b\n  b:\n    extends: a\n",
+		"legacy":      "template-dir foo\n",
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		filename    string
+		profile     string
+		expectedErr string
+	}{
+		"unknown key": {
+			filename:    "unknown-key",
+			expectedErr: "unknown-key: line 3: field upsert_only not found",
+		},
+		"wrong type": {
+			filename:    "wrong-type",
+			expectedErr: "wrong-type: line 1: cannot unmarshal !!str `yes please` into bool",
+		},
+		"include cycle": {
+			filename:    "cycle-a",
+			expectedErr: "cycle-a includes itself: cycle-a -> cycle-b -> cycle-a",
+		},
+		"profile cycle": {
+			filename:    "profiles",
+			profile:     "a",
+			expectedErr: "Profiles extend each other: a -> b -> a",
+		},
+		"unknown profile": {
+			filename:    "profiles",
+			profile:     "c",
+			expectedErr: "No profile 'c', must be one of: a, b",
+		},
+		"profile in legacy file": {
+			filename:    "legacy",
+			profile:     "a",
+			expectedErr: "Profile 'a' given, but profiles are only supported by YAML Tailorfiles (see 'tailor config migrate')",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := getFileFlags(filepath.Join(dir, tc.filename), tc.profile, false)
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			actual := err.Error()
+			actual = strings.Replace(actual, dir+string(os.PathSeparator), "", -1)
+			if diff := cmp.Diff(tc.expectedErr, actual); diff != "" {
+				t.Fatalf("Error mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMigrateTailorfile(t *testing.T) {
+	dir := writeTailorfiles(t, map[string]string{
+		"Tailorfile": `// legacy Tailorfile
+template-dir foo
+param FOO=bar
+param BAZ=qux,QUX=baz
+upsert-only true
+selector app=foo
+renderer chart=helm template chart --set a=1,b=2
+renderer *.jsonnet=jsonnet $TAILOR_RENDER_PATH
+
+bc,is,dc,svc
+`,
+	})
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "Tailorfile")
+
+	b, err := MigrateTailorfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `template-dir: foo
+param:
+- FOO=bar
+- BAZ=qux
+- QUX=baz
+upsert-only: true
+selector: app=foo
+renderer:
+- chart=helm template chart --set a=1,b=2
+- '*.jsonnet=jsonnet $TAILOR_RENDER_PATH'
+resource:
+- bc
+- is
+- dc
+- svc
+`
+	if diff := cmp.Diff(expected, string(b)); diff != "" {
+		t.Fatalf("Migration mismatch (-want +got):\n%s", diff)
+	}
+
+	// The migrated file results in the same flags
+	legacyFlags, err := getFileFlags(filename, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filename, b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlFlags, err := getFileFlags(filename, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(legacyFlags, yamlFlags); diff != "" {
+		t.Fatalf("Flags mismatch (-legacy +yaml):\n%s", diff)
+	}
+}
+
+func TestLintTailorfile(t *testing.T) {
+	dir := writeTailorfiles(t, map[string]string{
+		"Tailorfile": `template-dir foo
+upsert-only yes
+upsert-only no
+param FOO=bar
+param BAZ
+tempalte-dir bar
+`,
+	})
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "Tailorfile")
+
+	o := &LintOptions{
+		GlobalOptions:    &GlobalOptions{File: filename, fs: &utils.OsFS{}},
+		NamespaceOptions: &NamespaceOptions{},
+	}
+	actual := []string{}
+	for _, p := range o.LintTailorfile() {
+		actual = append(actual, strings.Replace(p, dir+string(os.PathSeparator), "", -1))
+	}
+	expected := []string{
+		"Tailorfile: param 'BAZ' is not of form KEY=VALUE",
+		"Tailorfile: unknown flag 'tempalte-dir'",
+		"Tailorfile: flag 'upsert-only' is not a boolean: yes,no",
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("Problems mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTailorfileListsWithCommas(t *testing.T) {
+	dir := writeTailorfiles(t, map[string]string{
+		"Tailorfile.yml": `template-dir:
+- templates,v1
+param:
+- URL=http://foo?a=1,b=2
+- FOO=bar
+param-file:
+- foo,bar.env
+`,
+		"Tailorfile.legacy": `template-dir templates,v1
+param URL=http://foo?a=1,FOO=bar
+param-file foo,bar.env
+`,
+		"templates,v1/foo.yml": "kind: Template\n",
+		"templates/foo.yml":    "kind: Template\n",
+		"v1/foo.yml":           "kind: Template\n",
+		"foo,bar.env":          "BAZ=qux\n",
+		"foo":                  "BAZ=qux\n",
+		"bar.env":              "BAZ=qux\n",
+	})
+	defer os.RemoveAll(dir)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		file               string
+		expectedDirs       []string
+		expectedParams     []string
+		expectedParamFiles []string
+	}{
+		"YAML entries are kept as they are": {
+			file:               "Tailorfile.yml",
+			expectedDirs:       []string{"templates,v1"},
+			expectedParams:     []string{"URL=http://foo?a=1,b=2", "FOO=bar"},
+			expectedParamFiles: []string{"foo,bar.env"},
+		},
+		"legacy entries are comma-separated": {
+			file:               "Tailorfile.legacy",
+			expectedDirs:       []string{"templates", "v1"},
+			expectedParams:     []string{"URL=http://foo?a=1", "FOO=bar"},
+			expectedParamFiles: []string{"foo", "bar.env"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			o, err := NewLintOptions(
+				&GlobalOptions{File: tc.file, fs: &utils.OsFS{}},
+				"", "", []string{}, false, []string{}, []string{}, []string{},
+				".", []string{}, []string{},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expectedDirs, o.TemplateDirs); diff != "" {
+				t.Fatalf("Template dirs mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedParams, o.Params); diff != "" {
+				t.Fatalf("Params mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedParamFiles, o.ParamFiles); diff != "" {
+				t.Fatalf("Param files mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
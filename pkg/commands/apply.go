@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
+	"github.com/ghodss/yaml"
 	"github.com/opendevstack/tailor/pkg/cli"
 	"github.com/opendevstack/tailor/pkg/openshift"
 )
@@ -12,120 +16,280 @@ import (
 // Apply prints the drift between desired and current state to STDOUT.
 // If there is any, it asks for confirmation and applies the changeset.
 func Apply(nonInteractive bool, compareOptions *cli.CompareOptions) (bool, error) {
-	ocClient := cli.NewOcClient(compareOptions.Namespace)
+	driftDetected, _, err := runApply(nonInteractive, os.Stdout, os.Stderr, compareOptions)
+	return driftDetected, err
+}
+
+// runApply works like runDiff, and applies the changeset afterwards.
+func runApply(nonInteractive bool, stdout io.Writer, stderr io.Writer, compareOptions *cli.CompareOptions) (bool, *openshift.Changeset, error) {
+	if len(compareOptions.PlanFile) > 0 {
+		return applyPlan(nonInteractive, stdout, compareOptions)
+	}
+	ocClient, err := cli.NewClient(compareOptions.Namespace)
+	if err != nil {
+		return false, nil, err
+	}
 	var buf bytes.Buffer
 	driftDetected, changeset, err := calculateChangeset(&buf, compareOptions, ocClient)
-	fmt.Print(buf.String())
+	// When a machine-readable format is requested, STDOUT only receives the
+	// changeset, and all other output is written to STDERR.
+	w := stdout
+	if compareOptions.Format != "text" {
+		w = stderr
+	}
+	fmt.Fprint(w, buf.String())
 	if err != nil {
-		return driftDetected, err
+		return driftDetected, changeset, err
+	}
+	if compareOptions.Format != "text" {
+		err = printChangeset(stdout, compareOptions, changeset)
+		if err != nil {
+			return driftDetected, changeset, err
+		}
 	}
 
 	if driftDetected {
 		if nonInteractive {
-			err = apply(compareOptions, changeset)
+			err = apply(w, compareOptions, changeset, ocClient)
 			if err != nil {
-				return driftDetected, fmt.Errorf("Apply aborted: %s", err)
+				return driftDetected, changeset, fmt.Errorf("Apply aborted: %s", err)
 			}
 			if compareOptions.Verify {
-				err := performVerification(compareOptions, ocClient)
+				err := performVerification(w, compareOptions, ocClient)
 				if err != nil {
-					return true, err
+					return true, changeset, err
 				}
 			}
 			// As apply has run successfully, there should not be any drift
 			// anymore. Therefore we report driftDetected=false here.
-			return false, nil
+			return false, changeset, nil
 		}
 
 		c := cli.AskForConfirmation("Apply changes?")
 		if c {
-			fmt.Println("")
-			err = apply(compareOptions, changeset)
+			fmt.Fprintln(w, "")
+			err = apply(w, compareOptions, changeset, ocClient)
 			if err != nil {
-				return driftDetected, fmt.Errorf("Apply aborted: %s", err)
+				return driftDetected, changeset, fmt.Errorf("Apply aborted: %s", err)
 			}
 			if compareOptions.Verify {
-				err := performVerification(compareOptions, ocClient)
+				err := performVerification(w, compareOptions, ocClient)
 				if err != nil {
-					return true, err
+					return true, changeset, err
 				}
 			}
 			// As apply has run successfully, there should not be any drift
 			// anymore. Therefore we report driftDetected=false here.
-			return false, nil
+			return false, changeset, nil
 		}
 		// Changes were not applied, so we report if drift was detected.
-		return driftDetected, nil
+		return driftDetected, changeset, nil
 	}
 
 	// No drift, nothing to do ...
-	return false, nil
+	return false, changeset, nil
 }
 
-func apply(compareOptions *cli.CompareOptions, c *openshift.Changeset) error {
-	ocClient := cli.NewOcClient(compareOptions.Namespace)
+func apply(w io.Writer, compareOptions *cli.CompareOptions, c *openshift.Changeset, ocClient cli.Client) error {
+	snapshots := map[string]string{}
+	if compareOptions.Atomic {
+		var err error
+		snapshots, err = takeSnapshots(w, c, ocClient)
+		if err != nil {
+			return fmt.Errorf("Could not take snapshot of current state: %s", err)
+		}
+	}
+
+	applied := []*openshift.Change{}
+	err := applyChanges(w, compareOptions, c, ocClient, &applied)
+	if err != nil && compareOptions.Atomic {
+		rollbackErr := rollback(w, applied, snapshots, ocClient)
+		if rollbackErr != nil {
+			return fmt.Errorf("%s\n%s", err, rollbackErr)
+		}
+	}
+	return err
+}
 
-	for _, change := range c.Create {
-		err := ocApply("Creating", change, compareOptions, ocClient)
+// applyChanges applies the changeset in order (see Changeset.Ordered). Every
+// change which has been applied successfully is recorded in applied.
+func applyChanges(w io.Writer, compareOptions *cli.CompareOptions, c *openshift.Changeset, ocClient cli.Client, applied *[]*openshift.Change) error {
+	for _, change := range c.Ordered() {
+		var err error
+		switch change.Action {
+		case "Create":
+			err = ocApply(w, "Creating", change, compareOptions, ocClient)
+		case "Delete":
+			err = ocDelete(w, change, compareOptions, ocClient)
+		case "Update":
+			err = ocApply(w, "Updating", change, compareOptions, ocClient)
+		}
 		if err != nil {
 			return err
 		}
+		*applied = append(*applied, change)
 	}
+	return nil
+}
 
-	for _, change := range c.Delete {
-		err := ocDelete(change, compareOptions, ocClient)
+// takeSnapshots exports the current state of all resources which will be
+// updated or deleted. The snapshots are keyed by kind/name.
+func takeSnapshots(w io.Writer, c *openshift.Changeset, ocClient cli.OcClientExporter) (map[string]string, error) {
+	snapshots := map[string]string{}
+	names := map[string][]string{}
+	kinds := []string{}
+	for _, change := range append(append([]*openshift.Change{}, c.Delete...), c.Update...) {
+		if _, ok := names[change.Kind]; !ok {
+			kinds = append(kinds, change.Kind)
+		}
+		names[change.Kind] = append(names[change.Kind], change.Name)
+	}
+	if len(kinds) == 0 {
+		return snapshots, nil
+	}
+
+	fmt.Fprint(w, "Taking snapshot of current state ... ")
+	for _, kind := range kinds {
+		outBytes, err := ocClient.Export(kind, "")
 		if err != nil {
-			return err
+			fmt.Fprintln(w, "failed")
+			return nil, err
+		}
+		objects, err := exportedObjects(outBytes)
+		if err != nil {
+			fmt.Fprintln(w, "failed")
+			return nil, err
+		}
+		for _, name := range names[kind] {
+			object, ok := objects[name]
+			if !ok {
+				fmt.Fprintln(w, "failed")
+				return nil, fmt.Errorf("%s/%s not found", kind, name)
+			}
+			b, err := yaml.Marshal(object)
+			if err != nil {
+				fmt.Fprintln(w, "failed")
+				return nil, err
+			}
+			snapshots[kind+"/"+name] = string(b)
 		}
 	}
+	fmt.Fprintln(w, "done")
+	return snapshots, nil
+}
 
-	for _, change := range c.Update {
-		err := ocApply("Updating", change, compareOptions, ocClient)
+// exportedObjects returns the objects of an exported template by name.
+func exportedObjects(b []byte) (map[string]interface{}, error) {
+	objects := map[string]interface{}{}
+	if len(b) == 0 {
+		return objects, nil
+	}
+	template := struct {
+		Objects []map[string]interface{} `json:"objects"`
+	}{}
+	err := yaml.Unmarshal(b, &template)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range template.Objects {
+		metadata, _ := o["metadata"].(map[string]interface{})
+		if name, ok := metadata["name"].(string); ok {
+			objects[name] = o
+		}
+	}
+	return objects, nil
+}
+
+// rollback reverts the applied changes in reverse order: updated resources
+// are restored from their snapshot, deleted resources are re-created from
+// their snapshot, and created resources are deleted.
+func rollback(w io.Writer, applied []*openshift.Change, snapshots map[string]string, ocClient cli.Client) error {
+	if len(applied) == 0 {
+		fmt.Fprintln(w, "\nNo changes were applied, nothing to roll back.")
+		return nil
+	}
+	fmt.Fprintln(w, "\nRolling back applied changes ...")
+	rolledBack := []string{}
+	failed := []string{}
+	for i := len(applied) - 1; i >= 0; i-- {
+		change := applied[i]
+		var label string
+		var errBytes []byte
+		var err error
+		switch change.Action {
+		case "Create":
+			label = "Removing created"
+			fmt.Fprintf(w, "%s %s ... ", label, change.ItemName())
+			errBytes, err = ocClient.Delete(change.Kind, change.Name)
+		case "Delete":
+			label = "Re-creating deleted"
+			fmt.Fprintf(w, "%s %s ... ", label, change.ItemName())
+			errBytes, err = ocClient.Apply(snapshots[change.Kind+"/"+change.Name], "")
+		case "Update":
+			label = "Restoring updated"
+			fmt.Fprintf(w, "%s %s ... ", label, change.ItemName())
+			errBytes, err = ocClient.Apply(snapshots[change.Kind+"/"+change.Name], "")
+		}
 		if err != nil {
-			return err
+			fmt.Fprintln(w, "failed")
+			fmt.Fprint(w, string(errBytes))
+			failed = append(failed, change.ItemName())
+			continue
 		}
+		fmt.Fprintln(w, "done")
+		rolledBack = append(rolledBack, strings.ToLower(label)+" "+change.ItemName())
 	}
 
+	fmt.Fprintf(w, "\nRolled back %d of %d applied change(s):\n", len(rolledBack), len(applied))
+	for _, r := range rolledBack {
+		fmt.Fprintf(w, "* %s\n", r)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf(
+			"Rollback failed for %s, which need to be restored manually",
+			strings.Join(failed, ", "),
+		)
+	}
 	return nil
 }
 
-func ocDelete(change *openshift.Change, compareOptions *cli.CompareOptions, ocClient cli.OcClientDeleter) error {
-	fmt.Printf("Deleting %s ... ", change.ItemName())
+func ocDelete(w io.Writer, change *openshift.Change, compareOptions *cli.CompareOptions, ocClient cli.OcClientDeleter) error {
+	fmt.Fprintf(w, "Deleting %s ... ", change.ItemName())
 	errBytes, err := ocClient.Delete(change.Kind, change.Name)
 	if err == nil {
-		fmt.Println("done")
+		fmt.Fprintln(w, "done")
 	} else {
-		fmt.Println("failed")
+		fmt.Fprintln(w, "failed")
 		return errors.New(string(errBytes))
 	}
 	return nil
 }
 
-func ocApply(label string, change *openshift.Change, compareOptions *cli.CompareOptions, ocClient cli.OcClientApplier) error {
-	fmt.Printf("%s %s ... ", label, change.ItemName())
+func ocApply(w io.Writer, label string, change *openshift.Change, compareOptions *cli.CompareOptions, ocClient cli.OcClientApplier) error {
+	fmt.Fprintf(w, "%s %s ... ", label, change.ItemName())
 	errBytes, err := ocClient.Apply(change.DesiredState, compareOptions.Selector)
 	if err == nil {
-		fmt.Println("done")
+		fmt.Fprintln(w, "done")
 	} else {
-		fmt.Println("failed")
+		fmt.Fprintln(w, "failed")
 		return errors.New(string(errBytes))
 	}
 
 	return nil
 }
 
-func performVerification(compareOptions *cli.CompareOptions, ocClient cli.ClientProcessorExporter) error {
+func performVerification(w io.Writer, compareOptions *cli.CompareOptions, ocClient cli.ClientProcessorExporter) error {
 	var buf bytes.Buffer
-	fmt.Print("\nVerifying current state matches desired state ... ")
+	fmt.Fprint(w, "\nVerifying current state matches desired state ... ")
 	driftDetected, _, err := calculateChangeset(&buf, compareOptions, ocClient)
 	if err != nil {
 		return fmt.Errorf("Error: %s", err)
 	}
 	if driftDetected {
-		fmt.Print("failed! Detected drift:\n\n")
-		fmt.Println(buf.String())
+		fmt.Fprint(w, "failed! Detected drift:\n\n")
+		fmt.Fprintln(w, buf.String())
 		return errors.New("Verification failed")
 	}
-	fmt.Println("successful")
+	fmt.Fprintln(w, "successful")
 	return nil
 }
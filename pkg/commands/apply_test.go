@@ -0,0 +1,190 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/tailor/pkg/cli"
+	"github.com/opendevstack/tailor/pkg/openshift"
+)
+
+// mockClient records the changes applied to the cluster. The changes with
+// the indices in failAt (counting from 1) fail.
+type mockClient struct {
+	cli.Client
+	objects map[string][]map[string]interface{}
+	failAt  []int
+	calls   []string
+}
+
+func (c *mockClient) Export(target string, label string) ([]byte, error) {
+	return yaml.Marshal(map[string]interface{}{
+		"kind":    "Template",
+		"objects": c.objects[target],
+	})
+}
+
+func (c *mockClient) Apply(config string, selector string) ([]byte, error) {
+	m := map[string]interface{}{}
+	err := yaml.Unmarshal([]byte(config), &m)
+	if err != nil {
+		return nil, err
+	}
+	metadata, _ := m["metadata"].(map[string]interface{})
+	return c.call(fmt.Sprintf("apply %s/%s %v", m["kind"], metadata["name"], m["data"]))
+}
+
+func (c *mockClient) Delete(kind string, name string) ([]byte, error) {
+	return c.call(fmt.Sprintf("delete %s/%s", kind, name))
+}
+
+func (c *mockClient) call(call string) ([]byte, error) {
+	c.calls = append(c.calls, call)
+	for _, i := range c.failAt {
+		if i == len(c.calls) {
+			return []byte("oops\n"), errors.New("exit status 1")
+		}
+	}
+	return nil, nil
+}
+
+func configMap(name string, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": name},
+		"data":       map[string]interface{}{"value": value},
+	}
+}
+
+func configMapChange(t *testing.T, action string, name string, value string) *openshift.Change {
+	desiredState := ""
+	if action != "Delete" {
+		b, err := yaml.Marshal(configMap(name, value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		desiredState = string(b)
+	}
+	return &openshift.Change{Action: action, Kind: "ConfigMap", Name: name, DesiredState: desiredState}
+}
+
+func TestAtomicApply(t *testing.T) {
+	tests := map[string]struct {
+		failAt         []int
+		expectedCalls  []string
+		expectedErr    string
+		expectedReport string
+	}{
+		"rolls back applied changes in reverse order": {
+			failAt: []int{4},
+			expectedCalls: []string{
+				"apply ConfigMap/new map[value:desired]",
+				"delete ConfigMap/old",
+				"apply ConfigMap/foo map[value:desired]",
+				"apply ConfigMap/bar map[value:desired]",
+				"apply ConfigMap/foo map[value:current]",
+				"apply ConfigMap/old map[value:current]",
+				"delete ConfigMap/new",
+			},
+			expectedErr: "oops\n",
+			expectedReport: `
+Rolled back 3 of 3 applied change(s):
+* restoring updated cm/foo
+* re-creating deleted cm/old
+* removing created cm/new
+`,
+		},
+		"nothing to roll back": {
+			failAt: []int{1},
+			expectedCalls: []string{
+				"apply ConfigMap/new map[value:desired]",
+			},
+			expectedErr:    "oops\n",
+			expectedReport: "No changes were applied, nothing to roll back.",
+		},
+		"succeeds": {
+			expectedCalls: []string{
+				"apply ConfigMap/new map[value:desired]",
+				"delete ConfigMap/old",
+				"apply ConfigMap/foo map[value:desired]",
+				"apply ConfigMap/bar map[value:desired]",
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := &mockClient{
+				objects: map[string][]map[string]interface{}{
+					"ConfigMap": {
+						configMap("foo", "current"),
+						configMap("bar", "current"),
+						configMap("old", "current"),
+					},
+				},
+				failAt: tc.failAt,
+			}
+			changeset := &openshift.Changeset{
+				Create: []*openshift.Change{configMapChange(t, "Create", "new", "desired")},
+				Delete: []*openshift.Change{configMapChange(t, "Delete", "old", "")},
+				Update: []*openshift.Change{
+					configMapChange(t, "Update", "foo", "desired"),
+					configMapChange(t, "Update", "bar", "desired"),
+				},
+			}
+			compareOptions := &cli.CompareOptions{Atomic: true}
+			var buf bytes.Buffer
+			err := apply(&buf, compareOptions, changeset, c)
+			if diff := cmp.Diff(tc.expectedCalls, c.calls); diff != "" {
+				t.Fatalf("Calls mismatch (-want +got):\n%s", diff)
+			}
+			if len(tc.expectedErr) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tc.expectedErr) {
+				t.Fatalf("Expected error '%s', got: %v", tc.expectedErr, err)
+			}
+			if !strings.Contains(buf.String(), tc.expectedReport) {
+				t.Fatalf("Expected report:\n%s\ngot:\n%s", tc.expectedReport, buf.String())
+			}
+		})
+	}
+}
+
+func TestAtomicApplyFailedRollback(t *testing.T) {
+	c := &mockClient{
+		objects: map[string][]map[string]interface{}{
+			"ConfigMap": {configMap("foo", "current"), configMap("bar", "current")},
+		},
+		failAt: []int{3, 5},
+	}
+	changeset := &openshift.Changeset{
+		Create: []*openshift.Change{configMapChange(t, "Create", "new", "desired")},
+		Update: []*openshift.Change{
+			configMapChange(t, "Update", "foo", "desired"),
+			configMapChange(t, "Update", "bar", "desired"),
+		},
+	}
+	var buf bytes.Buffer
+	err := apply(&buf, &cli.CompareOptions{Atomic: true}, changeset, c)
+	// Updating bar fails, restoring foo succeeds, then removing new fails.
+	expectedErr := "oops\n\nRollback failed for cm/new, which need to be restored manually"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("Expected error '%s', got: %v", expectedErr, err)
+	}
+	expectedReport := `
+Rolled back 1 of 2 applied change(s):
+* restoring updated cm/foo
+`
+	if !strings.Contains(buf.String(), expectedReport) {
+		t.Fatalf("Expected report:\n%s\ngot:\n%s", expectedReport, buf.String())
+	}
+}
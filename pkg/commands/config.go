@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/opendevstack/tailor/pkg/cli"
+)
+
+// MigrateConfig converts the legacy Tailorfile to the YAML format, and prints
+// the result to STDOUT. If write is true, the Tailorfile is replaced instead,
+// keeping the legacy file as backup.
+func MigrateConfig(globalOptions *cli.GlobalOptions, write bool) error {
+	filename := globalOptions.File
+	b, err := cli.MigrateTailorfile(filename)
+	if err != nil {
+		return err
+	}
+	if !write {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	backupFilename := filename + ".legacy"
+	err = os.Rename(filename, backupFilename)
+	if err != nil {
+		return fmt.Errorf("Could not back up %s: %s", filename, err)
+	}
+	err = ioutil.WriteFile(filename, b, 0644)
+	if err != nil {
+		return fmt.Errorf("Could not write %s: %s", filename, err)
+	}
+	fmt.Printf("Migrated %s to YAML. The legacy file was moved to %s.\n", filename, backupFilename)
+	return nil
+}
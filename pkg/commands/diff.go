@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"regexp"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/opendevstack/tailor/pkg/cli"
 	"github.com/opendevstack/tailor/pkg/openshift"
@@ -14,23 +16,77 @@ import (
 
 // Diff prints the drift between desired and current state to STDOUT.
 func Diff(compareOptions *cli.CompareOptions) (bool, error) {
-	ocClient := cli.NewOcClient(compareOptions.Namespace)
-	var buf bytes.Buffer
-	driftDetected, _, err := calculateChangeset(&buf, compareOptions, ocClient)
-	fmt.Print(buf.String())
+	driftDetected, _, err := runDiff(os.Stdout, os.Stderr, compareOptions)
 	return driftDetected, err
 }
 
+// runDiff writes the drift to stdout. When a machine-readable format is
+// requested, informational output is written to stderr.
+func runDiff(stdout io.Writer, stderr io.Writer, compareOptions *cli.CompareOptions) (bool, *openshift.Changeset, error) {
+	ocClient, err := newCompareClient(compareOptions)
+	if err != nil {
+		return false, nil, err
+	}
+	var buf bytes.Buffer
+	driftDetected, changeset, err := calculateChangeset(&buf, compareOptions, ocClient)
+	// Keep STDOUT machine-readable, informational output goes to STDERR.
+	w := stdout
+	if compareOptions.Format != "text" {
+		w = stderr
+	}
+	fmt.Fprint(w, buf.String())
+	if err != nil {
+		return driftDetected, changeset, err
+	}
+	if compareOptions.Format != "text" {
+		err = printChangeset(stdout, compareOptions, changeset)
+		if err != nil {
+			return driftDetected, changeset, err
+		}
+	}
+	if len(compareOptions.PlanOut) > 0 {
+		err = savePlan(w, compareOptions, changeset)
+	}
+	return driftDetected, changeset, err
+}
+
+// printChangeset writes the changeset in the requested machine-readable format.
+func printChangeset(w io.Writer, compareOptions *cli.CompareOptions, changeset *openshift.Changeset) error {
+	report, err := openshift.NewChangesetReport(
+		compareOptions.Namespace,
+		changeset,
+		compareOptions.RevealSecrets,
+	)
+	if err != nil {
+		return err
+	}
+	b, err := report.Marshal(compareOptions.Format)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
 func calculateChangeset(w io.Writer, compareOptions *cli.CompareOptions, ocClient cli.ClientProcessorExporter) (bool, *openshift.Changeset, error) {
 	updateRequired := false
 
-	where := compareOptions.TemplateDir
+	where := strings.Join(compareOptions.TemplateDirs, ", ")
 
-	fmt.Fprintf(w,
-		"Comparing templates in %s with OCP namespace %s.\n",
-		where,
-		compareOptions.Namespace,
-	)
+	if len(compareOptions.CurrentStateFile) > 0 {
+		fmt.Fprintf(w,
+			"Comparing templates in %s with current state of OCP namespace %s recorded in %s.\n",
+			where,
+			compareOptions.Namespace,
+			compareOptions.CurrentStateFile,
+		)
+	} else {
+		fmt.Fprintf(w,
+			"Comparing templates in %s with OCP namespace %s.\n",
+			where,
+			compareOptions.Namespace,
+		)
+	}
 
 	if len(compareOptions.Resource) > 0 && len(compareOptions.Selector) > 0 {
 		fmt.Fprintf(w,
@@ -50,9 +106,13 @@ func calculateChangeset(w io.Writer, compareOptions *cli.CompareOptions, ocClien
 		)
 	}
 
-	resource := compareOptions.Resource
-
-	filter, err := openshift.NewResourceFilter(resource, compareOptions.Selector, compareOptions.Exclude)
+	filter, err := newResourceFilter(
+		compareOptions.Resource,
+		compareOptions.Selector,
+		compareOptions.Exclude,
+		compareOptions.Kinds,
+		ocClient,
+	)
 	if err != nil {
 		return updateRequired, &openshift.Changeset{}, err
 	}
@@ -124,7 +184,10 @@ func calculateChangeset(w io.Writer, compareOptions *cli.CompareOptions, ocClien
 		compareOptions.UpsertOnly,
 		compareOptions.AllowRecreate,
 		compareOptions.RevealSecrets,
-		compareOptions.PathsToPreserve(),
+		compareOptions.PathsToPreserve(openshift.ImmutablePaths()),
+		compareOptions.Format,
+		compareOptions.DiffStyle,
+		compareOptions.ShowOrder,
 	)
 	if err != nil {
 		return false, changeset, err
@@ -133,29 +196,45 @@ func calculateChangeset(w io.Writer, compareOptions *cli.CompareOptions, ocClien
 	return updateRequired, changeset, nil
 }
 
-func compare(w io.Writer, remoteResourceList *openshift.ResourceList, localResourceList *openshift.ResourceList, upsertOnly bool, allowRecreate bool, revealSecrets bool, preservePaths []string) (*openshift.Changeset, error) {
+func compare(w io.Writer, remoteResourceList *openshift.ResourceList, localResourceList *openshift.ResourceList, upsertOnly bool, allowRecreate bool, revealSecrets bool, preservePaths []string, format string, diffStyle string, showOrder bool) (*openshift.Changeset, error) {
 	changeset, err := openshift.NewChangeset(remoteResourceList, localResourceList, upsertOnly, allowRecreate, preservePaths)
 	if err != nil {
 		return changeset, err
 	}
 
+	// Machine-readable formats are written by the caller.
+	if format != "text" {
+		return changeset, nil
+	}
+
+	diff := func(change *openshift.Change) string {
+		if diffStyle == "fields" {
+			return change.FieldsDiff(revealSecrets)
+		}
+		return change.Diff(revealSecrets)
+	}
+
 	for _, change := range changeset.Noop {
-		fmt.Fprintf(w, "* %s is in sync\n", change.ItemName())
+		fmt.Fprintf(w, "* %s is in sync%s\n", change.ItemName(), overlaysNote(change))
 	}
 
 	for _, change := range changeset.Delete {
 		cli.FprintRedf(w, "- %s to delete\n", change.ItemName())
-		fmt.Fprint(w, change.Diff(revealSecrets))
+		fmt.Fprint(w, diff(change))
 	}
 
 	for _, change := range changeset.Create {
-		cli.FprintGreenf(w, "+ %s to create\n", change.ItemName())
-		fmt.Fprint(w, change.Diff(revealSecrets))
+		cli.FprintGreenf(w, "+ %s to create%s\n", change.ItemName(), overlaysNote(change))
+		fmt.Fprint(w, diff(change))
 	}
 
 	for _, change := range changeset.Update {
-		cli.FprintYellowf(w, "~ %s to update\n", change.ItemName())
-		fmt.Fprint(w, change.Diff(revealSecrets))
+		cli.FprintYellowf(w, "~ %s to update%s\n", change.ItemName(), overlaysNote(change))
+		fmt.Fprint(w, diff(change))
+	}
+
+	if showOrder && !changeset.Blank() {
+		printOrder(w, changeset)
 	}
 
 	fmt.Fprintf(w, "\nSummary: %d in sync, ", len(changeset.Noop))
@@ -168,38 +247,131 @@ func compare(w io.Writer, remoteResourceList *openshift.ResourceList, localResou
 	return changeset, nil
 }
 
+// overlaysNote lists the overlays applied to the desired state of change.
+func overlaysNote(change *openshift.Change) string {
+	if len(change.Overlays) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (overlays: %s)", strings.Join(change.Overlays, ", "))
+}
+
+// printOrder prints the changes in the order in which they are applied.
+func printOrder(w io.Writer, changeset *openshift.Changeset) {
+	fmt.Fprint(w, "\nOrder of changes:\n")
+	symbols := map[string]string{"Create": "+", "Delete": "-", "Update": "~"}
+	for i, change := range changeset.Ordered() {
+		fmt.Fprintf(w, "%d. %s %s", i+1, symbols[change.Action], change.ItemName())
+		if len(change.After) > 0 {
+			fmt.Fprintf(w, " (after %s)", strings.Join(change.After, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// newCompareClient returns the client to compare with. When the current
+// state is read from a file, no cluster client is built, as there is neither
+// a cluster nor (with the API backend) a kubeconfig.
+func newCompareClient(compareOptions *cli.CompareOptions) (cli.ClientProcessorExporter, error) {
+	if len(compareOptions.CurrentStateFile) > 0 {
+		return offlineClient{}, nil
+	}
+	return cli.NewClient(compareOptions.Namespace)
+}
+
+// offlineClient is used when the current state is read from a file. As
+// templates are processed locally then, it is not expected to be called.
+// Kinds cannot be discovered either.
+type offlineClient struct{}
+
+func (c offlineClient) Process(args []string) ([]byte, []byte, error) {
+	return nil, nil, errors.New("Templates cannot be processed by the cluster when the current state is read from a file")
+}
+
+func (c offlineClient) Export(target string, label string) ([]byte, error) {
+	return nil, errors.New("Resources cannot be exported when the current state is read from a file")
+}
+
+// newResourceFilter creates a filter for the targeted resources. If no
+// resource is given, the pinned kinds are targeted (if any). Kinds which are
+// not known to Tailor are discovered from the cluster first.
+func newResourceFilter(resource string, selector string, exclude string, kinds string, ocClient interface{}) (*openshift.ResourceFilter, error) {
+	if len(resource) == 0 {
+		resource = kinds
+	}
+	if unknownKinds := openshift.UnknownKinds(resource, exclude); len(unknownKinds) > 0 {
+		if d, ok := ocClient.(cli.OcClientDiscoverer); ok {
+			cli.DebugMsg("Discovering API resources for", strings.Join(unknownKinds, ","))
+			resources, err := d.APIResources()
+			if err != nil {
+				return nil, err
+			}
+			openshift.RegisterAPIResources(resources)
+		}
+	}
+	return openshift.NewResourceFilter(resource, selector, exclude)
+}
+
 func assembleTemplateBasedResourceList(filter *openshift.ResourceFilter, compareOptions *cli.CompareOptions, ocClient cli.OcClientProcessor) (*openshift.ResourceList, error) {
 	var inputs [][]byte
 
-	files, err := ioutil.ReadDir(compareOptions.TemplateDir)
+	templates, err := openshift.FindTemplates(
+		compareOptions.TemplateDirs,
+		compareOptions.Recursive,
+		compareOptions.TemplateInclude,
+		compareOptions.TemplateExclude,
+		compareOptions.Renderers,
+		[]string{compareOptions.RecipientsPolicy},
+	)
 	if err != nil {
 		return nil, err
 	}
-	filePattern := ".*\\.ya?ml$"
-	re := regexp.MustCompile(filePattern)
-	for _, file := range files {
-		matched := re.MatchString(file.Name())
-		if !matched {
+	for _, template := range templates {
+		if len(template.Renderer) > 0 {
+			renderedOut, err := openshift.RenderTemplate(template, compareOptions.ParamDir, compareOptions)
+			if err != nil {
+				return nil, fmt.Errorf("Could not render %s: %s", template.Path(), err)
+			}
+			inputs = append(inputs, renderedOut)
 			continue
 		}
-		cli.DebugMsg("Reading template", file.Name())
+		cli.DebugMsg("Reading template", template.Path())
 		processedOut, err := openshift.ProcessTemplate(
-			compareOptions.TemplateDir,
-			file.Name(),
+			template.Dir,
+			template.Name,
 			compareOptions.ParamDir,
 			compareOptions,
 			ocClient,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("Could not process %s template: %s", file.Name(), err)
+			return nil, fmt.Errorf("Could not process %s template: %s", template.Path(), err)
 		}
 		inputs = append(inputs, processedOut)
 	}
 
-	return openshift.NewTemplateBasedResourceList(filter, inputs...)
+	overlayDir := filepath.Join(compareOptions.OverlayDir, compareOptions.Namespace)
+	overlays, err := openshift.ReadOverlays(overlayDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return openshift.NewTemplateBasedResourceList(filter, overlays, inputs...)
 }
 
+// assemblePlatformBasedResourceList exports the current state from the
+// cluster, or reads it from the snapshot given by --current-state-file.
 func assemblePlatformBasedResourceList(filter *openshift.ResourceFilter, compareOptions *cli.CompareOptions, ocClient cli.OcClientExporter) (*openshift.ResourceList, error) {
+	if len(compareOptions.CurrentStateFile) > 0 {
+		cli.DebugMsg("Reading current state from", compareOptions.CurrentStateFile)
+		b, err := ioutil.ReadFile(compareOptions.CurrentStateFile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read current state: %s", err)
+		}
+		list, err := openshift.NewPlatformBasedResourceList(filter, b)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse current state in %s: %s", compareOptions.CurrentStateFile, err)
+		}
+		return list, nil
+	}
 	exportedOut, err := ocClient.Export(filter.ConvertToKinds(), filter.Label)
 	if err != nil {
 		return nil, fmt.Errorf("Could not export %s resources: %s", filter.String(), err)
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opendevstack/tailor/pkg/cli"
+)
+
+func TestDiffWithCurrentStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailor-current-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"templates/cm.yml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+data:
+  value: desired
+`,
+		"snapshot.yml": `apiVersion: template.openshift.io/v1
+kind: Template
+objects:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: foo
+  data:
+    value: current
+`,
+	}
+	for name, content := range files {
+		f := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(f), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(f, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Neither a cluster, a kubeconfig nor the oc binary are available.
+	for _, backend := range []string{"oc", "api"} {
+		t.Run(backend, func(t *testing.T) {
+			globalOptions, err := cli.NewGlobalOptions(
+				false, "Tailorfile", false, false, false,
+				"does-not-exist/oc", backend, false, "",
+				[]string{}, []string{}, "", "recipients.yml",
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cli.NewGlobalOptions(
+				false, "Tailorfile", false, false, false,
+				"oc", "oc", false, "",
+				[]string{}, []string{}, "", "recipients.yml",
+			)
+			compareOptions := &cli.CompareOptions{
+				GlobalOptions:    globalOptions,
+				NamespaceOptions: &cli.NamespaceOptions{Namespace: "foo"},
+				TemplateDirs:     []string{filepath.Join(dir, "templates")},
+				ParamDir:         dir,
+				OverlayDir:       filepath.Join(dir, "overlays"),
+				Format:           "text",
+				DiffStyle:        "text",
+				LocalProcessing:  true,
+				CurrentStateFile: filepath.Join(dir, "snapshot.yml"),
+			}
+			var stdout, stderr bytes.Buffer
+			driftDetected, _, err := runDiff(&stdout, &stderr, compareOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !driftDetected {
+				t.Fatalf("Expected drift, got:\n%s", stdout.String())
+			}
+			if !strings.Contains(stdout.String(), "value: current") {
+				t.Fatalf("Expected diff of cm/foo, got:\n%s", stdout.String())
+			}
+		})
+	}
+}
@@ -1,21 +1,51 @@
 package commands
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/opendevstack/tailor/pkg/cli"
 	"github.com/opendevstack/tailor/pkg/openshift"
 )
 
-// Export prints an export of targeted resources to STDOUT.
+// Export prints an export of targeted resources to STDOUT, or writes it into
+// several templates in the output dir.
 func Export(exportOptions *cli.ExportOptions) error {
-	filter, err := openshift.NewResourceFilter(exportOptions.Resource, exportOptions.Selector, exportOptions.Exclude)
+	c, err := cli.NewClient(exportOptions.Namespace)
 	if err != nil {
 		return err
 	}
+	filter, err := newResourceFilter(
+		exportOptions.Resource,
+		exportOptions.Selector,
+		exportOptions.Exclude,
+		exportOptions.Kinds,
+		c,
+	)
+	if err != nil {
+		return err
+	}
+
+	var parameterizer *openshift.Parameterizer
+	if exportOptions.Parameterize {
+		knownParams, err := openshift.ReadKnownParams(exportOptions.ParamFiles)
+		if err != nil {
+			return fmt.Errorf("Could not read param files: %s", err)
+		}
+		parameterizer = openshift.NewParameterizer(exportOptions.Namespace, knownParams)
+	}
+
+	if len(exportOptions.OutputDir) > 0 {
+		return exportToDir(os.Stdout, filter, exportOptions, parameterizer, c)
+	}
 
-	c := cli.NewOcClient(exportOptions.Namespace)
-	out, err := openshift.ExportAsTemplateFile(filter, exportOptions.WithAnnotations, c)
+	out, err := openshift.ExportAsTemplateFile(filter, exportOptions.WithAnnotations, parameterizer, c)
 	if err != nil {
 		return fmt.Errorf(
 			"Could not export %s resources as template: %s",
@@ -25,5 +55,140 @@ func Export(exportOptions *cli.ExportOptions) error {
 	}
 
 	fmt.Println(out)
+
+	// The template is written to STDOUT, so its params go into the param
+	// file of the namespace in the param dir, which is used by convention.
+	if parameterizer != nil {
+		paramFile := filepath.Join(exportParamDir(exportOptions), exportOptions.Namespace+".env")
+		return writeParamFile(os.Stderr, paramFile, parameterizer.Values())
+	}
+	return nil
+}
+
+// exportToDir writes the exported resources into one template per group (see
+// openshift.ExportAsTemplateFiles) in the output dir. Existing templates are
+// overwritten, and left untouched if their content did not change. Templates
+// in the output dir which are not part of the export are reported, but not
+// removed as they might have been written by hand. If the templates are
+// parameterized, a param file per template is written into the param dir (or
+// the directory named after the namespace by default). The outcome is printed
+// to w.
+func exportToDir(w io.Writer, filter *openshift.ResourceFilter, exportOptions *cli.ExportOptions, parameterizer *openshift.Parameterizer, c cli.OcClientExporter) error {
+	files, err := openshift.ExportAsTemplateFiles(filter, exportOptions.WithAnnotations, exportOptions.SplitBy, parameterizer, c)
+	if err != nil {
+		return fmt.Errorf(
+			"Could not export %s resources as templates: %s",
+			filter.String(),
+			err,
+		)
+	}
+
+	paramDir := exportParamDir(exportOptions)
+	filenames := []string{}
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		path := filepath.Join(exportOptions.OutputDir, filename)
+		err := writeExportedFile(w, path, []byte(files[filename].Content))
+		if err != nil {
+			return err
+		}
+		if parameterizer != nil && len(files[filename].Params) > 0 {
+			paramFile := filepath.Join(paramDir, strings.TrimSuffix(filename, filepath.Ext(filename))+".env")
+			err := writeParamFile(w, paramFile, files[filename].Params)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return reportStaleTemplates(w, exportOptions.OutputDir, files)
+}
+
+// exportParamDir returns the directory param files are written to, which is
+// the directory named after the namespace unless --param-dir is given.
+func exportParamDir(exportOptions *cli.ExportOptions) string {
+	if exportOptions.ParamDir == "." {
+		return exportOptions.Namespace
+	}
+	return exportOptions.ParamDir
+}
+
+// reportStaleTemplates prints the templates in dir which are not part of the
+// exported files.
+func reportStaleTemplates(w io.Writer, dir string, files map[string]*openshift.ExportedTemplate) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("Could not read %s: %s", dir, err)
+	}
+	stale := 0
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".yml" {
+			continue
+		}
+		if _, ok := files[e.Name()]; ok {
+			continue
+		}
+		cli.FprintRedf(w, "- %s is not part of the export\n", filepath.Join(dir, e.Name()))
+		stale++
+	}
+	if stale > 0 {
+		fmt.Fprintf(w, "%d template(s) in %s were not exported, remove them if the resources are gone.\n", stale, dir)
+	}
+	return nil
+}
+
+// writeParamFile writes the params into given param file. If the file exists
+// already, the values of its params are updated, and other content is kept.
+func writeParamFile(w io.Writer, path string, params map[string]string) error {
+	lines := []string{}
+	existing, err := ioutil.ReadFile(path)
+	if err == nil && len(existing) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(existing), "\n"), "\n")
+	}
+	written := map[string]bool{}
+	for i, line := range lines {
+		pair := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if value, ok := params[pair[0]]; ok && len(pair) == 2 {
+			lines[i] = pair[0] + "=" + value
+			written[pair[0]] = true
+		}
+	}
+	keys := []string{}
+	for key := range params {
+		if !written[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		lines = append(lines, key+"="+params[key])
+	}
+	return writeExportedFile(w, path, []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// writeExportedFile writes content into path, creating its directory if
+// required. The file is not touched if its content did not change. The
+// outcome is printed to w.
+func writeExportedFile(w io.Writer, path string, content []byte) error {
+	existing, readErr := ioutil.ReadFile(path)
+	if readErr == nil && bytes.Equal(existing, content) {
+		fmt.Fprintf(w, "* %s is unchanged\n", path)
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("Could not create %s: %s", filepath.Dir(path), err)
+	}
+	err = ioutil.WriteFile(path, content, 0644)
+	if err != nil {
+		return fmt.Errorf("Could not write %s: %s", path, err)
+	}
+	if os.IsNotExist(readErr) {
+		cli.FprintGreenf(w, "+ %s created\n", path)
+	} else {
+		cli.FprintYellowf(w, "~ %s updated\n", path)
+	}
 	return nil
 }
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/tailor/pkg/cli"
+)
+
+func TestExportToDirAgain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailor-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filter, err := newResourceFilter("cm", "", "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exportOptions := &cli.ExportOptions{
+		NamespaceOptions: &cli.NamespaceOptions{Namespace: "foo"},
+		OutputDir:        dir,
+		SplitBy:          "resource",
+	}
+	c := &mockClient{
+		objects: map[string][]map[string]interface{}{
+			"ConfigMap": {configMap("foo", "a"), configMap("bar", "a")},
+		},
+	}
+	var buf bytes.Buffer
+	err = exportToDir(&buf, filter, exportOptions, nil, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"+ " + filepath.Join(dir, "configmap-bar.yml") + " created",
+		"+ " + filepath.Join(dir, "configmap-foo.yml") + " created",
+	}
+	if diff := cmp.Diff(expected, strings.Split(strings.TrimSpace(buf.String()), "\n")); diff != "" {
+		t.Fatalf("Output mismatch (-want +got):\n%s", diff)
+	}
+
+	// bar was removed, and foo changed.
+	c.objects["ConfigMap"] = []map[string]interface{}{configMap("foo", "b")}
+	buf.Reset()
+	err = exportToDir(&buf, filter, exportOptions, nil, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"~ " + filepath.Join(dir, "configmap-foo.yml") + " updated",
+		"- " + filepath.Join(dir, "configmap-bar.yml") + " is not part of the export",
+		"1 template(s) in " + dir + " were not exported, remove them if the resources are gone.",
+	}
+	if diff := cmp.Diff(expected, strings.Split(strings.TrimSpace(buf.String()), "\n")); diff != "" {
+		t.Fatalf("Output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExportParamDir(t *testing.T) {
+	tests := map[string]struct {
+		paramDir string
+		expected string
+	}{
+		"default": {
+			paramDir: ".",
+			expected: "foo",
+		},
+		"given": {
+			paramDir: "params",
+			expected: "params",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			exportOptions := &cli.ExportOptions{
+				NamespaceOptions: &cli.NamespaceOptions{Namespace: "foo"},
+				ParamDir:         tc.paramDir,
+			}
+			actual := exportParamDir(exportOptions)
+			if actual != tc.expected {
+				t.Fatalf("Expected param dir '%s', got '%s'", tc.expected, actual)
+			}
+		})
+	}
+}
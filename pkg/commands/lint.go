@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opendevstack/tailor/pkg/cli"
+	"github.com/opendevstack/tailor/pkg/openshift"
+)
+
+// Lint validates the Tailorfile, templates and param files without
+// contacting the cluster, and prints the problems found.
+func Lint(lintOptions *cli.LintOptions) error {
+	fmt.Printf(
+		"Linting templates in %s with params in %s.\n",
+		strings.Join(lintOptions.TemplateDirs, ", "),
+		lintOptions.ParamDir,
+	)
+	problems := lintOptions.LintTailorfile()
+	templateProblems, err := openshift.LintTemplates(lintOptions)
+	if err != nil {
+		return err
+	}
+	problems = append(problems, templateProblems...)
+	if len(problems) == 0 {
+		cli.PrintGreenf("No problems found.\n")
+		return nil
+	}
+	for _, p := range problems {
+		cli.PrintRedf("* %s\n", p)
+	}
+	return fmt.Errorf("Found %d problem(s)", len(problems))
+}
@@ -0,0 +1,193 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/opendevstack/tailor/pkg/cli"
+	"github.com/opendevstack/tailor/pkg/openshift"
+)
+
+// namespaceRun is the outcome of diff/apply against one namespace.
+type namespaceRun struct {
+	compareOptions *cli.CompareOptions
+	driftDetected  bool
+	changeset      *openshift.Changeset
+	err            error
+	skipped        bool
+	stdout         bytes.Buffer
+	stderr         bytes.Buffer
+}
+
+type namespaceRunner func(stdout io.Writer, stderr io.Writer, compareOptions *cli.CompareOptions) (bool, *openshift.Changeset, error)
+
+// DiffNamespaces prints the drift of each namespace (in the given order, or
+// in parallel), followed by a summary per namespace.
+func DiffNamespaces(compareOptionsList []*cli.CompareOptions, parallel bool) (bool, error) {
+	err := checkNamespaceRuns(compareOptionsList)
+	if err != nil {
+		return false, err
+	}
+	runs := runNamespaces(compareOptionsList, parallel, false, runDiff)
+	return summarizeNamespaceRuns(runs, "Diff")
+}
+
+// ApplyNamespaces works like DiffNamespaces, and applies the changeset of each
+// namespace. When run in order, namespaces following a failed one are skipped.
+func ApplyNamespaces(nonInteractive bool, compareOptionsList []*cli.CompareOptions, parallel bool) (bool, error) {
+	err := checkNamespaceRuns(compareOptionsList)
+	if err != nil {
+		return false, err
+	}
+	if parallel && !nonInteractive {
+		return false, errors.New("Applying to namespaces in parallel requires --non-interactive")
+	}
+	runs := runNamespaces(compareOptionsList, parallel, true, func(stdout io.Writer, stderr io.Writer, compareOptions *cli.CompareOptions) (bool, *openshift.Changeset, error) {
+		return runApply(nonInteractive, stdout, stderr, compareOptions)
+	})
+	return summarizeNamespaceRuns(runs, "Apply")
+}
+
+func checkNamespaceRuns(compareOptionsList []*cli.CompareOptions) error {
+	for _, o := range compareOptionsList {
+		if len(o.PlanOut) > 0 || len(o.PlanFile) > 0 {
+			return errors.New("Plans cannot be used with multiple namespaces")
+		}
+	}
+	return nil
+}
+
+// runNamespaces calls run for each namespace. In parallel mode, the output of
+// each namespace is buffered and printed once all namespaces are done. As
+// verbose and debug output cannot be buffered per namespace, namespaces are
+// run in order (without stopping on errors) if it is enabled.
+func runNamespaces(compareOptionsList []*cli.CompareOptions, parallel bool, stopOnError bool, run namespaceRunner) []*namespaceRun {
+	runs := []*namespaceRun{}
+	for _, o := range compareOptionsList {
+		runs = append(runs, &namespaceRun{compareOptions: o})
+	}
+
+	if parallel && (compareOptionsList[0].Verbose || compareOptionsList[0].Debug) {
+		cli.VerboseMsg("Running namespaces in order to keep verbose output readable")
+		parallel = false
+		stopOnError = false
+	}
+
+	if !parallel {
+		failed := false
+		for _, r := range runs {
+			if failed && stopOnError {
+				r.skipped = true
+				continue
+			}
+			printNamespaceHeader(os.Stdout, os.Stderr, r.compareOptions)
+			r.driftDetected, r.changeset, r.err = run(os.Stdout, os.Stderr, r.compareOptions)
+			if r.err != nil {
+				failed = true
+				cli.FprintRedf(os.Stderr, "%s\n", r.err)
+			}
+		}
+		return runs
+	}
+
+	// Kinds are discovered up front, as the known kinds are shared between
+	// all namespaces and must not change while they run. Namespaces whose
+	// kinds cannot be resolved are not run at all, so that no discovery
+	// happens concurrently.
+	for _, r := range runs {
+		o := r.compareOptions
+		c, err := newCompareClient(o)
+		if err != nil {
+			r.err = err
+			continue
+		}
+		_, r.err = newResourceFilter(o.Resource, o.Selector, o.Exclude, o.Kinds, c)
+	}
+	var wg sync.WaitGroup
+	for _, r := range runs {
+		if r.err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(r *namespaceRun) {
+			defer wg.Done()
+			r.driftDetected, r.changeset, r.err = run(&r.stdout, &r.stderr, r.compareOptions)
+		}(r)
+	}
+	wg.Wait()
+	for _, r := range runs {
+		printNamespaceHeader(os.Stdout, os.Stderr, r.compareOptions)
+		fmt.Fprint(os.Stderr, r.stderr.String())
+		fmt.Fprint(os.Stdout, r.stdout.String())
+		if r.err != nil {
+			cli.FprintRedf(os.Stderr, "%s\n", r.err)
+		}
+	}
+	return runs
+}
+
+// printNamespaceHeader separates the output of the namespaces. For
+// machine-readable formats, the header goes to stderr, and YAML documents are
+// separated on stdout.
+func printNamespaceHeader(stdout io.Writer, stderr io.Writer, compareOptions *cli.CompareOptions) {
+	w := stdout
+	if compareOptions.Format != "text" {
+		w = stderr
+	}
+	fmt.Fprintf(w, "\n==> Namespace %s\n\n", compareOptions.Namespace)
+	if compareOptions.Format == "yaml" {
+		fmt.Fprintln(stdout, "---")
+	}
+}
+
+// summarizeNamespaceRuns prints the outcome of each namespace. Drift is
+// reported if detected in any namespace, and an error if any namespace failed.
+func summarizeNamespaceRuns(runs []*namespaceRun, label string) (bool, error) {
+	w := os.Stdout
+	for _, r := range runs {
+		if r.compareOptions.Format != "text" {
+			w = os.Stderr
+		}
+	}
+
+	driftDetected := false
+	failed := []string{}
+	fmt.Fprint(w, "\nSummary per namespace:\n")
+	for _, r := range runs {
+		fmt.Fprintf(w, "* %s: ", r.compareOptions.Namespace)
+		if r.skipped {
+			fmt.Fprintln(w, "skipped")
+			continue
+		}
+		if r.err != nil {
+			failed = append(failed, r.compareOptions.Namespace)
+			cli.FprintRedf(w, "failed (%s)\n", strings.SplitN(r.err.Error(), "\n", 2)[0])
+			continue
+		}
+		if r.driftDetected {
+			driftDetected = true
+		}
+		c := r.changeset
+		fmt.Fprintf(w, "%d in sync, ", len(c.Noop))
+		cli.FprintGreenf(w, "%d to create", len(c.Create))
+		fmt.Fprint(w, ", ")
+		cli.FprintYellowf(w, "%d to update", len(c.Update))
+		fmt.Fprint(w, ", ")
+		cli.FprintRedf(w, "%d to delete", len(c.Delete))
+		if !r.driftDetected && !c.Blank() {
+			fmt.Fprint(w, " (applied)")
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w)
+
+	if len(failed) > 0 {
+		return driftDetected, fmt.Errorf("%s failed for namespace(s) %s", label, strings.Join(failed, ", "))
+	}
+	return driftDetected, nil
+}
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/tailor/pkg/cli"
+	"github.com/opendevstack/tailor/pkg/openshift"
+	"github.com/opendevstack/tailor/pkg/utils"
+)
+
+func TestRunNamespacesInParallel(t *testing.T) {
+	globalOptions := cli.InitGlobalOptions(&utils.OsFS{})
+	compareOptionsList := []*cli.CompareOptions{}
+	for _, namespace := range []string{"foo-dev", "foo-test", "foo-prod"} {
+		compareOptionsList = append(compareOptionsList, &cli.CompareOptions{
+			GlobalOptions:    globalOptions,
+			NamespaceOptions: &cli.NamespaceOptions{Namespace: namespace},
+			Resource:         "cm",
+		})
+	}
+	// Kinds which cannot be resolved fail before any namespace runs.
+	compareOptionsList[1].Resource = "unknownkind"
+
+	var mutex sync.Mutex
+	ran := map[string]bool{}
+	runs := runNamespaces(compareOptionsList, true, true, func(stdout io.Writer, stderr io.Writer, compareOptions *cli.CompareOptions) (bool, *openshift.Changeset, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		ran[compareOptions.Namespace] = true
+		return false, &openshift.Changeset{}, nil
+	})
+	if diff := cmp.Diff(map[string]bool{"foo-dev": true, "foo-prod": true}, ran); diff != "" {
+		t.Fatalf("Namespaces run mismatch (-want +got):\n%s", diff)
+	}
+	if runs[1].err == nil {
+		t.Fatal("Expected namespace foo-test to fail")
+	}
+	if runs[0].err != nil || runs[2].err != nil {
+		t.Fatalf("Expected namespaces foo-dev and foo-prod to succeed, got: %v, %v", runs[0].err, runs[2].err)
+	}
+}
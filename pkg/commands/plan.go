@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/opendevstack/tailor/pkg/cli"
+	"github.com/opendevstack/tailor/pkg/openshift"
+)
+
+// savePlan writes the changeset as plan to the file given by --out.
+func savePlan(w io.Writer, compareOptions *cli.CompareOptions, changeset *openshift.Changeset) error {
+	plan, err := openshift.NewPlan(compareOptions.Namespace, compareOptions.Selector, changeset)
+	if err != nil {
+		return err
+	}
+	b, err := plan.Marshal()
+	if err != nil {
+		return err
+	}
+	// The plan contains the desired state of secrets in clear text.
+	err = ioutil.WriteFile(compareOptions.PlanOut, b, 0600)
+	if err != nil {
+		return fmt.Errorf("Could not write plan: %s", err)
+	}
+	fmt.Fprintf(w, "Plan saved to %s. Apply it with 'tailor apply --plan %s'.\n", compareOptions.PlanOut, compareOptions.PlanOut)
+	return nil
+}
+
+// applyPlan applies the plan given by --plan. It refuses to do so if the
+// current state of any affected resource changed since the plan was made.
+func applyPlan(nonInteractive bool, w io.Writer, compareOptions *cli.CompareOptions) (bool, *openshift.Changeset, error) {
+	ocClient, err := cli.NewClient(compareOptions.Namespace)
+	if err != nil {
+		return false, nil, err
+	}
+
+	b, err := ioutil.ReadFile(compareOptions.PlanFile)
+	if err != nil {
+		return false, nil, err
+	}
+	plan, err := openshift.ReadPlan(b)
+	if err != nil {
+		return false, nil, fmt.Errorf("Could not read plan %s: %s", compareOptions.PlanFile, err)
+	}
+	if plan.Namespace != compareOptions.Namespace {
+		return false, nil, fmt.Errorf(
+			"Plan %s was made for OCP namespace %s, not %s",
+			compareOptions.PlanFile,
+			plan.Namespace,
+			compareOptions.Namespace,
+		)
+	}
+	changeset, err := plan.Changeset()
+	if err != nil {
+		return false, nil, err
+	}
+
+	fmt.Fprintf(w,
+		"Applying plan %s to OCP namespace %s.\n",
+		compareOptions.PlanFile,
+		compareOptions.Namespace,
+	)
+	if changeset.Blank() {
+		fmt.Fprintln(w, "Plan contains no changes, nothing to do.")
+		return false, changeset, nil
+	}
+
+	err = verifyPlan(w, plan, compareOptions, ocClient)
+	if err != nil {
+		return true, changeset, err
+	}
+	printPlannedChanges(w, changeset)
+
+	if !nonInteractive {
+		c := cli.AskForConfirmation("Apply plan?")
+		if !c {
+			return true, changeset, nil
+		}
+		fmt.Fprintln(w, "")
+	}
+
+	// Apply with the selector the plan was made with.
+	compareOptions.Selector = plan.Selector
+	err = apply(w, compareOptions, changeset, ocClient)
+	if err != nil {
+		return true, changeset, fmt.Errorf("Apply aborted: %s", err)
+	}
+	if compareOptions.Verify {
+		err := performVerification(w, compareOptions, ocClient)
+		if err != nil {
+			return true, changeset, err
+		}
+	}
+	return false, changeset, nil
+}
+
+// verifyPlan compares the current state of the resources affected by the plan
+// with the fingerprints in the plan.
+func verifyPlan(w io.Writer, plan *openshift.Plan, compareOptions *cli.CompareOptions, ocClient cli.Client) error {
+	filter, err := newResourceFilter(strings.Join(plan.Kinds(), ","), "", "", "", ocClient)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(w, "Verifying current state matches the plan ... ")
+	platformBasedList, err := assemblePlatformBasedResourceList(filter, compareOptions, ocClient)
+	if err != nil {
+		fmt.Fprintln(w, "failed")
+		return err
+	}
+	err = plan.Verify(platformBasedList)
+	if err != nil {
+		fmt.Fprintln(w, "failed")
+		return fmt.Errorf("%s\nRefusing to apply the plan, run diff again to make a new one", err)
+	}
+	fmt.Fprintln(w, "done")
+	return nil
+}
+
+// printPlannedChanges lists the changes of a plan in the order in which they
+// are applied.
+func printPlannedChanges(w io.Writer, changeset *openshift.Changeset) {
+	fmt.Fprintln(w, "")
+	for _, change := range changeset.Ordered() {
+		switch change.Action {
+		case "Create":
+			cli.FprintGreenf(w, "+ %s to create\n", change.ItemName())
+		case "Delete":
+			cli.FprintRedf(w, "- %s to delete\n", change.ItemName())
+		case "Update":
+			cli.FprintYellowf(w, "~ %s to update\n", change.ItemName())
+		}
+	}
+	fmt.Fprint(w, "\nPlan: ")
+	cli.FprintGreenf(w, "%d to create", len(changeset.Create))
+	fmt.Fprint(w, ", ")
+	cli.FprintYellowf(w, "%d to update", len(changeset.Update))
+	fmt.Fprint(w, ", ")
+	cli.FprintRedf(w, "%d to delete\n\n", len(changeset.Delete))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 
@@ -13,11 +14,15 @@ import (
 )
 
 // GenerateKey generates a GPG key using specified email (and optionally name).
+// If age encryption is configured, an age key is generated instead.
 func GenerateKey(secretsOptions *cli.SecretsOptions, email, name string) error {
 	emailParts := strings.Split(email, "@")
 	if len(name) == 0 {
 		name = emailParts[0]
 	}
+	if secretsOptions.Encryption == utils.AgeEncryption {
+		return generateAgeKey(secretsOptions, email, name)
+	}
 	entity, err := utils.CreateEntity(name, email)
 	if err != nil {
 		return fmt.Errorf("Failed to generate keypair: %s", err)
@@ -37,8 +42,26 @@ func GenerateKey(secretsOptions *cli.SecretsOptions, email, name string) error {
 	return nil
 }
 
-// Reveal prints the clear-text of an encrypted file to STDOUT.
-func Reveal(secretsOptions *cli.SecretsOptions, filename string) error {
+func generateAgeKey(secretsOptions *cli.SecretsOptions, email, name string) error {
+	identity, err := utils.GenerateAgeIdentity()
+	if err != nil {
+		return fmt.Errorf("Failed to generate keypair: %s", err)
+	}
+	emailParts := strings.Split(email, "@")
+	publicKeyFilename := strings.Replace(emailParts[0], ".", "-", -1) + ".key"
+	privateKeyFilename := secretsOptions.PrivateKey
+	err = utils.PrintAgeKeys(identity, fmt.Sprintf("%s <%s>", name, email), publicKeyFilename, privateKeyFilename)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Public Key written to %s. This file can be committed.\n", publicKeyFilename)
+	fmt.Printf("Private Key written to %s. This file MUST NOT be committed.\n", privateKeyFilename)
+	return nil
+}
+
+// Reveal prints the clear-text of an encrypted file to STDOUT. If
+// showRecipients is true, the recipients of each value are printed instead.
+func Reveal(secretsOptions *cli.SecretsOptions, filename string, showRecipients bool) error {
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
 		return fmt.Errorf("'%s' does not exist", filename)
 	}
@@ -46,6 +69,9 @@ func Reveal(secretsOptions *cli.SecretsOptions, filename string) error {
 	if err != nil {
 		return fmt.Errorf("Could not read file: %s", err)
 	}
+	if showRecipients {
+		return revealRecipients(secretsOptions, filename, encryptedContent)
+	}
 	decryptedContent, err := openshift.DecryptedParams(
 		encryptedContent,
 		secretsOptions.PrivateKey,
@@ -58,35 +84,116 @@ func Reveal(secretsOptions *cli.SecretsOptions, filename string) error {
 	return nil
 }
 
+func revealRecipients(secretsOptions *cli.SecretsOptions, filename, encryptedContent string) error {
+	policy, err := openshift.ReadRecipientsPolicy(secretsOptions.RecipientsPolicy)
+	if err != nil {
+		return fmt.Errorf("Could not read recipients policy: %s", err)
+	}
+	recipients, err := openshift.DescribeRecipients(
+		encryptedContent,
+		filename,
+		secretsOptions.PublicKeyDir,
+		policy,
+	)
+	if err != nil {
+		return fmt.Errorf("Could not read recipients: %s", err)
+	}
+	fmt.Print(recipients)
+	return nil
+}
+
 // ReEncrypt decrypts given file(s) and encrypts all params again.
-// This allows to share the secrets with a new keypair.
+// This allows to share the secrets with a new keypair, to move the
+// secrets to another encryption backend, or to apply a changed
+// recipients policy.
 func ReEncrypt(secretsOptions *cli.SecretsOptions, filename string) error {
-	if len(filename) > 0 {
-		err := reEncrypt(filename, secretsOptions.PrivateKey, secretsOptions.Passphrase, secretsOptions.PublicKeyDir)
+	files, err := encryptedFiles(secretsOptions, filename)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		err := reEncrypt(f, secretsOptions)
 		if err != nil {
 			return err
 		}
-	} else {
-		paramDir := secretsOptions.ParamDir
-		files, err := ioutil.ReadDir(paramDir)
+	}
+	return nil
+}
+
+// Verify checks whether the values of given file(s) are encrypted for the
+// expected recipients, without decrypting them. Problems are printed per
+// file, and an error is returned if any problem was found.
+func Verify(secretsOptions *cli.SecretsOptions, filename string) error {
+	files, err := encryptedFiles(secretsOptions, filename)
+	if err != nil {
+		return err
+	}
+	policy, err := openshift.ReadRecipientsPolicy(secretsOptions.RecipientsPolicy)
+	if err != nil {
+		return fmt.Errorf("Could not read recipients policy: %s", err)
+	}
+	problemCount := 0
+	for _, f := range files {
+		encryptedContent, err := utils.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("Could not read file: %s", err)
+		}
+		problems, err := openshift.AuditRecipients(
+			encryptedContent,
+			f,
+			secretsOptions.PublicKeyDir,
+			policy,
+		)
+		if err != nil {
+			return fmt.Errorf("Could not verify %s: %s", f, err)
+		}
+		if len(problems) == 0 {
+			fmt.Printf("%s: ", f)
+			cli.PrintGreenf("OK\n")
+			continue
+		}
+		problemCount += len(problems)
+		fmt.Printf("%s:\n", f)
+		for _, p := range problems {
+			cli.PrintRedf("* %s\n", p)
+		}
+	}
+	if problemCount > 0 {
+		return fmt.Errorf("Found %d problem(s), run 'tailor secrets re-encrypt' to fix them", problemCount)
+	}
+	return nil
+}
+
+// encryptedFiles returns given file, or all encrypted param files in the
+// param dir (including subdirectories, except hidden ones) if no file is
+// given.
+func encryptedFiles(secretsOptions *cli.SecretsOptions, filename string) ([]string, error) {
+	if len(filename) > 0 {
+		return []string{filename}, nil
+	}
+	paramDir := secretsOptions.ParamDir
+	filePattern := ".*\\.env.enc$"
+	re := regexp.MustCompile(filePattern)
+	encrypted := []string{}
+	err := filepath.Walk(paramDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		filePattern := ".*\\.env.enc$"
-		re := regexp.MustCompile(filePattern)
-		for _, file := range files {
-			matched := re.MatchString(file.Name())
-			if !matched {
-				continue
-			}
-			filename := paramDir + string(os.PathSeparator) + file.Name()
-			err := reEncrypt(filename, secretsOptions.PrivateKey, secretsOptions.Passphrase, secretsOptions.PublicKeyDir)
-			if err != nil {
-				return err
+		if info.IsDir() {
+			if path != paramDir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
 			}
+			return nil
 		}
+		if re.MatchString(info.Name()) {
+			encrypted = append(encrypted, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return encrypted, nil
 }
 
 // Edit opens given filen in cleartext in $EDITOR, then encrypts the content on save.
@@ -100,7 +207,7 @@ func Edit(secretsOptions *cli.SecretsOptions, filename string) error {
 		}
 	}
 
-	cleartextContent, err := openshift.DecryptedParams(
+	cleartextContent, undecryptable, err := openshift.EditableParams(
 		encryptedContent,
 		secretsOptions.PrivateKey,
 		secretsOptions.Passphrase,
@@ -108,6 +215,12 @@ func Edit(secretsOptions *cli.SecretsOptions, filename string) error {
 	if err != nil {
 		return fmt.Errorf("Could not decrypt file: %s", err)
 	}
+	if len(undecryptable) > 0 {
+		cli.PrintYellowf(
+			"Cannot decrypt %s, leave the encrypted value(s) unchanged to keep them.\n",
+			strings.Join(undecryptable, ", "),
+		)
+	}
 
 	editedContent, err := cli.EditEnvFile(cleartextContent)
 	if err != nil {
@@ -118,9 +231,7 @@ func Edit(secretsOptions *cli.SecretsOptions, filename string) error {
 		filename,
 		editedContent,
 		encryptedContent,
-		secretsOptions.PrivateKey,
-		secretsOptions.Passphrase,
-		secretsOptions.PublicKeyDir,
+		secretsOptions,
 	)
 	if err != nil {
 		return fmt.Errorf("Could not write file: %s", err)
@@ -128,38 +239,64 @@ func Edit(secretsOptions *cli.SecretsOptions, filename string) error {
 	return nil
 }
 
-func reEncrypt(filename, privateKey, passphrase, publicKeyDir string) error {
+func reEncrypt(filename string, secretsOptions *cli.SecretsOptions) error {
 	encryptedContent, err := utils.ReadFile(filename)
 	if err != nil {
 		return fmt.Errorf("Could not read file: %s", err)
 	}
 
-	cleartextContent, err := openshift.DecryptedParams(
+	cleartextContent, undecryptable, err := openshift.EditableParams(
 		encryptedContent,
-		privateKey,
-		passphrase,
+		secretsOptions.PrivateKey,
+		secretsOptions.Passphrase,
 	)
 	if err != nil {
 		return fmt.Errorf("Could not decrypt file: %s", err)
 	}
+	if len(undecryptable) > 0 {
+		cli.PrintYellowf(
+			"Cannot decrypt %s in %s, keeping the encrypted value(s).\n",
+			strings.Join(undecryptable, ", "),
+			filename,
+		)
+	}
 
+	// Only values which cannot be decrypted are kept, all others are
+	// re-encrypted.
 	return writeEncryptedContent(
 		filename,
 		cleartextContent,
-		"", // empty because all values should be re-encrypted
-		privateKey,
-		passphrase,
-		publicKeyDir,
+		undecryptableContent(encryptedContent, undecryptable),
+		secretsOptions,
 	)
 }
 
-func writeEncryptedContent(filename, newContent, previousContent, privateKey, passphrase, publicKeyDir string) error {
+// undecryptableContent returns the lines of content with given keys.
+func undecryptableContent(content string, keys []string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(content, "\n") {
+		pair := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(pair) == 2 && utils.Includes(keys, pair[0]) {
+			sb.WriteString(line + "\n")
+		}
+	}
+	return sb.String()
+}
+
+func writeEncryptedContent(filename, newContent, previousContent string, secretsOptions *cli.SecretsOptions) error {
+	policy, err := openshift.ReadRecipientsPolicy(secretsOptions.RecipientsPolicy)
+	if err != nil {
+		return fmt.Errorf("Could not read recipients policy: %s", err)
+	}
 	updatedContent, err := openshift.EncryptedParams(
 		newContent,
 		previousContent,
-		publicKeyDir,
-		privateKey,
-		passphrase,
+		filename,
+		secretsOptions.PublicKeyDir,
+		secretsOptions.PrivateKey,
+		secretsOptions.Passphrase,
+		secretsOptions.Encryption,
+		policy,
 	)
 	if err != nil {
 		return fmt.Errorf("Could not encrypt content: %s", err)
@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/tailor/pkg/cli"
+	"github.com/opendevstack/tailor/pkg/openshift"
+	"github.com/opendevstack/tailor/pkg/utils"
+)
+
+func TestEncryptedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailor-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"foo.env.enc", "foo.env", "prod/bar.env.enc", "prod/db/baz.env.enc", ".git/qux.env.enc"} {
+		path := filepath.Join(dir, f)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte{}, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := encryptedFiles(&cli.SecretsOptions{ParamDir: dir}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.Join(dir, "foo.env.enc"),
+		filepath.Join(dir, "prod", "bar.env.enc"),
+		filepath.Join(dir, "prod", "db", "baz.env.enc"),
+	}
+	if diff := cmp.Diff(expected, files); diff != "" {
+		t.Fatalf("Files mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestReEncryptKeepsUndecryptableValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailor-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	privateKeys := map[string]string{}
+	for _, name := range []string{"alice", "bob"} {
+		identity, err := utils.GenerateAgeIdentity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		privateKeys[name] = filepath.Join(dir, name+"-private.key")
+		err = utils.PrintAgeKeys(identity, name, filepath.Join(dir, name+".key"), privateKeys[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	policyFile := filepath.Join(dir, "recipients.yml")
+	err = ioutil.WriteFile(policyFile, []byte(`rules:
+- files: "*.env.enc"
+  recipients: [alice, bob]
+  keys:
+  - name: PASSWORD
+    recipients: [alice]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := openshift.ReadRecipientsPolicy(policyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "app.env.enc")
+	cleartext := "PASSWORD=secret\nTOKEN=token\n"
+	encrypted, err := openshift.EncryptedParams(cleartext, "", filename, dir, "", "", "age", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filename, []byte(encrypted), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secretsOptions := &cli.SecretsOptions{
+		GlobalOptions: &cli.GlobalOptions{RecipientsPolicy: policyFile},
+		PublicKeyDir:  dir,
+		PrivateKey:    privateKeys["bob"],
+		Encryption:    "age",
+	}
+	err = reEncrypt(filename, secretsOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(b), "\n")
+	if lines[0] != strings.Split(encrypted, "\n")[0] {
+		t.Fatalf("Expected PASSWORD to be kept, got: %s", lines[0])
+	}
+	if lines[1] == strings.Split(encrypted, "\n")[1] {
+		t.Fatalf("Expected TOKEN to be re-encrypted, got: %s", lines[1])
+	}
+	revealed, err := openshift.DecryptedParams(string(b), privateKeys["alice"], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revealed != cleartext {
+		t.Fatalf("Mismatch, got: %v, want: %v.", revealed, cleartext)
+	}
+
+	// Once the recipients of PASSWORD change, bob cannot re-encrypt it.
+	err = ioutil.WriteFile(policyFile, []byte("rules:\n- files: \"*.env.enc\"\n  recipients: [alice, bob]\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reEncrypt(filename, secretsOptions)
+	if err == nil || !strings.Contains(err.Error(), "PASSWORD cannot be kept") {
+		t.Fatalf("Expected error for changed recipients, got: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/opendevstack/tailor/pkg/cli"
+	"github.com/opendevstack/tailor/pkg/openshift"
+)
+
+// Snapshot records the current state of targeted resources in given file,
+// which can be passed to "diff --current-state-file" instead of the cluster.
+func Snapshot(exportOptions *cli.ExportOptions, filename string) error {
+	c, err := cli.NewClient(exportOptions.Namespace)
+	if err != nil {
+		return err
+	}
+	filter, err := newResourceFilter(
+		exportOptions.Resource,
+		exportOptions.Selector,
+		exportOptions.Exclude,
+		exportOptions.Kinds,
+		c,
+	)
+	if err != nil {
+		return err
+	}
+
+	// The export is kept as-is (including annotations such as the last
+	// applied configuration), so that the diff is the same as against the
+	// cluster.
+	out, err := c.Export(filter.ConvertToKinds(), filter.Label)
+	if err != nil {
+		return fmt.Errorf("Could not export %s resources: %s", filter.String(), err)
+	}
+	list, err := openshift.NewPlatformBasedResourceList(filter, out)
+	if err != nil {
+		return fmt.Errorf("Could not parse exported resources: %s", err)
+	}
+
+	// The snapshot contains secrets in clear text.
+	err = ioutil.WriteFile(filename, out, 0600)
+	if err != nil {
+		return fmt.Errorf("Could not write snapshot: %s", err)
+	}
+	fmt.Printf(
+		"Recorded %d resource(s) of OCP namespace %s in %s. Compare with 'tailor diff --current-state-file %s'.\n",
+		list.Length(),
+		exportOptions.Namespace,
+		filename,
+		filename,
+	)
+	return nil
+}
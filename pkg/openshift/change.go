@@ -1,6 +1,14 @@
 package openshift
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
 	"github.com/pmezard/go-difflib/difflib"
 )
 
@@ -19,8 +27,15 @@ var (
 		"ServiceAccount":        "serviceaccount",
 		"CronJob":               "cronjob",
 	}
+
+	// secretHashSalt is generated per run, so that the hashes of secret
+	// values can be compared within one diff, but not across runs or
+	// against guessed values.
+	secretHashSalt = newSecretHashSalt()
 )
 
+const lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
 // Change is a description of a drift between current and desired state, and
 // the required patches to bring them back in sync.
 type Change struct {
@@ -29,6 +44,31 @@ type Change struct {
 	Name         string
 	CurrentState string
 	DesiredState string
+	// ChangedPaths are the JSON pointer paths which differ between current
+	// and desired state. It is only populated for updates.
+	ChangedPaths []string
+	// Fields describe the drift per field. Besides the paths which differ,
+	// it contains preserved fields, and for re-creations the immutable field
+	// which caused it.
+	Fields []*FieldChange
+	// After lists the changes (as kind/name) which need to be applied before
+	// this one because of references between the resources.
+	After []string
+	// Fingerprint identifies the current state of the resource (see
+	// ResourceItem.Fingerprint). It is empty if the resource does not exist.
+	Fingerprint string
+	// Overlays are the files of the overlays applied to the desired state.
+	Overlays []string
+}
+
+// FieldChange describes the drift of a single field, identified by its JSON
+// pointer path. Reason is one of "added", "removed", "changed", "immutable"
+// or "preserved".
+type FieldChange struct {
+	Path    string      `json:"path"`
+	Current interface{} `json:"current,omitempty"`
+	Desired interface{} `json:"desired,omitempty"`
+	Reason  string      `json:"reason"`
 }
 
 // NewChange creates a new change for given template/platform item.
@@ -54,33 +94,202 @@ func (c *Change) ItemName() string {
 	return kindToShortMapping[c.Kind] + "/" + c.Name
 }
 
-// Diff returns a unified diff text for the change.
+// Diff returns a unified diff text for the change. Unless revealSecrets is
+// true, the values of Secret data are replaced by a short salted hash, so that
+// added, removed and changed keys are visible without their values.
 func (c *Change) Diff(revealSecrets bool) string {
+	currentState := c.CurrentState
+	desiredState := c.DesiredState
 	if c.isSecret() && !revealSecrets {
-		return "Secret drift is hidden. Use --reveal-secrets to see details.\n"
+		var err error
+		currentState, err = redactSecretState(currentState)
+		if err == nil {
+			desiredState, err = redactSecretState(desiredState)
+		}
+		if err != nil {
+			return "Secret drift is hidden. Use --reveal-secrets to see details.\n"
+		}
 	}
 	diff := difflib.UnifiedDiff{
-		A:        difflib.SplitLines(c.CurrentState),
-		B:        difflib.SplitLines(c.DesiredState),
+		A:        difflib.SplitLines(currentState),
+		B:        difflib.SplitLines(desiredState),
 		FromFile: "Current State (OpenShift cluster)",
 		ToFile:   "Desired State (Processed template)",
 		Context:  3,
 	}
 	text, _ := difflib.GetUnifiedDiffString(diff)
+	if c.isSecret() && !revealSecrets && len(text) > 0 {
+		text += "Secret values are redacted. Use --reveal-secrets to see details.\n"
+	}
 	return text
 }
 
+// FieldsDiff returns a description of the drift per field.
+func (c *Change) FieldsDiff(revealSecrets bool) string {
+	redact := c.isSecret() && !revealSecrets
+	redacted := false
+	var sb strings.Builder
+	for _, f := range c.Fields {
+		currentValue, desiredValue := f.Current, f.Desired
+		if redact && isSecretFieldPath(f.Path) {
+			currentValue = redactSecretField(f.Path, currentValue)
+			desiredValue = redactSecretField(f.Path, desiredValue)
+			redacted = true
+		}
+		current := fieldValue(currentValue)
+		desired := fieldValue(desiredValue)
+		switch f.Reason {
+		case "added":
+			fmt.Fprintf(&sb, "  + %s: %s\n", f.Path, desired)
+		case "removed":
+			fmt.Fprintf(&sb, "  - %s: %s\n", f.Path, current)
+		case "changed":
+			fmt.Fprintf(&sb, "  ~ %s: %s => %s\n", f.Path, current, desired)
+		default:
+			fmt.Fprintf(&sb, "  ! %s: %s => %s (%s)\n", f.Path, current, desired, f.Reason)
+		}
+	}
+	if redacted {
+		sb.WriteString("  Secret values are redacted. Use --reveal-secrets to see details.\n")
+	}
+	return sb.String()
+}
+
+// fieldValue renders the value of a field in a compact, single-line form.
+func fieldValue(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	var sb strings.Builder
+	enc := json.NewEncoder(&sb)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// isSecretFieldPath returns true if the field at path of a Secret might
+// contain secret data.
+func isSecretFieldPath(path string) bool {
+	for _, p := range []string{"/data", "/stringData", "/metadata/annotations", "/metadata", ""} {
+		if path == p {
+			return true
+		}
+	}
+	return strings.HasPrefix(path, "/data/") ||
+		strings.HasPrefix(path, "/stringData/") ||
+		path == "/metadata/annotations/"+strings.Replace(lastAppliedConfigAnnotation, "/", "~1", -1)
+}
+
+// redactSecretField redacts the secret data within the value of the field at
+// path (see isSecretFieldPath).
+func redactSecretField(path string, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch path {
+	case "", "/metadata", "/metadata/annotations":
+		// Redact within a copy of the containing object
+		b, err := json.Marshal(v)
+		if err != nil {
+			return redactedSecretValue(v)
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			return redactedSecretValue(v)
+		}
+		switch path {
+		case "":
+			redactSecretData(m)
+		case "/metadata":
+			redactSecretData(map[string]interface{}{"metadata": m})
+		default:
+			redactSecretData(map[string]interface{}{"metadata": map[string]interface{}{"annotations": m}})
+		}
+		return m
+	case "/data", "/stringData":
+		if m, ok := v.(map[string]interface{}); ok {
+			redacted := map[string]interface{}{}
+			for k, val := range m {
+				redacted[k] = redactedSecretValue(val)
+			}
+			return redacted
+		}
+	}
+	return redactedSecretValue(v)
+}
+
+// redactSecretState replaces the secret data in the YAML state of a Secret.
+func redactSecretState(state string) (string, error) {
+	if len(state) == 0 {
+		return state, nil
+	}
+	var m map[string]interface{}
+	err := yaml.Unmarshal([]byte(state), &m)
+	if err != nil {
+		return "", err
+	}
+	redactSecretData(m)
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// redactSecretData replaces the values of data and stringData, and the last
+// applied configuration (which contains the data as well) of a Secret config
+// by their salted hash.
+func redactSecretData(m map[string]interface{}) {
+	for _, field := range []string{"data", "stringData"} {
+		if data, ok := m[field].(map[string]interface{}); ok {
+			for k, v := range data {
+				data[k] = redactedSecretValue(v)
+			}
+		}
+	}
+	if metadata, ok := m["metadata"].(map[string]interface{}); ok {
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			if v, ok := annotations[lastAppliedConfigAnnotation]; ok {
+				annotations[lastAppliedConfigAnnotation] = redactedSecretValue(v)
+			}
+		}
+	}
+}
+
+// redactedSecretValue replaces a secret value by a short hash, salted per
+// run. Equal values have equal hashes within one run.
+func redactedSecretValue(v interface{}) string {
+	h := hmac.New(sha256.New, secretHashSalt)
+	fmt.Fprintf(h, "%v", v)
+	return fmt.Sprintf("<redacted %x>", h.Sum(nil)[:4])
+}
+
+func newSecretHashSalt() []byte {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		panic(fmt.Sprintf("Could not generate salt: %s", err))
+	}
+	return salt
+}
+
 func (c *Change) isSecret() bool {
 	return kindToShortMapping[c.Kind] == "secret"
 }
 
-func recreateChanges(templateItem, platformItem *ResourceItem) []*Change {
+// recreateChanges returns the changes to delete and create the resource again,
+// caused by the change of the given immutable field.
+func recreateChanges(templateItem, platformItem *ResourceItem, immutableField *FieldChange) []*Change {
 	deleteChange := &Change{
 		Action:       "Delete",
 		Kind:         templateItem.Kind,
 		Name:         templateItem.Name,
 		CurrentState: platformItem.YamlConfig(),
 		DesiredState: "",
+		Fields:       []*FieldChange{immutableField},
 	}
 	createChange := &Change{
 		Action:       "Create",
@@ -88,6 +297,7 @@ func recreateChanges(templateItem, platformItem *ResourceItem) []*Change {
 		Name:         templateItem.Name,
 		CurrentState: "",
 		DesiredState: templateItem.YamlConfig(),
+		Fields:       []*FieldChange{immutableField},
 	}
 	return []*Change{deleteChange, createChange}
 }
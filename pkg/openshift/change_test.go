@@ -2,7 +2,10 @@ package openshift
 
 import (
 	"bytes"
+	"strings"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestDiff(t *testing.T) {
@@ -169,6 +172,69 @@ func TestDiff(t *testing.T) {
 	}
 }
 
+func TestFieldsDiff(t *testing.T) {
+	tests := map[string]struct {
+		currentData   []byte
+		desiredData   []byte
+		preservePaths []string
+		expectedDiff  string
+	}{
+		"Adding, removing and changing data fields": {
+			currentData: []byte("{foo: bar, baz: qux}"),
+			desiredData: []byte("{foo: baz, new: [a, b]}"),
+			expectedDiff: `  - /data/baz: "qux"
+  ~ /data/foo: "bar" => "baz"
+  + /data/new: ["a","b"]
+`,
+		},
+		"Preserving a data field": {
+			currentData:   []byte("{foo: bar, baz: qux}"),
+			desiredData:   []byte("{foo: baz, baz: zab}"),
+			preservePaths: []string{"/data/baz"},
+			expectedDiff: `  ! /data/baz: "qux" => "zab" (preserved)
+  ~ /data/foo: "bar" => "baz"
+`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			currentItem := getItem(t, getConfigMapForDiff([]byte("{}"), tt.currentData), "platform")
+			desiredItem := getItem(t, getConfigMapForDiff([]byte("{}"), tt.desiredData), "template")
+			changes, err := calculateChanges(desiredItem, currentItem, tt.preservePaths, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actualDiff := changes[0].FieldsDiff(true)
+			if actualDiff != tt.expectedDiff {
+				t.Fatalf(
+					"FieldsDiff()\n===== expected =====\n%s\n===== actual =====\n%s",
+					tt.expectedDiff,
+					actualDiff,
+				)
+			}
+		})
+	}
+}
+
+func TestFieldsDiffImmutable(t *testing.T) {
+	platformItem := getItem(t, getRoute([]byte("old.com")), "platform")
+	templateItem := getItem(t, getRoute([]byte("new.com")), "template")
+	changes, err := calculateChanges(templateItem, platformItem, []string{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("Expected re-creation, got %d change(s)", len(changes))
+	}
+	expectedDiff := "  ! /spec/host: \"old.com\" => \"new.com\" (immutable)\n"
+	for _, c := range changes {
+		if actualDiff := c.FieldsDiff(true); actualDiff != expectedDiff {
+			t.Fatalf("Expected diff for %s change:\n%s\ngot:\n%s", c.Action, expectedDiff, actualDiff)
+		}
+	}
+}
+
 func getConfigMapForDiff(annotations, data []byte) []byte {
 	config := []byte(
 		`apiVersion: v1
@@ -182,3 +248,64 @@ data: DATA`)
 	config = bytes.Replace(config, []byte("ANNOTATIONS"), annotations, -1)
 	return bytes.Replace(config, []byte("DATA"), data, -1)
 }
+
+func TestSecretDiffRedacted(t *testing.T) {
+	getSecret := func(label, data string) []byte {
+		return []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  labels:
+    app: ` + label + `
+  name: bar
+type: Opaque
+data: ` + data)
+	}
+	currentItem := getItem(t, getSecret("foo", "{a: YQ==, b: Yg==, c: Yw==}"), "platform")
+	desiredItem := getItem(t, getSecret("bar", "{a: YQ==, b: YmI=, d: ZA==}"), "template")
+	changes, err := calculateChanges(desiredItem, currentItem, []string{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := changes[0]
+
+	hash := func(v string) string {
+		return redactedSecretValue(v)
+	}
+	expectedDiff := `--- Current State (OpenShift cluster)
++++ Desired State (Processed template)
+@@ -1,12 +1,12 @@
+ apiVersion: v1
+ data:
+   a: ` + hash("YQ==") + `
+-  b: ` + hash("Yg==") + `
+-  c: ` + hash("Yw==") + `
++  b: ` + hash("YmI=") + `
++  d: ` + hash("ZA==") + `
+ kind: Secret
+ metadata:
+   labels:
+-    app: foo
++    app: bar
+   name: bar
+ type: Opaque
+ 
+Secret values are redacted. Use --reveal-secrets to see details.
+`
+	if diff := cmp.Diff(expectedDiff, c.Diff(false)); diff != "" {
+		t.Fatalf("Diff mismatch (-want +got):\n%s", diff)
+	}
+
+	expectedFieldsDiff := `  ~ /data/b: "` + hash("Yg==") + `" => "` + hash("YmI=") + `"
+  - /data/c: "` + hash("Yw==") + `"
+  + /data/d: "` + hash("ZA==") + `"
+  ~ /metadata/labels/app: "foo" => "bar"
+  Secret values are redacted. Use --reveal-secrets to see details.
+`
+	if diff := cmp.Diff(expectedFieldsDiff, c.FieldsDiff(false)); diff != "" {
+		t.Fatalf("FieldsDiff mismatch (-want +got):\n%s", diff)
+	}
+
+	if strings.Contains(c.Diff(false), "YmI=") || !strings.Contains(c.Diff(true), "YmI=") {
+		t.Fatal("Expected values to be revealed only with revealSecrets")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/opendevstack/tailor/pkg/cli"
 	"github.com/opendevstack/tailor/pkg/utils"
 	"github.com/xeipuuv/gojsonpointer"
 )
@@ -32,6 +33,8 @@ type Changeset struct {
 	Update []*Change
 	Delete []*Change
 	Noop   []*Change
+	// order is the order in which the changes are applied, see Ordered.
+	order []*Change
 }
 
 func NewChangeset(platformBasedList, templateBasedList *ResourceList, upsertOnly bool, allowRecreate bool, preservePaths []string) (*Changeset, error) {
@@ -52,6 +55,7 @@ func NewChangeset(platformBasedList, templateBasedList *ResourceList, upsertOnly
 					Name:         item.Name,
 					CurrentState: item.YamlConfig(),
 					DesiredState: "",
+					Fingerprint:  item.Fingerprint(),
 				}
 				changeset.Add(change)
 			}
@@ -71,6 +75,7 @@ func NewChangeset(platformBasedList, templateBasedList *ResourceList, upsertOnly
 				Name:         item.Name,
 				CurrentState: "",
 				DesiredState: desiredState,
+				Overlays:     item.Overlays,
 			}
 			changeset.Add(change)
 		}
@@ -108,18 +113,29 @@ func NewChangeset(platformBasedList, templateBasedList *ResourceList, upsertOnly
 				}
 			}
 
+			fingerprint := platformItem.Fingerprint()
 			changes, err := calculateChanges(templateItem, platformItem, actualReservePaths, allowRecreate)
 			if err != nil {
 				return changeset, err
 			}
+			for _, c := range changes {
+				if c.Action != "Create" {
+					c.Fingerprint = fingerprint
+				}
+				if c.Action != "Delete" {
+					c.Overlays = templateItem.Overlays
+				}
+			}
 			changeset.Add(changes...)
 		}
 	}
 
-	return changeset, nil
+	err := changeset.OrderByReferences()
+	return changeset, err
 }
 
 func calculateChanges(templateItem *ResourceItem, platformItem *ResourceItem, preservePaths []string, allowRecreate bool) ([]*Change, error) {
+	preservedFields := templateItem.preservedFields(platformItem, preservePaths)
 	err := templateItem.prepareForComparisonWithPlatformItem(platformItem, preservePaths)
 	if err != nil {
 		return nil, err
@@ -131,6 +147,7 @@ func calculateChanges(templateItem *ResourceItem, platformItem *ResourceItem, pr
 
 	comparedPaths := map[string]bool{}
 	addedPaths := []string{}
+	fields := []*FieldChange{}
 
 	for _, path := range templateItem.Paths {
 
@@ -151,9 +168,14 @@ func calculateChanges(templateItem *ResourceItem, platformItem *ResourceItem, pr
 
 		if err != nil {
 			// Pointer does not exist in platformItem
-			if templateItem.isImmutableField(path) {
+			if rule := templateItem.immutableFieldRule(path); rule != nil {
+				cli.DebugMsg("Path", path, "of", templateItem.FullName(), "is immutable by rule", rule.String())
 				if allowRecreate {
-					return recreateChanges(templateItem, platformItem), nil
+					return recreateChanges(templateItem, platformItem, &FieldChange{
+						Path:    path,
+						Desired: templateItemVal,
+						Reason:  "immutable",
+					}), nil
 				} else {
 					return nil, fmt.Errorf("Path %s is immutable. Changing its value requires to delete and re-create the whole resource, which is only done when --allow-recreate is present", path)
 				}
@@ -172,6 +194,11 @@ func calculateChanges(templateItem *ResourceItem, platformItem *ResourceItem, pr
 				}
 			} else {
 				addedPaths = append(addedPaths, path)
+				fields = append(fields, &FieldChange{
+					Path:    path,
+					Desired: templateItemVal,
+					Reason:  "added",
+				})
 			}
 		} else {
 			// Pointer exists in both items
@@ -189,14 +216,26 @@ func calculateChanges(templateItem *ResourceItem, platformItem *ResourceItem, pr
 				if templateItemVal == platformItemVal {
 					comparedPaths[path] = true
 				} else {
-					if templateItem.isImmutableField(path) {
+					if rule := templateItem.immutableFieldRule(path); rule != nil {
+						cli.DebugMsg("Path", path, "of", templateItem.FullName(), "is immutable by rule", rule.String())
 						if allowRecreate {
-							return recreateChanges(templateItem, platformItem), nil
+							return recreateChanges(templateItem, platformItem, &FieldChange{
+								Path:    path,
+								Current: platformItemVal,
+								Desired: templateItemVal,
+								Reason:  "immutable",
+							}), nil
 						} else {
 							return nil, fmt.Errorf("Path %s is immutable. Changing its value requires to delete and re-create the whole resource, which is only done when --allow-recreate is present", path)
 						}
 					}
 					comparedPaths[path] = true
+					fields = append(fields, &FieldChange{
+						Path:    path,
+						Current: platformItemVal,
+						Desired: templateItemVal,
+						Reason:  "changed",
+					})
 				}
 			}
 		}
@@ -267,10 +306,28 @@ func calculateChanges(templateItem *ResourceItem, platformItem *ResourceItem, pr
 			// Pointer exist only in platformItem
 			comparedPaths[path] = true
 			deletedPaths = append(deletedPaths, path)
+			fields = append(fields, &FieldChange{
+				Path:    path,
+				Current: val,
+				Reason:  "removed",
+			})
 		}
 	}
 
 	c := NewChange(templateItem, platformItem)
+	if c.Action == "Update" {
+		changedPaths := []string{}
+		for _, f := range fields {
+			changedPaths = append(changedPaths, f.Path)
+		}
+		sort.Strings(changedPaths)
+		c.ChangedPaths = changedPaths
+		c.Fields = fields
+	}
+	c.Fields = append(c.Fields, preservedFields...)
+	sort.SliceStable(c.Fields, func(i, j int) bool {
+		return c.Fields[i].Path < c.Fields[j].Path
+	})
 
 	return []*Change{c}, nil
 }
@@ -279,23 +336,32 @@ func (c *Changeset) Blank() bool {
 	return len(c.Create) == 0 && len(c.Update) == 0 && len(c.Delete) == 0
 }
 
+// kindRank returns the position of given kind in the order of application.
+// Kinds without a predefined order (e.g. discovered ones) go last.
+func kindRank(kind string) string {
+	if rank, ok := kindOrder[kind]; ok {
+		return rank
+	}
+	return "z" + kind
+}
+
 func (c *Changeset) Add(changes ...*Change) {
 	for _, change := range changes {
 		switch change.Action {
 		case "Create":
 			c.Create = append(c.Create, change)
 			sort.Slice(c.Create, func(i, j int) bool {
-				return kindOrder[c.Create[i].Kind] < kindOrder[c.Create[j].Kind]
+				return kindRank(c.Create[i].Kind) < kindRank(c.Create[j].Kind)
 			})
 		case "Update":
 			c.Update = append(c.Update, change)
 			sort.Slice(c.Update, func(i, j int) bool {
-				return kindOrder[c.Update[i].Kind] < kindOrder[c.Update[j].Kind]
+				return kindRank(c.Update[i].Kind) < kindRank(c.Update[j].Kind)
 			})
 		case "Delete":
 			c.Delete = append(c.Delete, change)
 			sort.Slice(c.Delete, func(i, j int) bool {
-				return kindOrder[c.Delete[i].Kind] > kindOrder[c.Delete[j].Kind]
+				return kindRank(c.Delete[i].Kind) > kindRank(c.Delete[j].Kind)
 			})
 		case "Noop":
 			c.Noop = append(c.Noop, change)
@@ -46,6 +46,7 @@ func TestNewChangesetCreationOfResources(t *testing.T) {
 			}
 			templateBasedList, err := NewTemplateBasedResourceList(
 				filter,
+				nil,
 				helper.ReadFixtureFile(t, "templates/"+tc.templateFixture),
 			)
 			if err != nil {
@@ -640,7 +641,7 @@ func getChangeset(t *testing.T, filter *ResourceFilter, platformInput, templateI
 	if err != nil {
 		t.Error("Could not create platform based list:", err)
 	}
-	templateBasedList, err := NewTemplateBasedResourceList(filter, templateInput)
+	templateBasedList, err := NewTemplateBasedResourceList(filter, nil, templateInput)
 	if err != nil {
 		t.Error("Could not create template based list:", err)
 	}
@@ -0,0 +1,202 @@
+package openshift
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/opendevstack/tailor/pkg/cli"
+	"github.com/opendevstack/tailor/pkg/utils"
+)
+
+var (
+	// defaultPlatformManagedFields are removed from all items before they are
+	// compared, as they are set by the platform.
+	defaultPlatformManagedFields = []string{
+		"/metadata/generation",
+		"/metadata/creationTimestamp",
+		"/spec/tags",
+		"/status",
+		"/spec/volumeName",
+		"/spec/template/metadata/creationTimestamp",
+		"/groupNames",
+		"/userNames",
+		"^/spec/triggers/[0-9]*/imageChangeParams/lastTriggeredImage",
+	}
+	// defaultImmutableFields cannot be changed once the item exists.
+	defaultImmutableFields = []string{
+		"pvc:/spec/accessModes",
+		"pvc:/spec/storageClassName",
+		"pvc:/spec/resources/requests/storage",
+		"route:/spec/host",
+		"secret:/type",
+	}
+
+	fieldRules = DefaultFieldRules()
+)
+
+// FieldRule declares a field as platform-managed (removed before comparison)
+// or immutable (changing it requires to re-create the item). Like preserved
+// paths, a rule applies globally (e.g. /spec/foo), per kind (e.g.
+// bc:/spec/foo) or per resource (e.g. bc:bar:/spec/foo). The path of a
+// platform-managed field may also be a regular expression starting with ^,
+// which is matched against all paths of the item.
+type FieldRule struct {
+	Kind   string
+	Name   string
+	Path   string
+	Source string
+	exp    *regexp.Regexp
+}
+
+// FieldRules are the catalogs of platform-managed and immutable fields.
+type FieldRules struct {
+	PlatformManaged []*FieldRule
+	Immutable       []*FieldRule
+}
+
+// fieldRulesFile is the format of a rules file, e.g.:
+//
+//	platform-managed:
+//	- dc:/spec/template/spec/containers/0/terminationMessagePath
+//	immutable:
+//	- svc:/spec/clusterIP
+type fieldRulesFile struct {
+	PlatformManaged []string `json:"platform-managed"`
+	Immutable       []string `json:"immutable"`
+}
+
+// NewFieldRule parses rule s (see FieldRule), declared in source.
+func NewFieldRule(s string, source string) (*FieldRule, error) {
+	scope := []string{}
+	path := s
+	for !strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "^") {
+		i := strings.Index(path, ":")
+		if i < 1 || len(scope) == 2 {
+			return nil, fmt.Errorf("%s is not a valid field rule", s)
+		}
+		scope = append(scope, path[:i])
+		path = path[i+1:]
+	}
+	r := &FieldRule{Path: path, Source: source}
+	if len(scope) > 0 {
+		r.Kind = scope[0]
+	}
+	if len(scope) > 1 {
+		r.Name = scope[1]
+	}
+	if strings.HasPrefix(path, "^") {
+		exp, err := regexp.Compile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid field rule: %s", s, err)
+		}
+		r.exp = exp
+	}
+	return r, nil
+}
+
+// DefaultFieldRules returns the built-in rules.
+func DefaultFieldRules() *FieldRules {
+	rules := &FieldRules{}
+	for _, s := range defaultPlatformManagedFields {
+		r, _ := NewFieldRule(s, "built-in")
+		rules.PlatformManaged = append(rules.PlatformManaged, r)
+	}
+	for _, s := range defaultImmutableFields {
+		r, _ := NewFieldRule(s, "built-in")
+		rules.Immutable = append(rules.Immutable, r)
+	}
+	return rules
+}
+
+// ConfigureFieldRules extends the built-in rules with the rules given as
+// options and the ones in the rules file (if any). The resulting rules are
+// used for all items read afterwards.
+func ConfigureFieldRules(globalOptions *cli.GlobalOptions) error {
+	rules := DefaultFieldRules()
+	err := rules.add(globalOptions.PlatformManagedFields, globalOptions.ImmutableFields, "options")
+	if err != nil {
+		return err
+	}
+	if len(globalOptions.FieldRulesFile) > 0 {
+		b, err := ioutil.ReadFile(globalOptions.FieldRulesFile)
+		if err != nil {
+			return err
+		}
+		f := &fieldRulesFile{}
+		err = yaml.Unmarshal(b, f)
+		if err != nil {
+			return fmt.Errorf("Could not read %s: %s", globalOptions.FieldRulesFile, utils.DisplaySyntaxError(b, err))
+		}
+		err = rules.add(f.PlatformManaged, f.Immutable, globalOptions.FieldRulesFile)
+		if err != nil {
+			return err
+		}
+	}
+	for _, r := range rules.PlatformManaged {
+		cli.DebugMsg("Platform-managed field rule", r.String())
+	}
+	for _, r := range rules.Immutable {
+		cli.DebugMsg("Immutable field rule", r.String())
+	}
+	fieldRules = rules
+	return nil
+}
+
+// ImmutablePaths returns the paths of all immutable fields, in the format of
+// preserved paths.
+func ImmutablePaths() []string {
+	paths := []string{}
+	for _, r := range fieldRules.Immutable {
+		paths = append(paths, r.scopedPath())
+	}
+	return paths
+}
+
+func (rules *FieldRules) add(platformManaged []string, immutable []string, source string) error {
+	for _, s := range platformManaged {
+		r, err := NewFieldRule(s, source)
+		if err != nil {
+			return err
+		}
+		rules.PlatformManaged = append(rules.PlatformManaged, r)
+	}
+	for _, s := range immutable {
+		r, err := NewFieldRule(s, source)
+		if err != nil {
+			return err
+		}
+		if r.exp != nil {
+			return fmt.Errorf("%s is not a valid immutable field rule: regular expressions are not supported", s)
+		}
+		rules.Immutable = append(rules.Immutable, r)
+	}
+	return nil
+}
+
+// appliesTo checks whether the rule is in scope for the given item.
+func (r *FieldRule) appliesTo(item *ResourceItem) bool {
+	if len(r.Kind) > 0 &&
+		KindMapping[strings.ToLower(r.Kind)] != item.Kind &&
+		!strings.EqualFold(r.Kind, item.Kind) {
+		return false
+	}
+	return len(r.Name) == 0 || strings.ToLower(r.Name) == item.Name
+}
+
+func (r *FieldRule) scopedPath() string {
+	scope := []string{}
+	if len(r.Kind) > 0 {
+		scope = append(scope, r.Kind)
+	}
+	if len(r.Name) > 0 {
+		scope = append(scope, r.Name)
+	}
+	return strings.Join(append(scope, r.Path), ":")
+}
+
+func (r *FieldRule) String() string {
+	return fmt.Sprintf("%s (%s)", r.scopedPath(), r.Source)
+}
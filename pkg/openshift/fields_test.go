@@ -0,0 +1,140 @@
+package openshift
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/tailor/pkg/cli"
+	"github.com/opendevstack/tailor/pkg/utils"
+)
+
+func TestNewFieldRule(t *testing.T) {
+	tests := map[string]struct {
+		rule        string
+		expected    string
+		expectedErr string
+	}{
+		"global path": {
+			rule:     "/spec/foo",
+			expected: "/spec/foo (test)",
+		},
+		"per kind": {
+			rule:     "dc:/spec/foo",
+			expected: "dc:/spec/foo (test)",
+		},
+		"per resource": {
+			rule:     "dc:bar:/spec/foo",
+			expected: "dc:bar:/spec/foo (test)",
+		},
+		"regular expression with colon": {
+			rule:     "dc:^/spec/(?:foo|bar)",
+			expected: "dc:^/spec/(?:foo|bar) (test)",
+		},
+		"too many scopes": {
+			rule:        "dc:bar:baz:/spec/foo",
+			expectedErr: "dc:bar:baz:/spec/foo is not a valid field rule",
+		},
+		"no path": {
+			rule:        "dc:spec",
+			expectedErr: "dc:spec is not a valid field rule",
+		},
+		"invalid regular expression": {
+			rule:        "^/spec/(foo",
+			expectedErr: "^/spec/(foo is not a valid field rule: error parsing regexp: missing closing ): `^/spec/(foo`",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, err := NewFieldRule(tc.rule, "test")
+			if len(tc.expectedErr) > 0 {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Fatalf("Expected error '%s', got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.String() != tc.expected {
+				t.Fatalf("Expected rule '%s', got: '%s'", tc.expected, r.String())
+			}
+		})
+	}
+}
+
+func TestConfigureFieldRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailor-field-rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { fieldRules = DefaultFieldRules() }()
+	rulesFile := filepath.Join(dir, "rules.yml")
+	err = ioutil.WriteFile(rulesFile, []byte(`platform-managed:
+- bc:^/spec/output/to/.*
+immutable:
+- bc:foo:/spec/runPolicy
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	globalOptions := cli.InitGlobalOptions(&utils.OsFS{})
+	globalOptions.PlatformManagedFields = []string{"bc:/spec/nodeSelector", "dc:/spec/strategy"}
+	globalOptions.ImmutableFields = []string{"bc:/spec/successfulBuildsHistoryLimit"}
+	globalOptions.FieldRulesFile = rulesFile
+	err = ConfigureFieldRules(globalOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := getItem(t, getBuildConfig(), "template")
+	for _, path := range []string{"/spec/nodeSelector", "/spec/output/to/kind", "/spec/output/to/name", "/status"} {
+		if utils.Includes(item.Paths, path) {
+			t.Errorf("Path %s should have been removed", path)
+		}
+	}
+	for _, path := range []string{"/spec/output", "/spec/strategy"} {
+		if !utils.Includes(item.Paths, path) {
+			t.Errorf("Path %s should have been kept", path)
+		}
+	}
+
+	immutable := map[string]string{}
+	for _, path := range []string{"/spec/runPolicy", "/spec/successfulBuildsHistoryLimit", "/spec/source"} {
+		if rule := item.immutableFieldRule(path); rule != nil {
+			immutable[path] = rule.String()
+		}
+	}
+	expectedImmutable := map[string]string{
+		"/spec/runPolicy":                    "bc:foo:/spec/runPolicy (" + rulesFile + ")",
+		"/spec/successfulBuildsHistoryLimit": "bc:/spec/successfulBuildsHistoryLimit (options)",
+	}
+	if diff := cmp.Diff(expectedImmutable, immutable); diff != "" {
+		t.Fatalf("Immutable fields mismatch (-want +got):\n%s", diff)
+	}
+
+	expectedPaths := []string{
+		"pvc:/spec/accessModes",
+		"pvc:/spec/storageClassName",
+		"pvc:/spec/resources/requests/storage",
+		"route:/spec/host",
+		"secret:/type",
+		"bc:/spec/successfulBuildsHistoryLimit",
+		"bc:foo:/spec/runPolicy",
+	}
+	if diff := cmp.Diff(expectedPaths, ImmutablePaths()); diff != "" {
+		t.Fatalf("Immutable paths mismatch (-want +got):\n%s", diff)
+	}
+
+	globalOptions.FieldRulesFile = ""
+	globalOptions.ImmutableFields = []string{"^/spec/foo"}
+	err = ConfigureFieldRules(globalOptions)
+	expectedErr := "^/spec/foo is not a valid immutable field rule: regular expressions are not supported"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("Expected error '%s', got: %v", expectedErr, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/opendevstack/tailor/pkg/cli"
 	"github.com/opendevstack/tailor/pkg/utils"
 )
 
@@ -21,6 +22,53 @@ var availableKinds = []string{
 	"secret",
 	"rolebinding",
 	"serviceaccount",
+	"cronjob",
+}
+
+// RegisterAPIResources makes the given resources known to Tailor, so that
+// they can be targeted by kind, name or short name. Kinds which are known
+// already keep their mapping. The set of kinds managed by default is not
+// changed by this.
+func RegisterAPIResources(resources []cli.APIResource) {
+	for _, r := range resources {
+		aliases := append([]string{strings.ToLower(r.Kind), r.Name}, r.ShortNames...)
+		for _, alias := range aliases {
+			if _, ok := KindMapping[alias]; !ok {
+				KindMapping[alias] = r.Kind
+			}
+		}
+		if _, ok := kindToShortMapping[r.Kind]; !ok {
+			if len(r.ShortNames) > 0 {
+				kindToShortMapping[r.Kind] = r.ShortNames[0]
+			} else {
+				kindToShortMapping[r.Kind] = strings.ToLower(r.Kind)
+			}
+		}
+	}
+}
+
+// UnknownKinds returns the kinds referenced in kindArg and excludeFlag (see
+// NewResourceFilter) which are not known to Tailor.
+func UnknownKinds(kindArg string, excludeFlag string) []string {
+	unknownKinds := []string{}
+	candidates := []string{}
+	if len(kindArg) > 0 {
+		candidates = append(candidates, strings.Split(kindArg, ",")...)
+	}
+	if len(excludeFlag) > 0 {
+		candidates = append(candidates, strings.Split(excludeFlag, ",")...)
+	}
+	for _, c := range candidates {
+		c = strings.ToLower(c)
+		if strings.Contains(c, "=") {
+			continue
+		}
+		kind := strings.Split(c, "/")[0]
+		if _, ok := KindMapping[kind]; !ok {
+			unknownKinds = append(unknownKinds, kind)
+		}
+	}
+	return unknownKinds
 }
 
 type ResourceFilter struct {
@@ -53,6 +101,12 @@ func NewResourceFilter(kindArg string, selectorFlag string, excludeFlag string)
 				)
 			}
 			nameParts := strings.Split(kindArg, "/")
+			if _, ok := KindMapping[nameParts[0]]; !ok {
+				return nil, fmt.Errorf(
+					"Unknown resource kind: %s",
+					nameParts[0],
+				)
+			}
 			filter.Name = KindMapping[nameParts[0]] + "/" + nameParts[1]
 			return filter, nil
 		}
@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/tailor/pkg/cli"
 )
 
 func TestNewResourceFilter(t *testing.T) {
@@ -194,3 +196,59 @@ func makeItem(config []byte) (*ResourceItem, error) {
 	m := f.(map[string]interface{})
 	return NewResourceItem(m, "template")
 }
+
+func TestRegisterAPIResources(t *testing.T) {
+	defer restoreKindMappings(KindMapping, kindToShortMapping)
+	KindMapping = copyMapping(KindMapping)
+	kindToShortMapping = copyMapping(kindToShortMapping)
+
+	unknown := UnknownKinds("deploy,dc", "widget/foo,app=bar")
+	if diff := cmp.Diff([]string{"deploy", "widget"}, unknown); diff != "" {
+		t.Fatalf("Unknown kinds mismatch (-want +got):\n%s", diff)
+	}
+	_, err := NewResourceFilter("deploy", "", "")
+	if err == nil {
+		t.Fatal("Expected deploy to be unknown before registration")
+	}
+
+	RegisterAPIResources([]cli.APIResource{
+		{Group: "apps", Version: "v1", Name: "deployments", Kind: "Deployment", ShortNames: []string{"deploy"}},
+		{Group: "example.com", Version: "v1", Name: "widgets", Kind: "Widget"},
+		// Does not override existing mapping
+		{Group: "example.com", Version: "v1", Name: "dcs", Kind: "Dc", ShortNames: []string{"dc"}},
+	})
+
+	if unknown := UnknownKinds("deploy,dc", "widget/foo,app=bar"); len(unknown) > 0 {
+		t.Fatalf("Expected all kinds to be known, got unknown: %v", unknown)
+	}
+	actual, err := NewResourceFilter("deploy,deployments,dc", "", "widget/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &ResourceFilter{
+		Kinds:         []string{"Deployment", "DeploymentConfig"},
+		ExcludedNames: []string{"Widget/foo"},
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("Filter mismatch (-want +got):\n%s", diff)
+	}
+	c := &Change{Kind: "Widget", Name: "foo"}
+	if c.ItemName() != "widget/foo" {
+		t.Fatalf("Expected item name widget/foo, got: %s", c.ItemName())
+	}
+}
+
+// restoreKindMappings resets the global kind mappings, which are changed by
+// registering API resources.
+func restoreKindMappings(kindMapping, shortMapping map[string]string) {
+	KindMapping = kindMapping
+	kindToShortMapping = shortMapping
+}
+
+func copyMapping(m map[string]string) map[string]string {
+	c := map[string]string{}
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -1,9 +1,10 @@
 package openshift
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
-	"regexp"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -14,35 +15,8 @@ import (
 )
 
 var (
-	annotationsPath             = "/metadata/annotations"
-	platformManagedSimpleFields = []string{
-		"/metadata/generation",
-		"/metadata/creationTimestamp",
-		"/spec/tags",
-		"/status",
-		"/spec/volumeName",
-		"/spec/template/metadata/creationTimestamp",
-		"/groupNames",
-		"/userNames",
-	}
-	platformManagedRegexFields = []string{
-		"^/spec/triggers/[0-9]*/imageChangeParams/lastTriggeredImage",
-	}
-	immutableFields = map[string][]string{
-		"PersistentVolumeClaim": []string{
-			"/spec/accessModes",
-			"/spec/storageClassName",
-			"/spec/resources/requests/storage",
-		},
-		"Route": []string{
-			"/spec/host",
-		},
-		"Secret": []string{
-			"/type",
-		},
-	}
-
-	KindMapping = map[string]string{
+	annotationsPath = "/metadata/annotations"
+	KindMapping     = map[string]string{
 		"svc":                   "Service",
 		"service":               "Service",
 		"route":                 "Route",
@@ -76,6 +50,8 @@ type ResourceItem struct {
 	AnnotationsPresent       bool
 	LastAppliedConfiguration map[string]interface{}
 	LastAppliedAnnotations   map[string]interface{}
+	// Overlays are the files of the overlays applied to the item.
+	Overlays []string
 }
 
 func NewResourceItem(m map[string]interface{}, source string) (*ResourceItem, error) {
@@ -108,6 +84,14 @@ func (i *ResourceItem) YamlConfig() string {
 	return string(y)
 }
 
+// Fingerprint returns a hash of the config of the item. It is stable as long
+// as the config does not change, and needs to be taken before the item is
+// prepared for comparison.
+func (i *ResourceItem) Fingerprint() string {
+	b, _ := json.Marshal(i.Config)
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+}
+
 // parseConfig uses the config to initialise an item. The logic is the same
 // for template and platform items, with no knowledge of the "other" item - it
 // may or may not exist.
@@ -233,11 +217,16 @@ func (i *ResourceItem) parseConfig(m map[string]interface{}) error {
 
 	// Remove platform-managed simple fields
 	legacyFields := []string{"/userNames", "/groupNames"}
-	for _, p := range platformManagedSimpleFields {
-		deletePointer, _ := gojsonpointer.NewJsonPointer(p)
-		_, _ = deletePointer.Delete(m)
-		if utils.Includes(legacyFields, p) {
-			cli.DebugMsg("Removed", p, "which is used for legacy clients, but not supported by Tailor")
+	for _, rule := range fieldRules.PlatformManaged {
+		if rule.exp != nil || !rule.appliesTo(i) {
+			continue
+		}
+		deletePointer, _ := gojsonpointer.NewJsonPointer(rule.Path)
+		_, err := deletePointer.Delete(m)
+		if utils.Includes(legacyFields, rule.Path) {
+			cli.DebugMsg("Removed", rule.Path, "which is used for legacy clients, but not supported by Tailor")
+		} else if err == nil {
+			cli.DebugMsg("Removed platform-managed path", rule.Path, "of", i.FullName(), "by rule", rule.String())
 		}
 	}
 
@@ -252,12 +241,13 @@ func (i *ResourceItem) parseConfig(m map[string]interface{}) error {
 	for pathIndex, path := range i.Paths {
 
 		// Remove platform-managed regex fields
-		for _, platformManagedField := range platformManagedRegexFields {
-			matched, _ := regexp.MatchString(platformManagedField, path)
-			if matched {
+		for _, rule := range fieldRules.PlatformManaged {
+			if rule.exp != nil && rule.appliesTo(i) && rule.exp.MatchString(path) {
 				deletePointer, _ := gojsonpointer.NewJsonPointer(path)
 				_, _ = deletePointer.Delete(i.Config)
 				deletedPathIndices = append(deletedPathIndices, pathIndex)
+				cli.DebugMsg("Removed platform-managed path", path, "of", i.FullName(), "by rule", rule.String())
+				break
 			}
 		}
 	}
@@ -267,7 +257,6 @@ func (i *ResourceItem) parseConfig(m map[string]interface{}) error {
 	indexOffset := 0
 	for _, pathIndex := range deletedPathIndices {
 		deletionIndex := pathIndex + indexOffset
-		cli.DebugMsg("Removing platform managed path", i.Paths[deletionIndex])
 		i.Paths = append(i.Paths[:deletionIndex], i.Paths[deletionIndex+1:]...)
 		indexOffset = indexOffset - 1
 	}
@@ -278,13 +267,15 @@ func (i *ResourceItem) parseConfig(m map[string]interface{}) error {
 	return nil
 }
 
-func (i *ResourceItem) isImmutableField(field string) bool {
-	for _, key := range immutableFields[i.Kind] {
-		if key == field {
-			return true
+// immutableFieldRule returns the rule declaring field as immutable, or nil if
+// the field is mutable.
+func (i *ResourceItem) immutableFieldRule(field string) *FieldRule {
+	for _, rule := range fieldRules.Immutable {
+		if rule.Path == field && rule.appliesTo(i) {
+			return rule
 		}
 	}
-	return false
+	return nil
 }
 
 func (i *ResourceItem) walkMap(m map[string]interface{}, pointer string) {
@@ -321,6 +312,31 @@ func (i *ResourceItem) handleKeyValue(k interface{}, v interface{}, pointer stri
 	}
 }
 
+// preservedFields returns the fields which differ between template and
+// platform item, but are preserved and therefore do not cause drift.
+// It must be called before the template item is prepared for comparison.
+func (templateItem *ResourceItem) preservedFields(platformItem *ResourceItem, preservePaths []string) []*FieldChange {
+	fields := []*FieldChange{}
+	for _, path := range preservePaths {
+		pathPointer, _ := gojsonpointer.NewJsonPointer(path)
+		templateItemVal, _, err := pathPointer.Get(templateItem.Config)
+		if err != nil {
+			// Desired state does not define the path
+			continue
+		}
+		platformItemVal, _, _ := pathPointer.Get(platformItem.Config)
+		if !reflect.DeepEqual(templateItemVal, platformItemVal) {
+			fields = append(fields, &FieldChange{
+				Path:    path,
+				Current: platformItemVal,
+				Desired: templateItemVal,
+				Reason:  "preserved",
+			})
+		}
+	}
+	return fields
+}
+
 // prepareForComparisonWithPlatformItem massages template item in such a way
 // that it can be compared with the given platform item:
 // - copy value from platformItem to templateItem for externally modified paths
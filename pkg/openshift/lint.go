@@ -0,0 +1,246 @@
+package openshift
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/opendevstack/tailor/pkg/cli"
+	"github.com/opendevstack/tailor/pkg/utils"
+)
+
+// LintTemplates checks the templates in the template dir, and the param
+// files used to process them, without contacting the cluster. Each problem
+// is prefixed with the file in which it was found.
+func LintTemplates(lintOptions *cli.LintOptions) ([]string, error) {
+	templates, err := FindTemplates(
+		lintOptions.TemplateDirs,
+		lintOptions.Recursive,
+		lintOptions.TemplateInclude,
+		lintOptions.TemplateExclude,
+		lintOptions.Renderers,
+		[]string{lintOptions.RecipientsPolicy},
+	)
+	if err != nil {
+		return nil, err
+	}
+	// Param files are located in the same way as when templates are processed.
+	compareOptions := &cli.CompareOptions{
+		GlobalOptions:    lintOptions.GlobalOptions,
+		NamespaceOptions: lintOptions.NamespaceOptions,
+		ParamFiles:       lintOptions.ParamFiles,
+	}
+	managed := managedKinds(lintOptions.Kinds)
+	givenParams := map[string]string{}
+	for _, p := range lintOptions.Params {
+		pair := strings.SplitN(p, "=", 2)
+		givenParams[pair[0]] = pair[len(pair)-1]
+	}
+
+	problems := []string{}
+	definedIn := map[string]string{}
+	paramFiles := []string{}
+	paramFileKeys := map[string][]string{}
+	paramFileValues := map[string]map[string]string{}
+	usedKeys := map[string]map[string]bool{}
+	for _, template := range templates {
+		filename := template.Path()
+		// Rendering requires running external commands.
+		if len(template.Renderer) > 0 {
+			cli.DebugMsg("Skipping rendered template", filename)
+			continue
+		}
+		cli.DebugMsg("Linting template", filename)
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		objects, isTemplate, err := splitManifest(b)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", filename, err))
+			continue
+		}
+		t := processableTemplate{Objects: objects}
+		if isTemplate {
+			err = yaml.Unmarshal(b, &t)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s", filename, utils.DisplaySyntaxError(b, err)))
+				continue
+			}
+		}
+
+		declared := map[string]bool{}
+		for _, p := range t.Parameters {
+			declared[p.Name] = true
+		}
+		// Manifests do not declare parameters, references without a value
+		// are kept as-is.
+		if !isTemplate {
+			for _, name := range referencedParameters(t) {
+				declared[name] = true
+			}
+		}
+		// Values are only known as far as they are needed to identify
+		// objects, e.g. "${NAME}" in "metadata.name".
+		values := map[string]string{"TAILOR_NAMESPACE": lintOptions.Namespace}
+		hasValue := map[string]bool{"TAILOR_NAMESPACE": true}
+		for _, p := range t.Parameters {
+			if len(p.Value) > 0 {
+				values[p.Name] = p.Value
+			}
+		}
+		for _, f := range calculateParamFiles(template.Name, lintOptions.ParamDir, compareOptions) {
+			for _, pf := range []string{f, f + ".enc"} {
+				if _, ok := paramFileKeys[pf]; !ok {
+					keys, vals, err := readParamFile(pf)
+					if err != nil {
+						return nil, err
+					}
+					paramFiles = append(paramFiles, pf)
+					paramFileKeys[pf] = keys
+					paramFileValues[pf] = vals
+					usedKeys[pf] = map[string]bool{}
+				}
+				for _, k := range paramFileKeys[pf] {
+					hasValue[k] = true
+					if declared[k] {
+						usedKeys[pf][k] = true
+					}
+					if !strings.HasSuffix(pf, ".enc") {
+						values[k] = paramFileValues[pf][k]
+					}
+				}
+			}
+		}
+		for k, v := range givenParams {
+			hasValue[k] = true
+			values[k] = v
+		}
+
+		for _, p := range t.Parameters {
+			if len(p.Value) == 0 && len(p.Generate) == 0 && !hasValue[p.Name] {
+				problems = append(problems, fmt.Sprintf("%s: parameter %s has neither a value nor a default", filename, p.Name))
+			}
+		}
+		for _, name := range referencedParameters(t) {
+			if isTemplate && !declared[name] {
+				problems = append(problems, fmt.Sprintf("%s: parameter %s is used, but not declared", filename, name))
+			}
+		}
+
+		for i, object := range t.Objects {
+			m, _ := object.(map[string]interface{})
+			kind, _ := m["kind"].(string)
+			metadata, _ := m["metadata"].(map[string]interface{})
+			name, _ := metadata["name"].(string)
+			if len(kind) == 0 || len(name) == 0 {
+				problems = append(problems, fmt.Sprintf("%s: objects[%d] has no kind or name", filename, i))
+				continue
+			}
+			fullName := kind + "/" + substituteParameters(name, values)
+			if !managed[kind] && !managed[strings.ToLower(kind)] {
+				problems = append(problems, fmt.Sprintf("%s: %s is of kind %s, which Tailor does not manage (see --kinds)", filename, fullName, kind))
+			}
+			if other, ok := definedIn[fullName]; ok {
+				problems = append(problems, fmt.Sprintf("%s: %s is already defined in %s", filename, fullName, other))
+			} else {
+				definedIn[fullName] = filename
+			}
+		}
+	}
+
+	for _, pf := range paramFiles {
+		for _, k := range paramFileKeys[pf] {
+			if !usedKeys[pf][k] {
+				problems = append(problems, fmt.Sprintf("%s: %s is not used by any template", pf, k))
+			}
+		}
+	}
+	return problems, nil
+}
+
+// managedKinds returns the kinds (and given aliases) managed by Tailor. If
+// no kinds are given, the default kinds are managed.
+func managedKinds(kinds string) map[string]bool {
+	aliases := availableKinds
+	if len(kinds) > 0 {
+		aliases = strings.Split(kinds, ",")
+	}
+	managed := map[string]bool{}
+	for _, alias := range aliases {
+		alias = strings.ToLower(strings.TrimSpace(alias))
+		if kind, ok := KindMapping[alias]; ok {
+			managed[kind] = true
+		} else {
+			// Kinds unknown offline might be discovered from the cluster.
+			managed[alias] = true
+		}
+	}
+	return managed
+}
+
+// readParamFile returns the keys of the param file, with a ".B64" suffix
+// removed, and the values by key. Values of encrypted param files are not
+// decrypted. A missing file has no keys.
+func readParamFile(filename string) ([]string, map[string]string, error) {
+	keys := []string{}
+	values := map[string]string{}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return keys, values, nil
+		}
+		return nil, nil, err
+	}
+	err = extractKeyValuePairs(string(b), func(key, val string) error {
+		key = strings.TrimSuffix(key, ".B64")
+		keys = append(keys, key)
+		values[key] = val
+		return nil
+	}, func(line string) {})
+	return keys, values, err
+}
+
+// referencedParameters returns the sorted names of all parameters referenced
+// in the objects and labels of the template.
+func referencedParameters(t processableTemplate) []string {
+	found := map[string]bool{}
+	collect := func(s string) {
+		for _, exp := range []*regexp.Regexp{nonStringParameterExp, stringParameterExp} {
+			for _, match := range exp.FindAllStringSubmatch(s, -1) {
+				found[match[1]] = true
+			}
+		}
+	}
+	var visit func(v interface{})
+	visit = func(v interface{}) {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			for k, e := range val {
+				collect(k)
+				visit(e)
+			}
+		case []interface{}:
+			for _, e := range val {
+				visit(e)
+			}
+		case string:
+			collect(val)
+		}
+	}
+	visit(t.Objects)
+	for k, v := range t.Labels {
+		collect(k)
+		collect(v)
+	}
+	names := []string{}
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,39 @@
+package openshift
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/tailor/pkg/cli"
+	"github.com/opendevstack/tailor/pkg/utils"
+)
+
+func TestLintTemplates(t *testing.T) {
+	lintOptions := &cli.LintOptions{
+		GlobalOptions:    cli.InitGlobalOptions(&utils.OsFS{}),
+		NamespaceOptions: &cli.NamespaceOptions{Namespace: "foo"},
+		TemplateDirs:     []string{"../../internal/test/fixtures/lint/templates"},
+		ParamDir:         "../../internal/test/fixtures/lint/params",
+	}
+	problems, err := LintTemplates(lintOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"templates/app.yml: parameter IMAGE has neither a value nor a default",
+		"templates/app.yml: parameter TAG is used, but not declared",
+		"templates/app.yml: Deployment/foo is of kind Deployment, which Tailor does not manage (see --kinds)",
+		"templates/broken.yml: error converting YAML to JSON: yaml: line 6: mapping values are not allowed in this context",
+		"templates/other.yml: Service/foo is already defined in templates/app.yml",
+		"params/app.env: UNUSED is not used by any template",
+		"params/app.env.enc: SECRET is not used by any template",
+	}
+	actual := []string{}
+	for _, p := range problems {
+		actual = append(actual, strings.Replace(p, "../../internal/test/fixtures/lint/", "", -1))
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("Problems mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -2,6 +2,7 @@ package openshift
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/ghodss/yaml"
 	"github.com/opendevstack/tailor/pkg/cli"
@@ -16,18 +17,27 @@ type ResourceList struct {
 }
 
 // NewTemplateBasedResourceList assembles a ResourceList from an input that is
-// treated as coming from a local template (desired state).
-func NewTemplateBasedResourceList(filter *ResourceFilter, inputs ...[]byte) (*ResourceList, error) {
+// treated as coming from a local template (desired state). The overlays are
+// applied to the items before they are filtered.
+func NewTemplateBasedResourceList(filter *ResourceFilter, overlays []*Overlay, inputs ...[]byte) (*ResourceList, error) {
 	list := &ResourceList{Filter: filter}
-	err := list.appendItems("template", "/items", inputs...)
-	return list, err
+	err := list.appendItems("template", "/items", overlays, inputs...)
+	if err != nil {
+		return list, err
+	}
+	for _, o := range overlays {
+		if !o.applied {
+			return list, fmt.Errorf("Overlay %s targets %s, which is not defined in any template", o.Filename, o.Target)
+		}
+	}
+	return list, nil
 }
 
 // NewPlatformBasedResourceList assembles a ResourceList from an input that is
 // treated as coming from an OpenShift cluster (current state).
 func NewPlatformBasedResourceList(filter *ResourceFilter, inputs ...[]byte) (*ResourceList, error) {
 	list := &ResourceList{Filter: filter}
-	err := list.appendItems("platform", "/objects", inputs...)
+	err := list.appendItems("platform", "/objects", nil, inputs...)
 	return list, err
 }
 
@@ -45,7 +55,7 @@ func (l *ResourceList) getItem(kind string, name string) (*ResourceItem, error)
 	return nil, errors.New("No such item")
 }
 
-func (l *ResourceList) appendItems(source, itemsField string, inputs ...[]byte) error {
+func (l *ResourceList) appendItems(source, itemsField string, overlays []*Overlay, inputs ...[]byte) error {
 	for _, input := range inputs {
 		if len(input) == 0 {
 			cli.DebugMsg("Input config empty")
@@ -66,10 +76,15 @@ func (l *ResourceList) appendItems(source, itemsField string, inputs ...[]byte)
 			return err
 		}
 		for _, v := range items.([]interface{}) {
-			item, err := NewResourceItem(v.(map[string]interface{}), source)
+			m, applied, err := applyOverlays(v.(map[string]interface{}), overlays)
 			if err != nil {
 				return err
 			}
+			item, err := NewResourceItem(m, source)
+			if err != nil {
+				return err
+			}
+			item.Overlays = applied
 			if l.Filter.SatisfiedBy(item) {
 				l.Items = append(l.Items, item)
 			}
@@ -78,3 +93,29 @@ func (l *ResourceList) appendItems(source, itemsField string, inputs ...[]byte)
 
 	return nil
 }
+
+// applyOverlays applies the overlays targeting the item config m, and
+// returns the result and the files of the applied overlays.
+func applyOverlays(m map[string]interface{}, overlays []*Overlay) (map[string]interface{}, []string, error) {
+	var applied []string
+	if len(overlays) == 0 {
+		return m, applied, nil
+	}
+	kind, _ := m["kind"].(string)
+	metadata, _ := m["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	for _, o := range overlays {
+		if !o.Targets(kind, name) {
+			continue
+		}
+		cli.DebugMsg("Applying overlay", o.Filename, "to", kind+"/"+name)
+		patched, err := o.Apply(m)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Could not apply overlay %s to %s/%s: %s", o.Filename, kind, name, err)
+		}
+		m = patched
+		o.applied = true
+		applied = append(applied, o.Filename)
+	}
+	return m, applied, nil
+}
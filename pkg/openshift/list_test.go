@@ -36,7 +36,7 @@ metadata: {}
 		Label: "",
 	}
 
-	list, _ := NewTemplateBasedResourceList(filter, byteList)
+	list, _ := NewTemplateBasedResourceList(filter, nil, byteList)
 
 	if len(list.Items) != 1 {
 		t.Errorf("One item should have been extracted, got %v items.", len(list.Items))
@@ -87,7 +87,7 @@ metadata: {}
 		Label: "",
 	}
 
-	list, _ := NewTemplateBasedResourceList(filter, byteList)
+	list, _ := NewTemplateBasedResourceList(filter, nil, byteList)
 
 	if len(list.Items) != 1 {
 		t.Errorf("One item should have been extracted, got %v items.", len(list.Items))
@@ -177,7 +177,7 @@ metadata: {}
 		Label: "app=foo",
 	}
 
-	pvcList, _ := NewTemplateBasedResourceList(pvcFilter, byteList)
+	pvcList, _ := NewTemplateBasedResourceList(pvcFilter, nil, byteList)
 
 	if len(pvcList.Items) != 1 {
 		t.Errorf("One item should have been extracted, got %v items.", len(pvcList.Items))
@@ -188,7 +188,7 @@ metadata: {}
 		t.Errorf("Item foo should have been present.")
 	}
 
-	cmList, _ := NewTemplateBasedResourceList(cmFilter, byteList)
+	cmList, _ := NewTemplateBasedResourceList(cmFilter, nil, byteList)
 
 	if len(cmList.Items) != 1 {
 		t.Errorf("One item should have been extracted, got %v items.", len(cmList.Items))
@@ -199,7 +199,7 @@ metadata: {}
 		t.Errorf("Item should have been present.")
 	}
 
-	secretList, _ := NewTemplateBasedResourceList(secretFilter, byteList)
+	secretList, _ := NewTemplateBasedResourceList(secretFilter, nil, byteList)
 
 	if len(secretList.Items) != 0 {
 		t.Errorf("No item should have been extracted, got %v items.", len(secretList.Items))
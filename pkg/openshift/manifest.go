@@ -0,0 +1,113 @@
+package openshift
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/opendevstack/tailor/pkg/utils"
+)
+
+// documentSeparatorExp matches the "---" lines separating YAML documents.
+var documentSeparatorExp = regexp.MustCompile(`(?m)^---([ \t].*)?$`)
+
+// yamlLineExp matches the line number in errors of the YAML parser.
+var yamlLineExp = regexp.MustCompile(`yaml: line (\d+):`)
+
+// splitManifest returns the objects in b, which is either an OpenShift
+// template or a plain manifest. A plain manifest consists of one or more
+// YAML documents, each of them a single object or a list of objects (such as
+// "kind: List"). If b is a template, no objects are returned and isTemplate
+// is true.
+func splitManifest(b []byte) (objects []interface{}, isTemplate bool, err error) {
+	documents := documentSeparatorExp.Split(string(b), -1)
+	starts := []int{0}
+	for _, loc := range documentSeparatorExp.FindAllStringIndex(string(b), -1) {
+		starts = append(starts, loc[1])
+	}
+	objects = []interface{}{}
+	for i, document := range documents {
+		var f interface{}
+		err := yaml.Unmarshal([]byte(document), &f)
+		if err != nil {
+			return nil, false, documentSyntaxError(b, starts[i], err)
+		}
+		if f == nil {
+			continue
+		}
+		m, ok := f.(map[string]interface{})
+		if !ok {
+			return nil, false, fmt.Errorf("document %d is not an object", i+1)
+		}
+		kind, _ := m["kind"].(string)
+		if kind == "Template" {
+			if len(documents) > 1 {
+				return nil, false, fmt.Errorf("document %d is a template, which must be the only document in its file", i+1)
+			}
+			return nil, true, nil
+		}
+		if items, ok := m["items"].([]interface{}); ok && strings.HasSuffix(kind, "List") {
+			objects = append(objects, items...)
+		} else {
+			objects = append(objects, m)
+		}
+	}
+	return objects, false, nil
+}
+
+// documentSyntaxError returns err, which occurred when parsing the document
+// starting at offset of b, with line numbers relative to b instead of the
+// document.
+func documentSyntaxError(b []byte, offset int, err error) error {
+	if syntax, ok := err.(*json.SyntaxError); ok {
+		syntax.Offset += int64(offset)
+		return utils.DisplaySyntaxError(b, syntax)
+	}
+	lines := bytes.Count(b[:offset], []byte("\n"))
+	if lines == 0 {
+		return err
+	}
+	return errors.New(yamlLineExp.ReplaceAllStringFunc(err.Error(), func(m string) string {
+		n, _ := strconv.Atoi(yamlLineExp.FindStringSubmatch(m)[1])
+		return fmt.Sprintf("yaml: line %d:", n+lines)
+	}))
+}
+
+// processManifest turns the objects of a plain manifest into a list, like
+// processTemplateLocally does for templates. As there are no declared
+// parameters, "${NAME}" references are substituted with the values of params
+// (given as KEY=VALUE) and paramFileBytes (in .env format), and references
+// without a value are kept as-is.
+func processManifest(objects []interface{}, labels string, params []string, paramFileBytes []byte) ([]byte, error) {
+	values, err := parameterValues(params, paramFileBytes)
+	if err != nil {
+		return nil, err
+	}
+	objectLabels, err := parseLabels(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []interface{}{}
+	for i, object := range objects {
+		m, ok := visitStrings(object, values).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("object %d is not a map", i)
+		}
+		addObjectLabels(m, objectLabels)
+		items = append(items, m)
+	}
+
+	list := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"metadata":   map[string]interface{}{},
+		"items":      items,
+	}
+	return yaml.Marshal(list)
+}
@@ -0,0 +1,213 @@
+package openshift
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/tailor/pkg/cli"
+)
+
+func TestSplitManifest(t *testing.T) {
+	tests := map[string]struct {
+		input         string
+		expectedNames []string
+		isTemplate    bool
+		expectedErr   string
+	}{
+		"single object": {
+			input:         "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n",
+			expectedNames: []string{"ConfigMap/foo"},
+		},
+		"list": {
+			input: `apiVersion: v1
+kind: List
+items:
+- kind: ConfigMap
+  metadata:
+    name: foo
+- kind: Service
+  metadata:
+    name: bar
+`,
+			expectedNames: []string{"ConfigMap/foo", "Service/bar"},
+		},
+		"multiple documents": {
+			input: `---
+kind: ConfigMap
+metadata:
+  name: foo
+--- # the service
+kind: Service
+metadata:
+  name: bar
+---
+kind: ServiceList
+items:
+- kind: Service
+  metadata:
+    name: baz
+---
+`,
+			expectedNames: []string{"ConfigMap/foo", "Service/bar", "Service/baz"},
+		},
+		"template": {
+			input:         "apiVersion: v1\nkind: Template\nobjects: []\n",
+			expectedNames: nil,
+			isTemplate:    true,
+		},
+		"template among other documents": {
+			input:       "kind: ConfigMap\nmetadata:\n  name: foo\n---\nkind: Template\nobjects: []\n",
+			expectedErr: "document 2 is a template, which must be the only document in its file",
+		},
+		"syntax error in first document": {
+			input:       "kind: ConfigMap\nmetadata:\n  name: foo: bar\n---\nkind: Service\n",
+			expectedErr: "error converting YAML to JSON: yaml: line 3: mapping values are not allowed in this context",
+		},
+		"syntax error in later document": {
+			input:       "kind: ConfigMap\nmetadata:\n  name: foo\n---\nkind: Service\nmetadata:\n  name: foo: bar\n",
+			expectedErr: "error converting YAML to JSON: yaml: line 7: mapping values are not allowed in this context",
+		},
+		"document which is not an object": {
+			input:       "kind: ConfigMap\nmetadata:\n  name: foo\n---\n- foo\n",
+			expectedErr: "document 2 is not an object",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			objects, isTemplate, err := splitManifest([]byte(tc.input))
+			if len(tc.expectedErr) > 0 {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Fatalf("Expected error '%s', got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isTemplate != tc.isTemplate {
+				t.Fatalf("Expected isTemplate to be %t, got %t", tc.isTemplate, isTemplate)
+			}
+			var names []string
+			for _, o := range objects {
+				m := o.(map[string]interface{})
+				metadata := m["metadata"].(map[string]interface{})
+				names = append(names, m["kind"].(string)+"/"+metadata["name"].(string))
+			}
+			if diff := cmp.Diff(tc.expectedNames, names); diff != "" {
+				t.Fatalf("Objects mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestProcessManifest(t *testing.T) {
+	objects, _, err := splitManifest([]byte(
+		`kind: ConfigMap
+metadata:
+  name: foo-${SUFFIX}
+data:
+  namespace: ${TAILOR_NAMESPACE}
+  script: echo ${HOME}
+---
+kind: DeploymentConfig
+metadata:
+  name: foo-${SUFFIX}
+spec:
+  replicas: ${{REPLICAS}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := processManifest(
+		objects,
+		"team=bar",
+		[]string{"TAILOR_NAMESPACE=foo-dev", "SUFFIX=x"},
+		[]byte("REPLICAS=2\nSUFFIX=y\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `apiVersion: v1
+items:
+- data:
+    namespace: foo-dev
+    script: echo ${HOME}
+  kind: ConfigMap
+  metadata:
+    labels:
+      team: bar
+    name: foo-x
+- kind: DeploymentConfig
+  metadata:
+    labels:
+      team: bar
+    name: foo-x
+  spec:
+    replicas: 2
+kind: List
+metadata: {}
+`
+	if diff := cmp.Diff(expected, string(b)); diff != "" {
+		t.Fatalf("Processed manifest mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestProcessTemplateSubstitutesParamsInManifestsOnlyIfAsked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailor-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"foo.yml": "kind: ConfigMap\nmetadata:\n  name: foo\ndata:\n  color: ${COLOR}\n",
+		"foo.env": "COLOR=red\n",
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	globalOptions, err := cli.NewGlobalOptions(
+		false, "Tailorfile", false, false, false,
+		"oc", "oc", false, "",
+		[]string{}, []string{}, "", "recipients.yml",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		substituteParams bool
+		expected         string
+	}{
+		"kept as-is by default": {
+			substituteParams: false,
+			expected:         "color: ${COLOR}",
+		},
+		"substituted if asked": {
+			substituteParams: true,
+			expected:         "color: red",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			compareOptions := &cli.CompareOptions{
+				GlobalOptions:    globalOptions,
+				NamespaceOptions: &cli.NamespaceOptions{Namespace: "foo"},
+				SubstituteParams: tc.substituteParams,
+			}
+			b, err := ProcessTemplate(dir, "foo.yml", dir, compareOptions, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(b), tc.expected) {
+				t.Fatalf("Expected '%s' in processed manifest, got:\n%s", tc.expected, b)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package openshift
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/opendevstack/tailor/pkg/cli"
+	"github.com/opendevstack/tailor/pkg/utils"
+	"github.com/xeipuuv/gojsonpointer"
+)
+
+// Overlay patches a processed template item, identified by kind/name. The
+// patch is either a JSON Patch (RFC 6902), given as list of operations, or a
+// JSON Merge Patch (RFC 7386), given as object. E.g.:
+//
+//	target: dc/foo
+//	patch:
+//	- op: replace
+//	  path: /spec/replicas
+//	  value: 3
+type Overlay struct {
+	Filename string      `json:"-"`
+	Target   string      `json:"target"`
+	Patch    interface{} `json:"patch"`
+	kind     string
+	name     string
+	applied  bool
+}
+
+// jsonPatchOperation is one operation of a JSON Patch.
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from"`
+	Value interface{} `json:"value"`
+}
+
+var overlayFileExp = regexp.MustCompile(`.*\.(ya?ml|json)$`)
+
+// ReadOverlays reads the overlays in given dir, in the order of their file
+// names. A missing dir contains no overlays.
+func ReadOverlays(dir string) ([]*Overlay, error) {
+	overlays := []*Overlay{}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			cli.DebugMsg("No overlays found in", dir)
+			return overlays, nil
+		}
+		return nil, err
+	}
+	for _, file := range files {
+		if file.IsDir() || !overlayFileExp.MatchString(file.Name()) {
+			continue
+		}
+		filename := filepath.Join(dir, file.Name())
+		cli.DebugMsg("Reading overlay", filename)
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		o, err := newOverlay(filename, b)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read overlay %s: %s", filename, err)
+		}
+		overlays = append(overlays, o)
+	}
+	return overlays, nil
+}
+
+func newOverlay(filename string, b []byte) (*Overlay, error) {
+	o := &Overlay{Filename: filename}
+	err := yaml.Unmarshal(b, o)
+	if err != nil {
+		return nil, utils.DisplaySyntaxError(b, err)
+	}
+	targetParts := strings.SplitN(o.Target, "/", 2)
+	if len(targetParts) != 2 || len(targetParts[0]) == 0 || len(targetParts[1]) == 0 {
+		return nil, fmt.Errorf("target must be of form <kind>/<name>, got '%s'", o.Target)
+	}
+	o.kind = targetParts[0]
+	if kind, ok := KindMapping[strings.ToLower(o.kind)]; ok {
+		o.kind = kind
+	}
+	o.name = targetParts[1]
+	switch p := o.Patch.(type) {
+	case map[string]interface{}:
+	case []interface{}:
+		for i := range p {
+			if _, err := o.operation(i); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, errors.New("patch must be a list of JSON Patch operations or a merge patch object")
+	}
+	return o, nil
+}
+
+// Targets returns true if the overlay targets the given item.
+func (o *Overlay) Targets(kind string, name string) bool {
+	return strings.EqualFold(o.kind, kind) && o.name == name
+}
+
+// Apply patches a copy of the item config m and returns it. If any operation
+// fails, m is left untouched.
+func (o *Overlay) Apply(m map[string]interface{}) (map[string]interface{}, error) {
+	doc := copyValue(m)
+	if ops, ok := o.Patch.([]interface{}); ok {
+		for i := range ops {
+			op, _ := o.operation(i)
+			var err error
+			doc, err = op.apply(doc)
+			if err != nil {
+				return nil, fmt.Errorf("patch[%d] (%s %s): %s", i, op.Op, op.Path, err)
+			}
+		}
+	} else {
+		doc = mergePatch(doc, copyValue(o.Patch))
+	}
+	patched, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("patched item is not an object")
+	}
+	return patched, nil
+}
+
+func (o *Overlay) operation(i int) (*jsonPatchOperation, error) {
+	b, _ := json.Marshal(o.Patch.([]interface{})[i])
+	op := &jsonPatchOperation{}
+	if err := json.Unmarshal(b, op); err != nil {
+		return nil, fmt.Errorf("patch[%d]: %s", i, err)
+	}
+	switch op.Op {
+	case "add", "replace", "test", "remove":
+	case "move", "copy":
+		if _, err := gojsonpointer.NewJsonPointer(op.From); err != nil {
+			return nil, fmt.Errorf("patch[%d]: from '%s': %s", i, op.From, err)
+		}
+	default:
+		return nil, fmt.Errorf("patch[%d]: unknown op '%s'", i, op.Op)
+	}
+	if _, err := gojsonpointer.NewJsonPointer(op.Path); err != nil {
+		return nil, fmt.Errorf("patch[%d]: path '%s': %s", i, op.Path, err)
+	}
+	return op, nil
+}
+
+// apply applies the operation to doc and returns the result. doc is
+// modified in place.
+func (op *jsonPatchOperation) apply(doc interface{}) (interface{}, error) {
+	switch op.Op {
+	case "add":
+		return addValue(doc, op.Path, copyValue(op.Value))
+	case "remove":
+		return removeValue(doc, op.Path)
+	case "replace":
+		if _, err := getValue(doc, op.Path); err != nil {
+			return nil, err
+		}
+		return setValue(doc, op.Path, copyValue(op.Value))
+	case "move", "copy":
+		v, err := getValue(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			doc, err = removeValue(doc, op.From)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return addValue(doc, op.Path, copyValue(v))
+	case "test":
+		v, err := getValue(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(v, op.Value) {
+			return nil, errors.New("test failed")
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown op '%s'", op.Op)
+}
+
+func getValue(doc interface{}, path string) (interface{}, error) {
+	pointer, err := gojsonpointer.NewJsonPointer(path)
+	if err != nil {
+		return nil, err
+	}
+	v, _, err := pointer.Get(doc)
+	return v, err
+}
+
+// splitPath returns the path of the parent of path, and the last (unescaped)
+// token of path.
+func splitPath(path string) (string, string) {
+	i := strings.LastIndex(path, "/")
+	token := strings.Replace(strings.Replace(path[i+1:], "~1", "/", -1), "~0", "~", -1)
+	return path[:i], token
+}
+
+// setValue sets the value at path, which must exist already.
+func setValue(doc interface{}, path string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	pointer, _ := gojsonpointer.NewJsonPointer(path)
+	return pointer.Set(doc, value)
+}
+
+// addValue adds value at path. Other than gojsonpointer, values are inserted
+// into arrays ("-" appends) instead of replacing elements.
+func addValue(doc interface{}, path string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parentPath, token := splitPath(path)
+	parent, err := getValue(doc, parentPath)
+	if err != nil {
+		return nil, err
+	}
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[token] = value
+		return doc, nil
+	case []interface{}:
+		i := len(p)
+		if token != "-" {
+			i, err = arrayIndex(token, len(p))
+			if err != nil {
+				return nil, err
+			}
+		}
+		s := make([]interface{}, 0, len(p)+1)
+		s = append(s, p[:i]...)
+		s = append(s, value)
+		s = append(s, p[i:]...)
+		return setValue(doc, parentPath, s)
+	}
+	return nil, fmt.Errorf("cannot add to '%s'", token)
+}
+
+// removeValue removes the value at path. Other than gojsonpointer, later
+// elements of arrays are shifted instead of moving the last one.
+func removeValue(doc interface{}, path string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("cannot remove the whole item")
+	}
+	if _, err := getValue(doc, path); err != nil {
+		return nil, err
+	}
+	parentPath, token := splitPath(path)
+	parent, _ := getValue(doc, parentPath)
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		delete(p, token)
+		return doc, nil
+	case []interface{}:
+		i, _ := arrayIndex(token, len(p)-1)
+		s := make([]interface{}, 0, len(p)-1)
+		s = append(s, p[:i]...)
+		s = append(s, p[i+1:]...)
+		return setValue(doc, parentPath, s)
+	}
+	return nil, fmt.Errorf("cannot remove from '%s'", token)
+}
+
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max {
+		return 0, fmt.Errorf("invalid array index '%s'", token)
+	}
+	return i, nil
+}
+
+// mergePatch applies a JSON Merge Patch (RFC 7386) to target.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// copyValue returns a deep copy of v, so that patching an item does not
+// modify the overlay (or other items).
+func copyValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, e := range val {
+			m[k] = copyValue(e)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(val))
+		for i, e := range val {
+			s[i] = copyValue(e)
+		}
+		return s
+	default:
+		return v
+	}
+}
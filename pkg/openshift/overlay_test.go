@@ -0,0 +1,317 @@
+package openshift
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOverlayApply(t *testing.T) {
+	item := `kind: DeploymentConfig
+metadata:
+  name: foo
+  labels:
+    app: foo
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: foo
+        image: foo:latest
+`
+	tests := map[string]struct {
+		overlay     string
+		expected    string
+		expectedErr string
+	}{
+		"JSON patch": {
+			overlay: `target: dc/foo
+patch:
+- op: replace
+  path: /spec/replicas
+  value: 3
+- op: add
+  path: /spec/template/spec/containers/-
+  value:
+    name: sidecar
+    image: sidecar:latest
+- op: remove
+  path: /metadata/labels/app
+- op: copy
+  from: /metadata/name
+  path: /metadata/labels/name
+- op: test
+  path: /spec/replicas
+  value: 3
+`,
+			expected: `kind: DeploymentConfig
+metadata:
+  name: foo
+  labels:
+    name: foo
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: foo
+        image: foo:latest
+      - name: sidecar
+        image: sidecar:latest
+`,
+		},
+		"merge patch": {
+			overlay: `target: DeploymentConfig/foo
+patch:
+  metadata:
+    labels:
+      app: null
+      env: prod
+  spec:
+    replicas: 2
+`,
+			expected: `kind: DeploymentConfig
+metadata:
+  name: foo
+  labels:
+    env: prod
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: foo
+        image: foo:latest
+`,
+		},
+		"failing test": {
+			overlay: `target: dc/foo
+patch:
+- op: test
+  path: /spec/replicas
+  value: 2
+`,
+			expectedErr: "patch[0] (test /spec/replicas): test failed",
+		},
+		"missing path": {
+			overlay: `target: dc/foo
+patch:
+- op: replace
+  path: /spec/strategy/type
+  value: Recreate
+`,
+			expectedErr: "patch[0] (replace /spec/strategy/type): Object has no key 'strategy'",
+		},
+		"array insert and remove": {
+			overlay: `target: dc/foo
+patch:
+- op: add
+  path: /spec/template/spec/containers/0
+  value:
+    name: init
+    image: init:latest
+- op: remove
+  path: /spec/template/spec/containers/1
+`,
+			expected: `kind: DeploymentConfig
+metadata:
+  name: foo
+  labels:
+    app: foo
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: init
+        image: init:latest
+`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			o, err := newOverlay("foo.yml", []byte(tc.overlay))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !o.Targets("DeploymentConfig", "foo") {
+				t.Fatal("Overlay should target DeploymentConfig/foo")
+			}
+			var m map[string]interface{}
+			err = yaml.Unmarshal([]byte(item), &m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := o.Apply(m)
+			if len(tc.expectedErr) > 0 {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Fatalf("Expected error '%s', got: '%v'", tc.expectedErr, err)
+				}
+				return
+			}
+			var original map[string]interface{}
+			err = yaml.Unmarshal([]byte(item), &original)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(original, m); diff != "" {
+				t.Fatalf("Original item modified (-want +got):\n%s", diff)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var expected map[string]interface{}
+			err = yaml.Unmarshal([]byte(tc.expected), &expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(expected, actual); diff != "" {
+				t.Fatalf("Patched item mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestOverlayApplyIsAtomic(t *testing.T) {
+	o, err := newOverlay("foo.yml", []byte(`target: dc/foo
+patch:
+- op: replace
+  path: /spec/replicas
+  value: 3
+- op: remove
+  path: /spec/strategy
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := map[string]interface{}{
+		"kind": "DeploymentConfig",
+		"spec": map[string]interface{}{"replicas": float64(1)},
+	}
+	_, err = o.Apply(m)
+	if err == nil {
+		t.Fatal("Expected patch to fail")
+	}
+	expected := map[string]interface{}{
+		"kind": "DeploymentConfig",
+		"spec": map[string]interface{}{"replicas": float64(1)},
+	}
+	if diff := cmp.Diff(expected, m); diff != "" {
+		t.Fatalf("Item modified by failed patch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewOverlayErrors(t *testing.T) {
+	tests := map[string]struct {
+		overlay     string
+		expectedErr string
+	}{
+		"target without name": {
+			overlay:     "target: dc\npatch: {}\n",
+			expectedErr: "target must be of form <kind>/<name>, got 'dc'",
+		},
+		"patch of wrong type": {
+			overlay:     "target: dc/foo\npatch: foo\n",
+			expectedErr: "patch must be a list of JSON Patch operations or a merge patch object",
+		},
+		"unknown op": {
+			overlay:     "target: dc/foo\npatch:\n- op: merge\n  path: /spec\n",
+			expectedErr: "patch[0]: unknown op 'merge'",
+		},
+		"relative path": {
+			overlay:     "target: dc/foo\npatch:\n- op: remove\n  path: spec\n",
+			expectedErr: "patch[0]: path 'spec': JSON pointer must be empty or start with a \"/\"",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := newOverlay("foo.yml", []byte(tc.overlay))
+			if err == nil || err.Error() != tc.expectedErr {
+				t.Fatalf("Expected error '%s', got: '%v'", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestTemplateBasedResourceListWithOverlays(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailor-overlays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"10-replicas.yml":    "target: dc/foo\npatch:\n- op: replace\n  path: /spec/replicas\n  value: 3\n",
+		"20-labels.json":     `{"target": "cm/bar", "patch": {"metadata": {"labels": {"env": "prod"}}}}`,
+		"README.md":          "Not an overlay",
+		"30-more-labels.yml": "target: configmap/bar\npatch:\n  data:\n    bar: qux\n",
+	}
+	for name, content := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	overlays, err := ReadOverlays(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overlays) != 3 {
+		t.Fatalf("Expected 3 overlays, got %d", len(overlays))
+	}
+
+	byteList := []byte(
+		`apiVersion: v1
+items:
+- apiVersion: v1
+  kind: DeploymentConfig
+  metadata:
+    name: foo
+  spec:
+    replicas: 1
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: bar
+  data:
+    bar: baz
+kind: List
+metadata: {}
+`)
+	filter := &ResourceFilter{Kinds: []string{"ConfigMap"}}
+	list, err := NewTemplateBasedResourceList(filter, overlays, byteList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(list.Items))
+	}
+	item := list.Items[0]
+	expectedOverlays := []string{
+		filepath.Join(dir, "20-labels.json"),
+		filepath.Join(dir, "30-more-labels.yml"),
+	}
+	if diff := cmp.Diff(expectedOverlays, item.Overlays); diff != "" {
+		t.Fatalf("Overlays mismatch (-want +got):\n%s", diff)
+	}
+	data := item.Config["data"].(map[string]interface{})
+	if data["bar"] != "qux" {
+		t.Fatalf("Expected data to be patched, got: %v", data)
+	}
+
+	overlays, _ = ReadOverlays(dir)
+	_, err = NewTemplateBasedResourceList(filter, overlays, []byte("apiVersion: v1\nitems: []\nkind: List\n"))
+	expectedErr := "Overlay " + filepath.Join(dir, "10-replicas.yml") + " targets dc/foo, which is not defined in any template"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("Expected error '%s', got: '%v'", expectedErr, err)
+	}
+
+	overlays, err = ReadOverlays(filepath.Join(dir, "does-not-exist"))
+	if err != nil || len(overlays) != 0 {
+		t.Fatalf("Expected no overlays for missing dir, got %v (%v)", overlays, err)
+	}
+}
@@ -0,0 +1,277 @@
+package openshift
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opendevstack/tailor/pkg/utils"
+)
+
+var paramNameExp = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// minKnownValueLength is the minimum length of a known param value to be
+// replaced wherever it occurs. Shorter values, as well as booleans and
+// numbers, are too generic to tell whether they are environment-specific.
+const minKnownValueLength = 4
+
+// structuralFields are never parameterized, as they define the type of the
+// resource (or the resource referenced) rather than its configuration.
+var structuralFields = []string{"apiVersion", "kind"}
+
+// Parameterizer replaces environment-specific values of exported resources
+// with template parameters:
+//
+// * the namespace (as TAILOR_NAMESPACE, which Tailor sets when processing)
+// * route hosts (as <ROUTE>_HOST)
+// * container images (as <CONTAINER>_IMAGE)
+// * replica counts (as <NAME>_REPLICAS)
+// * values of known params, e.g. from an existing param file
+//
+// The same value is always replaced by the same parameter.
+type Parameterizer struct {
+	namespaceExp  *regexp.Regexp
+	knownNames    map[string]string
+	reserved      map[string]bool
+	values        map[string]string
+	names         map[string]string
+	usesNamespace bool
+}
+
+// NewParameterizer returns a parameterizer for resources of namespace.
+// knownParams map param names to values, which are replaced by the name.
+func NewParameterizer(namespace string, knownParams map[string]string) *Parameterizer {
+	p := &Parameterizer{
+		knownNames: map[string]string{},
+		reserved:   map[string]bool{"TAILOR_NAMESPACE": true},
+		values:     map[string]string{},
+		names:      map[string]string{},
+	}
+	if len(namespace) > 0 {
+		p.namespaceExp = regexp.MustCompile(`(^|[^a-zA-Z0-9])` + regexp.QuoteMeta(namespace) + `([^a-zA-Z0-9]|$)`)
+	}
+	knownNames := []string{}
+	for name := range knownParams {
+		knownNames = append(knownNames, name)
+	}
+	// If several params have the same value, the first name wins.
+	sort.Sort(sort.Reverse(sort.StringSlice(knownNames)))
+	for _, name := range knownNames {
+		p.reserved[name] = true
+		if len(knownParams[name]) > 0 {
+			p.knownNames[knownParams[name]] = name
+		}
+	}
+	return p
+}
+
+// Parameterize replaces the values of objects in place. Parameters are
+// created in the order of kind and name of the objects, so that the names do
+// not depend on the order of objects.
+func (p *Parameterizer) Parameterize(objects []interface{}) {
+	sorted := append([]interface{}{}, objects...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return objectName(sorted[i]) < objectName(sorted[j])
+	})
+	for _, o := range sorted {
+		m, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		metadata, _ := m["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		spec, _ := m["spec"].(map[string]interface{})
+		if spec != nil {
+			if host, ok := spec["host"].(string); ok && m["kind"] == "Route" && len(host) > 0 {
+				spec["host"] = "${" + p.param(name+"_HOST", host) + "}"
+			}
+			if replicas, ok := spec["replicas"].(float64); ok {
+				value := strconv.FormatFloat(replicas, 'f', -1, 64)
+				spec["replicas"] = "${{" + p.param(name+"_REPLICAS", value) + "}}"
+			}
+		}
+		p.parameterizeImages(m)
+	}
+	for _, o := range sorted {
+		p.parameterizeStrings(o)
+	}
+}
+
+// objectName returns kind/name of object o.
+func objectName(o interface{}) string {
+	m, _ := o.(map[string]interface{})
+	kind, _ := m["kind"].(string)
+	metadata, _ := m["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	return kind + "/" + name
+}
+
+// ReadKnownParams reads the params of given param files, e.g. to pass them to
+// NewParameterizer. Encrypted param files are not read, and params with
+// base64 encoded values (suffixed with .B64) are skipped.
+func ReadKnownParams(paramFiles []string) (map[string]string, error) {
+	params := map[string]string{}
+	for _, f := range paramFiles {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		err = extractKeyValuePairs(string(b), func(key, val string) error {
+			if !strings.HasSuffix(key, ".B64") {
+				params[key] = val
+			}
+			return nil
+		}, func(line string) {})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f, err)
+		}
+	}
+	return params, nil
+}
+
+// Values returns the values of all parameters, except TAILOR_NAMESPACE.
+func (p *Parameterizer) Values() map[string]string {
+	values := map[string]string{}
+	for name, value := range p.values {
+		values[name] = value
+	}
+	return values
+}
+
+// Parameters returns the template parameters referenced by objects, and
+// their values (except for TAILOR_NAMESPACE).
+func (p *Parameterizer) Parameters(objects []interface{}) ([]interface{}, map[string]string) {
+	parameters := []interface{}{}
+	values := map[string]string{}
+	for _, name := range referencedParameters(processableTemplate{Objects: objects}) {
+		if name == "TAILOR_NAMESPACE" {
+			if !p.usesNamespace {
+				continue
+			}
+		} else if value, ok := p.values[name]; ok {
+			values[name] = value
+		} else {
+			continue
+		}
+		parameters = append(parameters, map[string]interface{}{
+			"name":     name,
+			"required": true,
+		})
+	}
+	return parameters, values
+}
+
+// parameterizeImages replaces the images of all containers found in v.
+func (p *Parameterizer) parameterizeImages(v interface{}) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		keys := sortedKeys(val)
+		for _, k := range keys {
+			if k == "containers" || k == "initContainers" {
+				containers, _ := val[k].([]interface{})
+				for _, c := range containers {
+					container, ok := c.(map[string]interface{})
+					if !ok {
+						continue
+					}
+					name, _ := container["name"].(string)
+					if image, ok := container["image"].(string); ok && len(image) > 0 {
+						container["image"] = "${" + p.param(name+"_IMAGE", image) + "}"
+					}
+				}
+				continue
+			}
+			p.parameterizeImages(val[k])
+		}
+	case []interface{}:
+		for _, e := range val {
+			p.parameterizeImages(e)
+		}
+	}
+}
+
+// parameterizeStrings replaces values of known params (unless they are too
+// generic, see minKnownValueLength), and the namespace. Structural fields are
+// skipped.
+func (p *Parameterizer) parameterizeStrings(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, e := range val {
+			if utils.Includes(structuralFields, k) {
+				continue
+			}
+			val[k] = p.parameterizeStrings(e)
+		}
+		return val
+	case []interface{}:
+		for i, e := range val {
+			val[i] = p.parameterizeStrings(e)
+		}
+		return val
+	case string:
+		if name, ok := p.knownNames[val]; ok && !isGenericValue(val) {
+			p.values[name] = val
+			p.names[val] = name
+			return "${" + name + "}"
+		}
+		if p.namespaceExp != nil && p.namespaceExp.MatchString(val) {
+			p.usesNamespace = true
+			// Matches might overlap at the separating character.
+			for p.namespaceExp.MatchString(val) {
+				val = p.namespaceExp.ReplaceAllString(val, "${1}$${TAILOR_NAMESPACE}${2}")
+			}
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+// isGenericValue returns true if val is too short, a boolean or a number.
+func isGenericValue(val string) bool {
+	if len(val) < minKnownValueLength {
+		return true
+	}
+	if _, err := strconv.ParseBool(val); err == nil {
+		return true
+	}
+	_, err := strconv.ParseFloat(val, 64)
+	return err == nil
+}
+
+// param returns the name of the parameter for value. Known params are used
+// first, then params created for the same value before. Otherwise, a param
+// is created, named after hint.
+func (p *Parameterizer) param(hint string, value string) string {
+	if name, ok := p.knownNames[value]; ok {
+		p.values[name] = value
+		p.names[value] = name
+		return name
+	}
+	if name, ok := p.names[value]; ok {
+		return name
+	}
+	base := strings.Trim(paramNameExp.ReplaceAllString(strings.ToUpper(hint), "_"), "_")
+	name := base
+	for i := 2; ; i++ {
+		if _, taken := p.values[name]; !taken && !p.reserved[name] {
+			break
+		}
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	p.values[name] = value
+	p.names[value] = name
+	return name
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
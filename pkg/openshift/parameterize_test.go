@@ -0,0 +1,105 @@
+package openshift
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/tailor/internal/test/helper"
+)
+
+func TestExportParameterized(t *testing.T) {
+	filter, err := NewResourceFilter("dc,route,cm", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &mockOcExportClient{t: t, fixture: "parameterize.yml"}
+	p := NewParameterizer("foo-dev", map[string]string{
+		"API_URL": "https://api.example.com",
+		"UNUSED":  "unused",
+	})
+	actual, err := ExportAsTemplateFile(filter, false, p, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := string(helper.ReadGoldenFile(t, "export/parameterize.yml"))
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("Template mismatch (-want +got):\n%s", diff)
+	}
+
+	expectedValues := map[string]string{
+		"API_URL":       "https://api.example.com",
+		"BAR_REPLICAS":  "1",
+		"FOO_HOST":      "foo-foo-dev.apps.example.com",
+		"FOO_IMAGE":     "docker-registry.default.svc:5000/foo-dev/foo:latest",
+		"FOO_REPLICAS":  "2",
+		"INIT_IMAGE":    "busybox",
+		"SIDECAR_IMAGE": "docker-registry.default.svc:5000/foo-dev/sidecar:latest",
+	}
+	if diff := cmp.Diff(expectedValues, p.Values()); diff != "" {
+		t.Fatalf("Values mismatch (-want +got):\n%s", diff)
+	}
+
+	// Split templates share the params, but only contain those they use.
+	p = NewParameterizer("foo-dev", map[string]string{"API_URL": "https://api.example.com"})
+	files, err := ExportAsTemplateFiles(filter, false, "app", p, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedParams := map[string][]string{
+		"bar.yml": {"API_URL", "BAR_REPLICAS", "FOO_IMAGE", "SIDECAR_IMAGE"},
+		"foo.yml": {"API_URL", "FOO_HOST", "FOO_IMAGE", "FOO_REPLICAS", "INIT_IMAGE"},
+	}
+	actualParams := map[string][]string{}
+	for filename, exported := range files {
+		for name := range exported.Params {
+			actualParams[filename] = append(actualParams[filename], name)
+		}
+		sort.Strings(actualParams[filename])
+	}
+	if diff := cmp.Diff(expectedParams, actualParams); diff != "" {
+		t.Fatalf("Params mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParameterizeSkipsGenericValues(t *testing.T) {
+	p := NewParameterizer("foo-dev", map[string]string{
+		"API_VERSION": "v1",
+		"KIND":        "ConfigMap",
+		"DB_HOST":     "db.example.com",
+		"TIER":        "web",
+		"ENABLED":     "true",
+		"PORT":        "8080",
+	})
+	object := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "foo"},
+		"data": map[string]interface{}{
+			"host":    "db.example.com",
+			"tier":    "web",
+			"enabled": "true",
+			"port":    "8080",
+			"type":    "ConfigMap",
+		},
+	}
+	p.Parameterize([]interface{}{object})
+	expected := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "foo"},
+		"data": map[string]interface{}{
+			"host":    "${DB_HOST}",
+			"tier":    "web",
+			"enabled": "true",
+			"port":    "8080",
+			"type":    "${KIND}",
+		},
+	}
+	if diff := cmp.Diff(expected, object); diff != "" {
+		t.Fatalf("Object mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"DB_HOST": "db.example.com", "KIND": "ConfigMap"}, p.Values()); diff != "" {
+		t.Fatalf("Values mismatch (-want +got):\n%s", diff)
+	}
+}
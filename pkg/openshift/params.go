@@ -3,14 +3,11 @@ package openshift
 import (
 	"encoding/base64"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/opendevstack/tailor/pkg/cli"
 	"github.com/opendevstack/tailor/pkg/utils"
-	"golang.org/x/crypto/openpgp"
 )
 
 // DecryptedParams is used to edit/reveal secrets
@@ -22,6 +19,40 @@ func DecryptedParams(input, privateKey, passphrase string) (string, error) {
 	return transformValues(input, []converterFunc{c.decrypt})
 }
 
+// EditableParams is used to edit secrets. Other than DecryptedParams, values
+// which cannot be decrypted with the given private key (e.g. because a
+// recipients policy does not list its owner) are passed through encrypted.
+// The keys of those values are returned as well.
+func EditableParams(input, privateKey, passphrase string) (string, []string, error) {
+	c, err := newReadConverter(privateKey, passphrase)
+	if err != nil {
+		return "", nil, err
+	}
+	undecryptable := []string{}
+	output, err := transformValues(input, []converterFunc{func(key, val string) (string, string, error) {
+		newKey, newVal, err := c.decrypt(key, val)
+		if err != nil {
+			cli.DebugMsg(err.Error())
+			undecryptable = append(undecryptable, key)
+			return key, val, nil
+		}
+		return newKey, newVal, nil
+	}})
+	return output, undecryptable, err
+}
+
+// DecodedParams is used to pass params to renderers. Values are decrypted,
+// and values of keys ending in ".B64" are base64-decoded (dropping the
+// suffix), so that all values are cleartext. Values spanning multiple lines
+// cannot be passed on and are rejected.
+func DecodedParams(input, privateKey, passphrase string) (string, error) {
+	c, err := newReadConverter(privateKey, passphrase)
+	if err != nil {
+		return "", err
+	}
+	return transformValues(input, []converterFunc{c.decrypt, c.decode})
+}
+
 // EncodedParams is used to pass params to oc
 func EncodedParams(input, privateKey, passphrase string) (string, error) {
 	c, err := newReadConverter(privateKey, passphrase)
@@ -31,9 +62,12 @@ func EncodedParams(input, privateKey, passphrase string) (string, error) {
 	return transformValues(input, []converterFunc{c.decrypt, c.encode})
 }
 
-// EncryptedParams is used to save cleartext params to file
-func EncryptedParams(input, previous, publicKeyDir, privateKey, passphrase string) (string, error) {
-	c, err := newWriteConverter(previous, publicKeyDir, privateKey, passphrase)
+// EncryptedParams is used to save cleartext params to file. New values are
+// encrypted with the given encryption backend. If a policy is given, each
+// value is encrypted only for the recipients the policy defines for the key
+// in filename.
+func EncryptedParams(input, previous, filename, publicKeyDir, privateKey, passphrase, encryption string, policy *RecipientsPolicy) (string, error) {
+	c, err := newWriteConverter(previous, filename, publicKeyDir, privateKey, passphrase, encryption, policy)
 	if err != nil {
 		return "", err
 	}
@@ -41,9 +75,17 @@ func EncryptedParams(input, previous, publicKeyDir, privateKey, passphrase strin
 }
 
 type paramConverter struct {
-	PublicEntityList  openpgp.EntityList
-	PrivateEntityList openpgp.EntityList
-	PreviousParams    map[string]string
+	Backends       map[string]utils.EncryptionBackend
+	Encryption     string
+	PreviousParams map[string]string
+	Filename       string
+	KeyFiles       map[string]string
+	PublicKeyDir   string
+	Policy         *RecipientsPolicy
+	// recipientBackends caches the backends per set of recipients.
+	recipientBackends map[string]map[string]utils.EncryptionBackend
+	// publicKeys is read when kept values need to be audited.
+	publicKeys publicKeys
 }
 
 func (c *paramConverter) encode(key, val string) (string, string, error) {
@@ -54,45 +96,137 @@ func (c *paramConverter) encode(key, val string) (string, string, error) {
 	return key, base64.StdEncoding.EncodeToString([]byte(val)), nil
 }
 
-// Decrypt given string
+func (c *paramConverter) decode(key, val string) (string, string, error) {
+	if !strings.HasSuffix(key, ".B64") {
+		return key, val, checkSingleLine(key, val)
+	}
+	key = strings.TrimSuffix(key, ".B64")
+	b, err := base64.StdEncoding.DecodeString(val)
+	if err != nil {
+		return key, val, fmt.Errorf("Could not decode %s: %s", key, err)
+	}
+	return key, string(b), checkSingleLine(key, string(b))
+}
+
+// checkSingleLine returns an error if the cleartext value of key spans
+// multiple lines, as it would break the KEY=VALUE format of params.
+func checkSingleLine(key, val string) error {
+	if strings.ContainsAny(val, "\r\n") {
+		return fmt.Errorf("Value of %s spans multiple lines, which is only supported for templates", key)
+	}
+	return nil
+}
+
+// Decrypt given string with the backend it was encrypted with.
 func (c *paramConverter) decrypt(key, val string) (string, string, error) {
-	newVal, err := utils.Decrypt(val, c.PrivateEntityList)
-	return key, newVal, err
+	encryption := utils.EncryptionOf(val)
+	newVal, err := c.Backends[encryption].Decrypt(val)
+	if err != nil {
+		return key, newVal, fmt.Errorf("Could not decrypt %s (encrypted with %s): %s", key, encryption, err)
+	}
+	return key, newVal, nil
 }
 
 // Encrypt encrypts given value. If the key was already present previously
 // and the cleartext value did not change, then the previous encrypted string
-// is returned.
+// is returned - unless it was encrypted with another backend. If the value
+// is the unchanged previous encrypted string (see EditableParams), it is
+// kept as-is, provided it is encrypted for the expected recipients. As it
+// cannot be decrypted, it cannot be re-encrypted for other recipients.
 func (c *paramConverter) encrypt(key, val string) (string, string, error) {
 	if c.PreviousParams != nil {
 		if _, exists := c.PreviousParams[key]; exists {
 			previousEncryptedValue := c.PreviousParams[key]
+			if previousEncryptedValue == val {
+				err := c.checkKeptRecipients(key, val)
+				if err != nil {
+					return key, "", err
+				}
+				cli.DebugMsg(fmt.Sprintf("Keeping encrypted value of %s", key))
+				return key, val, nil
+			}
 			key, previousDecryptedValue, err := c.decrypt(key, previousEncryptedValue)
 			if err != nil {
 				// When decrypting fails, we display the error, but continue
 				// as we can still encrypt ...
 				cli.DebugMsg(err.Error())
 			}
-			if previousDecryptedValue == val {
+			if previousDecryptedValue == val && utils.EncryptionOf(previousEncryptedValue) == c.Encryption {
 				return key, previousEncryptedValue, nil
 			}
 		}
 	}
-	newVal, err := utils.Encrypt(val, c.PublicEntityList)
+	backends, err := c.backendsFor(key)
+	if err != nil {
+		return key, "", err
+	}
+	newVal, err := backends[c.Encryption].Encrypt(val)
 	return key, newVal, err
 }
 
+// checkKeptRecipients returns an error if the encrypted value of key, which
+// is kept as-is, is not encrypted for the expected recipients.
+func (c *paramConverter) checkKeptRecipients(key, val string) error {
+	if c.publicKeys == nil {
+		keys, err := readPublicKeys(c.PublicKeyDir)
+		if err != nil {
+			return err
+		}
+		c.publicKeys = keys
+	}
+	problems := c.publicKeys.audit(c.Filename, key, val, c.Policy)
+	if len(problems) > 0 {
+		return fmt.Errorf(
+			"%s cannot be kept as it is not encrypted for the expected recipients (%s), and cannot be re-encrypted as you cannot decrypt it. Ask one of its recipients to re-encrypt it",
+			key,
+			strings.Join(problems, "; "),
+		)
+	}
+	return nil
+}
+
+// backendsFor returns the backends encrypting for the recipients of key. If
+// there is no policy, all public keys are recipients.
+func (c *paramConverter) backendsFor(key string) (map[string]utils.EncryptionBackend, error) {
+	if c.Policy == nil {
+		return c.Backends, nil
+	}
+	recipients, err := c.Policy.RecipientsFor(c.Filename, key)
+	if err != nil {
+		return nil, err
+	}
+	id := strings.Join(recipients, ",")
+	if backends, ok := c.recipientBackends[id]; ok {
+		return backends, nil
+	}
+	files := []string{}
+	for _, r := range recipients {
+		f, ok := c.KeyFiles[r]
+		if !ok {
+			return nil, fmt.Errorf("No public key found for recipient '%s' of %s", r, key)
+		}
+		files = append(files, f)
+	}
+	cli.DebugMsg(fmt.Sprintf("Encrypting %s for %s", key, id))
+	backends, err := utils.NewEncryptionBackends(files, "", "")
+	if err != nil {
+		return nil, err
+	}
+	c.recipientBackends[id] = backends
+	return backends, nil
+}
+
 type converterFunc func(key, val string) (string, string, error)
 
 func newReadConverter(privateKey, passphrase string) (*paramConverter, error) {
-	el, err := utils.GetEntityList([]string{privateKey}, passphrase)
+	backends, err := utils.NewEncryptionBackends([]string{}, privateKey, passphrase)
 	if err != nil {
 		return nil, err
 	}
-	return &paramConverter{PrivateEntityList: el}, nil
+	return &paramConverter{Backends: backends}, nil
 }
 
-func newWriteConverter(previous, publicKeyDir, privateKey, passphrase string) (*paramConverter, error) {
+func newWriteConverter(previous, filename, publicKeyDir, privateKey, passphrase, encryption string, policy *RecipientsPolicy) (*paramConverter, error) {
 	// Read previous params
 	previousParams := map[string]string{}
 	err := extractKeyValuePairs(previous, func(key, val string) error {
@@ -103,53 +237,41 @@ func newWriteConverter(previous, publicKeyDir, privateKey, passphrase string) (*
 		return nil, err
 	}
 
-	// Prefer "public-keys" folder over current directory
-	if publicKeyDir == "." {
-		if _, err := os.Stat("public-keys"); err == nil {
-			publicKeyDir = "public-keys"
-		}
-	}
-
 	// Read public keys
 	cli.DebugMsg(fmt.Sprintf("Looking for public keys in '%s'", publicKeyDir))
-	files, err := ioutil.ReadDir(publicKeyDir)
+	_, keyFiles, err := publicKeyFiles(publicKeyDir)
 	if err != nil {
 		return nil, err
 	}
-	filePattern := ".*\\.key$"
-	re := regexp.MustCompile(filePattern)
-	keyFiles := []string{}
-	for _, file := range files {
-		if strings.HasSuffix(file.Name(), "private.key") {
-			continue
-		}
-		matched := re.MatchString(file.Name())
-		if !matched {
-			continue
-		}
-		keyFiles = append(keyFiles, publicKeyDir+string(os.PathSeparator)+file.Name())
+	names := []string{}
+	for name := range keyFiles {
+		names = append(names, name)
 	}
-	if len(keyFiles) == 0 {
-		return nil, fmt.Errorf(
-			"No public key files found in '%s'. Files need to end in '.key'",
-			publicKeyDir,
-		)
+	sort.Strings(names)
+	files := []string{}
+	for _, name := range names {
+		files = append(files, keyFiles[name])
 	}
 
-	publicEntityList, err := utils.GetEntityList(keyFiles, "")
+	backends, err := utils.NewEncryptionBackends(files, privateKey, passphrase)
 	if err != nil {
 		return nil, err
 	}
-
-	privateEntityList, err := utils.GetEntityList([]string{privateKey}, passphrase)
-	if err != nil {
-		return nil, err
+	backend, ok := backends[encryption]
+	if !ok {
+		return nil, fmt.Errorf("Unknown encryption '%s'", encryption)
 	}
+	cli.DebugMsg("Encrypting with", backend.Name())
 
 	return &paramConverter{
-		PublicEntityList:  publicEntityList,
-		PrivateEntityList: privateEntityList,
+		Backends:          backends,
+		Encryption:        encryption,
 		PreviousParams:    previousParams,
+		Filename:          filename,
+		KeyFiles:          keyFiles,
+		PublicKeyDir:      publicKeyDir,
+		Policy:            policy,
+		recipientBackends: map[string]map[string]utils.EncryptionBackend{},
 	}, nil
 }
 
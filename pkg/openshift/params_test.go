@@ -2,8 +2,12 @@ package openshift
 
 import (
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/opendevstack/tailor/pkg/utils"
 )
 
 func TestDecryptedParams(t *testing.T) {
@@ -20,6 +24,22 @@ func TestDecryptedParams(t *testing.T) {
 	}
 }
 
+func TestDecodedParams(t *testing.T) {
+	input := readFileContent(t, "test-encrypted.env")
+	actual, err := DecodedParams(input, "test-private.key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "FOO=secret\nBAR=secret\n"
+	if actual != expected {
+		t.Errorf("Mismatch, got: %v, want: %v.", actual, expected)
+	}
+	_, _, err = (&paramConverter{}).decode("KEY.B64", "YQpi")
+	if err == nil || err.Error() != "Value of KEY spans multiple lines, which is only supported for templates" {
+		t.Errorf("Expected error for multi-line value, got: %v", err)
+	}
+}
+
 func TestEncodedParams(t *testing.T) {
 	input := readFileContent(t, "test-encrypted.env")
 	t.Logf("Read input: %s", input)
@@ -41,7 +61,7 @@ func TestEncryptedParams(t *testing.T) {
 	// Add one additional line ...
 	input = input + "BAZ=baz\n"
 	t.Logf("Read input: %s", input)
-	actual, err := EncryptedParams(input, previous, ".", "test-private.key", "")
+	actual, err := EncryptedParams(input, previous, "foo.env.enc", ".", "test-private.key", "", "pgp", nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -69,3 +89,49 @@ func readFileContent(t *testing.T, filename string) string {
 	}
 	return string(bytes)
 }
+
+func TestEncryptedParamsAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	identity, err := utils.GenerateAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := filepath.Join(dir, "john-doe.key")
+	privateKey := filepath.Join(dir, "age-private.key")
+	err = utils.PrintAgeKeys(identity, "John Doe <john.doe@example.com>", publicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Migrate values encrypted with PGP to age
+	previous := readFileContent(t, "test-encrypted.env")
+	cleartext := readFileContent(t, "test-cleartext.env")
+	actual, err := EncryptedParams(cleartext, previous, "foo.env.enc", dir, "test-private.key", "", "age", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(actual, "\n"), "\n") {
+		if !strings.Contains(line, "=age:") {
+			t.Fatalf("Expected value encrypted with age, got: %s", line)
+		}
+	}
+
+	revealed, err := DecryptedParams(actual, privateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revealed != cleartext {
+		t.Fatalf("Mismatch, got: %v, want: %v.", revealed, cleartext)
+	}
+
+	// PGP values cannot be read with an age key
+	mixed := actual + strings.SplitN(previous, "\n", 2)[0] + "\n"
+	_, err = DecryptedParams(mixed, privateKey, "")
+	if err == nil || !strings.Contains(err.Error(), "encrypted with pgp") {
+		t.Fatalf("Expected error for PGP value, got: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package openshift
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// PlanKind is the kind of a saved plan. Plans share the API version of the
+// machine-readable changeset format.
+const PlanKind = "Plan"
+
+// Plan is a changeset saved for later application. Besides the desired state
+// of each change, it records the fingerprint of the current state, so that
+// applying the plan can be refused if the current state changed meanwhile.
+type Plan struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Namespace  string           `json:"namespace"`
+	Selector   string           `json:"selector,omitempty"`
+	Summary    ChangesetSummary `json:"summary"`
+	Changes    []*PlannedChange `json:"changes"`
+}
+
+// PlannedChange is a change within a plan.
+type PlannedChange struct {
+	Action       string      `json:"action"`
+	Kind         string      `json:"kind"`
+	Name         string      `json:"name"`
+	After        []string    `json:"after,omitempty"`
+	Fingerprint  string      `json:"fingerprint,omitempty"`
+	DesiredState interface{} `json:"desiredState,omitempty"`
+}
+
+// NewPlan creates a plan of given changeset. Changes are stored in the order
+// in which they are applied.
+func NewPlan(namespace string, selector string, changeset *Changeset) (*Plan, error) {
+	p := &Plan{
+		APIVersion: ChangesetReportAPIVersion,
+		Kind:       PlanKind,
+		Namespace:  namespace,
+		Selector:   selector,
+		Summary: ChangesetSummary{
+			InSync: len(changeset.Noop),
+			Create: len(changeset.Create),
+			Update: len(changeset.Update),
+			Delete: len(changeset.Delete),
+		},
+		Changes: []*PlannedChange{},
+	}
+	for _, change := range changeset.Ordered() {
+		desiredState, err := unmarshalState(change.DesiredState, false)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse desired state of %s: %s", change.ItemName(), err)
+		}
+		p.Changes = append(p.Changes, &PlannedChange{
+			Action:       change.Action,
+			Kind:         change.Kind,
+			Name:         change.Name,
+			After:        change.After,
+			Fingerprint:  change.Fingerprint,
+			DesiredState: desiredState,
+		})
+	}
+	return p, nil
+}
+
+// ReadPlan parses a plan written by Marshal.
+func ReadPlan(b []byte) (*Plan, error) {
+	p := &Plan{}
+	err := yaml.Unmarshal(b, p)
+	if err != nil {
+		return nil, err
+	}
+	if p.Kind != PlanKind {
+		return nil, fmt.Errorf("Expected kind %s, got '%s'", PlanKind, p.Kind)
+	}
+	if p.APIVersion != ChangesetReportAPIVersion {
+		return nil, fmt.Errorf("Unsupported plan version '%s', expected %s", p.APIVersion, ChangesetReportAPIVersion)
+	}
+	for _, c := range p.Changes {
+		if !(c.Action == "Create" || c.Action == "Update" || c.Action == "Delete") {
+			return nil, fmt.Errorf("Unknown action '%s' for %s/%s", c.Action, c.Kind, c.Name)
+		}
+		if c.Action != "Create" && len(c.Fingerprint) == 0 {
+			return nil, fmt.Errorf("Missing fingerprint for %s/%s", c.Kind, c.Name)
+		}
+	}
+	return p, nil
+}
+
+// Marshal serializes the plan as YAML.
+func (p *Plan) Marshal() ([]byte, error) {
+	return yaml.Marshal(p)
+}
+
+// Kinds returns the kinds affected by the plan, in lowercase.
+func (p *Plan) Kinds() []string {
+	kinds := []string{}
+	for _, c := range p.Changes {
+		kind := strings.ToLower(c.Kind)
+		found := false
+		for _, k := range kinds {
+			if k == kind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+// Changeset turns the plan back into a changeset which can be applied.
+// Changes keep the order of the plan. The current state is not known.
+func (p *Plan) Changeset() (*Changeset, error) {
+	c := &Changeset{
+		Create: []*Change{},
+		Delete: []*Change{},
+		Update: []*Change{},
+		Noop:   []*Change{},
+	}
+	for _, pc := range p.Changes {
+		change := &Change{
+			Action:      pc.Action,
+			Kind:        pc.Kind,
+			Name:        pc.Name,
+			After:       pc.After,
+			Fingerprint: pc.Fingerprint,
+		}
+		if pc.DesiredState != nil {
+			b, err := yaml.Marshal(pc.DesiredState)
+			if err != nil {
+				return nil, fmt.Errorf("Could not marshal desired state of %s: %s", change.ItemName(), err)
+			}
+			change.DesiredState = string(b)
+		}
+		switch change.Action {
+		case "Create":
+			c.Create = append(c.Create, change)
+		case "Delete":
+			c.Delete = append(c.Delete, change)
+		case "Update":
+			c.Update = append(c.Update, change)
+		}
+		c.order = append(c.order, change)
+	}
+	return c, nil
+}
+
+// Verify checks that the current state of the resources in platformBasedList
+// still matches the state the plan was made for: resources to create must not
+// exist, and resources to update or delete must have the same fingerprint.
+// Resources which are re-created are only checked by the fingerprint of their
+// deletion.
+func (p *Plan) Verify(platformBasedList *ResourceList) error {
+	deleted := map[string]bool{}
+	for _, pc := range p.Changes {
+		if pc.Action == "Delete" {
+			deleted[pc.Kind+"/"+pc.Name] = true
+		}
+	}
+	stale := []string{}
+	for _, pc := range p.Changes {
+		name := (&Change{Kind: pc.Kind, Name: pc.Name}).ItemName()
+		item, err := platformBasedList.getItem(pc.Kind, pc.Name)
+		if pc.Action == "Create" {
+			if err == nil && !deleted[pc.Kind+"/"+pc.Name] {
+				stale = append(stale, name+" exists already")
+			}
+			continue
+		}
+		if err != nil {
+			stale = append(stale, name+" does not exist anymore")
+		} else if item.Fingerprint() != pc.Fingerprint {
+			stale = append(stale, name+" has changed")
+		}
+	}
+	if len(stale) > 0 {
+		return errors.New(
+			"Current state has changed since the plan was made:\n* " +
+				strings.Join(stale, "\n* "),
+		)
+	}
+	return nil
+}
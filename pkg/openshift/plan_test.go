@@ -0,0 +1,210 @@
+package openshift
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlan(t *testing.T) {
+	platformInput := []byte(
+		`kind: Template
+apiVersion: v1
+objects:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: foo
+  data:
+    bar: baz
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: old
+  data:
+    bar: baz`)
+
+	templateInput := []byte(
+		`kind: List
+apiVersion: v1
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: foo
+  data:
+    bar: qux
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: new
+  data:
+    bar: baz`)
+
+	filter, err := NewResourceFilter("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changeset := getChangeset(t, filter, platformInput, templateInput, false, false, []string{})
+	plan, err := NewPlan("foo-dev", "app=foo", changeset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := plan.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err = ReadPlan(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions := []string{}
+	for _, c := range plan.Changes {
+		actions = append(actions, c.Action+" "+c.Kind+"/"+c.Name)
+		if c.Action != "Create" && !strings.HasPrefix(c.Fingerprint, "sha256:") {
+			t.Fatalf("Expected fingerprint for %s/%s, got: %s", c.Kind, c.Name, c.Fingerprint)
+		}
+	}
+	expectedActions := []string{"Create ConfigMap/new", "Delete ConfigMap/old", "Update ConfigMap/foo"}
+	if diff := cmp.Diff(expectedActions, actions); diff != "" {
+		t.Fatalf("Planned changes mismatch (-want +got):\n%s", diff)
+	}
+
+	c, err := plan.Changeset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(changeset.Update[0].DesiredState, c.Update[0].DesiredState); diff != "" {
+		t.Fatalf("Desired state mismatch (-want +got):\n%s", diff)
+	}
+
+	// Unchanged current state
+	platformBasedList, err := NewPlatformBasedResourceList(filter, platformInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = plan.Verify(platformBasedList)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changed current state
+	changedPlatformInput := []byte(
+		`kind: Template
+apiVersion: v1
+objects:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: foo
+  data:
+    bar: changed
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: new
+  data:
+    bar: baz`)
+	platformBasedList, err = NewPlatformBasedResourceList(filter, changedPlatformInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = plan.Verify(platformBasedList)
+	if err == nil {
+		t.Fatal("Expected plan to be stale")
+	}
+	expectedErr := `Current state has changed since the plan was made:
+* cm/new exists already
+* cm/old does not exist anymore
+* cm/foo has changed`
+	if diff := cmp.Diff(expectedErr, err.Error()); diff != "" {
+		t.Fatalf("Error mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPlanRecreation(t *testing.T) {
+	platformInput := []byte(
+		`kind: Template
+apiVersion: v1
+objects:
+- ` + strings.Replace(string(getRoute([]byte("old.com"))), "\n", "\n  ", -1))
+	templateInput := []byte(
+		`kind: List
+apiVersion: v1
+items:
+- ` + strings.Replace(string(getRoute([]byte("new.com"))), "\n", "\n  ", -1))
+
+	filter, err := NewResourceFilter("route", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changeset := getChangeset(t, filter, platformInput, templateInput, false, true, []string{})
+	plan, err := NewPlan("foo-dev", "", changeset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := []string{}
+	for _, c := range plan.Changes {
+		actions = append(actions, c.Action+" "+c.Kind+"/"+c.Name)
+	}
+	expectedActions := []string{"Delete Route/foo", "Create Route/foo"}
+	if diff := cmp.Diff(expectedActions, actions); diff != "" {
+		t.Fatalf("Planned changes mismatch (-want +got):\n%s", diff)
+	}
+
+	// Unchanged current state
+	platformBasedList, err := NewPlatformBasedResourceList(filter, platformInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = plan.Verify(platformBasedList)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changed current state
+	changedPlatformInput := bytes.Replace(platformInput, []byte("old.com"), []byte("other.com"), -1)
+	platformBasedList, err = NewPlatformBasedResourceList(filter, changedPlatformInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = plan.Verify(platformBasedList)
+	expectedErr := `Current state has changed since the plan was made:
+* route/foo has changed`
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("Expected error '%s', got: %v", expectedErr, err)
+	}
+}
+
+func TestReadPlanInvalid(t *testing.T) {
+	tests := map[string]struct {
+		input       string
+		expectedErr string
+	}{
+		"Wrong kind": {
+			input:       "apiVersion: tailor.opendevstack.org/v1alpha1\nkind: Changeset\n",
+			expectedErr: "Expected kind Plan, got 'Changeset'",
+		},
+		"Missing fingerprint": {
+			input: `apiVersion: tailor.opendevstack.org/v1alpha1
+kind: Plan
+changes:
+- action: Delete
+  kind: ConfigMap
+  name: foo`,
+			expectedErr: "Missing fingerprint for ConfigMap/foo",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ReadPlan([]byte(tc.input))
+			if err == nil || err.Error() != tc.expectedErr {
+				t.Fatalf("Expected error '%s', got: %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package openshift
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/opendevstack/tailor/pkg/cli"
+	"github.com/opendevstack/tailor/pkg/utils"
+)
+
+const (
+	generatorAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	generatorNumerals = "0123456789"
+	generatorSymbols  = "~!@#$%^&*()-_+={}[]\\|<,>.?/\"';:`"
+	// Same limit as the OpenShift expression generator.
+	generatorMaxLength = 255
+)
+
+var (
+	stringParameterExp    = regexp.MustCompile(`\$\{([a-zA-Z0-9\_]+?)\}`)
+	nonStringParameterExp = regexp.MustCompile(`\$\{\{([a-zA-Z0-9\_]+?)\}\}`)
+	generatorExp          = regexp.MustCompile(`\[([^\]]+)\]\{([0-9]+)\}`)
+	generatorRangeExp     = regexp.MustCompile(`\\[wdaA]|.-.|.`)
+)
+
+type templateParameter struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Generate string `json:"generate"`
+	From     string `json:"from"`
+	Required bool   `json:"required"`
+}
+
+type processableTemplate struct {
+	Objects    []interface{}       `json:"objects"`
+	Parameters []templateParameter `json:"parameters"`
+	Labels     map[string]string   `json:"labels"`
+}
+
+// processTemplateLocally processes the given template in the same way as
+// "oc process" does, without the need for an "oc" binary or a session.
+// params are given as KEY=VALUE, and take precedence over the values in
+// paramFileBytes (in .env format). labels is a comma-separated list of
+// key=value pairs which are added to all objects. The result is a list.
+func processTemplateLocally(templateBytes []byte, labels string, params []string, paramFileBytes []byte, ignoreUnknownParameters bool) ([]byte, error) {
+	t := processableTemplate{}
+	err := yaml.Unmarshal(templateBytes, &t)
+	if err != nil {
+		return nil, utils.DisplaySyntaxError(templateBytes, err)
+	}
+
+	values, err := parameterValues(params, paramFileBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := resolveTemplateParameters(t.Parameters, values, ignoreUnknownParameters)
+	if err != nil {
+		return nil, err
+	}
+
+	objectLabels := map[string]string{}
+	for k, v := range t.Labels {
+		objectLabels[substituteParameters(k, resolved)] = substituteParameters(v, resolved)
+	}
+	givenLabels, err := parseLabels(labels)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range givenLabels {
+		objectLabels[k] = v
+	}
+
+	items := []interface{}{}
+	for _, object := range t.Objects {
+		item := visitStrings(object, resolved)
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("template object is not a map")
+		}
+		addObjectLabels(m, objectLabels)
+		items = append(items, m)
+	}
+
+	list := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"metadata":   map[string]interface{}{},
+		"items":      items,
+	}
+	return yaml.Marshal(list)
+}
+
+// parameterValues returns the values of params (given as KEY=VALUE), which
+// take precedence over the values in paramFileBytes (in .env format).
+func parameterValues(params []string, paramFileBytes []byte) (map[string]string, error) {
+	values := map[string]string{}
+	err := extractKeyValuePairs(string(paramFileBytes), func(key, val string) error {
+		values[key] = val
+		return nil
+	}, func(line string) {})
+	if err != nil {
+		return nil, err
+	}
+	for _, param := range params {
+		pair := strings.SplitN(param, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid parameter assignment in %q: expected KEY=VALUE", param)
+		}
+		values[pair[0]] = pair[1]
+	}
+	return values, nil
+}
+
+// parseLabels parses a comma-separated list of key=value pairs.
+func parseLabels(labels string) (map[string]string, error) {
+	parsed := map[string]string{}
+	if len(labels) == 0 {
+		return parsed, nil
+	}
+	for _, label := range strings.Split(labels, ",") {
+		pair := strings.SplitN(label, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid label spec: %s", label)
+		}
+		parsed[pair[0]] = pair[1]
+	}
+	return parsed, nil
+}
+
+// resolveTemplateParameters determines the value of each template parameter.
+// Given values win over values in the template, which win over generated
+// values. Required parameters must end up with a value.
+func resolveTemplateParameters(parameters []templateParameter, values map[string]string, ignoreUnknownParameters bool) (map[string]string, error) {
+	known := map[string]bool{}
+	for _, p := range parameters {
+		known[p.Name] = true
+	}
+	for name := range values {
+		if !known[name] {
+			if !ignoreUnknownParameters {
+				return nil, fmt.Errorf("unknown parameter name %q", name)
+			}
+			cli.DebugMsg("Ignoring unknown parameter", name)
+		}
+	}
+
+	resolved := map[string]string{}
+	for i, p := range parameters {
+		value := p.Value
+		if v, ok := values[p.Name]; ok {
+			value = v
+		} else if len(p.Generate) > 0 && len(value) == 0 {
+			if p.Generate != "expression" {
+				return nil, fmt.Errorf("template.parameters[%d]: Unknown generator name %q", i, p.Generate)
+			}
+			generated, err := generateExpressionValue(p.From)
+			if err != nil {
+				return nil, fmt.Errorf("template.parameters[%d]: %s", i, err)
+			}
+			value = generated
+		}
+		if p.Required && len(value) == 0 {
+			return nil, fmt.Errorf("template.parameters[%d]: parameter %s is required and must be specified", i, p.Name)
+		}
+		resolved[p.Name] = value
+	}
+	return resolved, nil
+}
+
+// visitStrings substitutes parameters in all strings (including map keys)
+// of v. A string consisting of a non-string parameter reference such as
+// "${{REPLICAS}}" is replaced by the JSON value of the parameter, if the
+// substituted string is valid JSON.
+func visitStrings(v interface{}, params map[string]string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, e := range val {
+			m[substituteParameters(k, params)] = visitStrings(e, params)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(val))
+		for i, e := range val {
+			s[i] = visitStrings(e, params)
+		}
+		return s
+	case string:
+		substituted := substituteParameters(val, params)
+		if nonStringParameterExp.MatchString(val) {
+			var x interface{}
+			if err := json.Unmarshal([]byte(substituted), &x); err == nil {
+				return x
+			}
+		}
+		return substituted
+	default:
+		return v
+	}
+}
+
+// substituteParameters replaces "${{NAME}}" and "${NAME}" references with
+// the value of the parameter. References to unknown parameters are kept.
+func substituteParameters(s string, params map[string]string) string {
+	replace := func(exp *regexp.Regexp) func(string) string {
+		return func(match string) string {
+			name := exp.FindStringSubmatch(match)[1]
+			if v, ok := params[name]; ok {
+				return v
+			}
+			return match
+		}
+	}
+	s = nonStringParameterExp.ReplaceAllStringFunc(s, replace(nonStringParameterExp))
+	return stringParameterExp.ReplaceAllStringFunc(s, replace(stringParameterExp))
+}
+
+// addObjectLabels merges labels into the labels of the object, overwriting
+// existing labels with the same key.
+func addObjectLabels(m map[string]interface{}, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	metadata, ok := m["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = map[string]interface{}{}
+		m["metadata"] = metadata
+	}
+	objectLabels, ok := metadata["labels"].(map[string]interface{})
+	if !ok {
+		objectLabels = map[string]interface{}{}
+		metadata["labels"] = objectLabels
+	}
+	for k, v := range labels {
+		objectLabels[k] = v
+	}
+}
+
+// generateExpressionValue generates a random value matching the expression
+// given in "from", e.g. "[a-zA-Z0-9]{16}" or "admin[\d]{4}". Besides ranges
+// and single characters, the classes \w (letters, digits and underscore),
+// \d (digits), \a (letters) and \A (symbols) are supported.
+func generateExpressionValue(from string) (string, error) {
+	if len(from) == 0 {
+		return "", errors.New("generator expression must not be empty")
+	}
+	var genErr error
+	result := generatorExp.ReplaceAllStringFunc(from, func(match string) string {
+		parts := generatorExp.FindStringSubmatch(match)
+		length, err := strconv.Atoi(parts[2])
+		if err != nil || length <= 0 || length > generatorMaxLength {
+			genErr = fmt.Errorf("range must be within [1-%d] characters (%s)", generatorMaxLength, parts[2])
+			return ""
+		}
+		alphabet, err := generatorAlphabetFor(parts[1])
+		if err != nil {
+			genErr = err
+			return ""
+		}
+		var sb strings.Builder
+		max := big.NewInt(int64(len(alphabet)))
+		for i := 0; i < length; i++ {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				genErr = err
+				return ""
+			}
+			sb.WriteByte(alphabet[n.Int64()])
+		}
+		return sb.String()
+	})
+	if genErr != nil {
+		return "", genErr
+	}
+	return result, nil
+}
+
+func generatorAlphabetFor(expression string) (string, error) {
+	alphabet := ""
+	for _, r := range generatorRangeExp.FindAllString(expression, -1) {
+		switch {
+		case r == `\w`:
+			alphabet += generatorAlphabet + generatorNumerals + "_"
+		case r == `\d`:
+			alphabet += generatorNumerals
+		case r == `\a`:
+			alphabet += generatorAlphabet
+		case r == `\A`:
+			alphabet += generatorSymbols
+		case len(r) == 3 && r[1] == '-':
+			if r[0] > r[2] {
+				return "", fmt.Errorf("invalid range specified: %s", r)
+			}
+			for c := r[0]; c <= r[2]; c++ {
+				alphabet += string(c)
+			}
+		default:
+			alphabet += r
+		}
+	}
+	if len(alphabet) == 0 {
+		return "", fmt.Errorf("invalid generator expression: [%s]", expression)
+	}
+	return alphabet, nil
+}
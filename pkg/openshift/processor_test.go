@@ -0,0 +1,216 @@
+package openshift
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProcessTemplateLocally(t *testing.T) {
+	template := []byte(
+		`apiVersion: v1
+kind: Template
+labels:
+  template: foo-${SUFFIX}
+objects:
+- apiVersion: v1
+  kind: DeploymentConfig
+  metadata:
+    labels:
+      app: foo
+    name: foo-${SUFFIX}
+  spec:
+    replicas: ${{REPLICAS}}
+    paused: ${{PAUSED}}
+    template:
+      spec:
+        containers:
+        - image: ${IMAGE}:${TAG}
+          name: foo
+          env:
+          - name: UNKNOWN
+            value: ${UNKNOWN}
+          - name: QUOTED
+            value: "${{NOT_JSON}}"
+parameters:
+- name: SUFFIX
+  required: true
+- name: REPLICAS
+  value: "1"
+- name: PAUSED
+  value: "false"
+- name: IMAGE
+  value: foo
+- name: TAG
+  value: latest
+- name: NOT_JSON
+  value: foo bar`)
+
+	tests := map[string]struct {
+		labels                  string
+		params                  []string
+		paramFile               string
+		ignoreUnknownParameters bool
+		expected                string
+		expectedErr             string
+	}{
+		"Substitutes values from params and param files": {
+			labels:    "team=bar",
+			params:    []string{"SUFFIX=x", "TAG=v2"},
+			paramFile: "# comment\nREPLICAS=3\nTAG=v1\n",
+			expected: `apiVersion: v1
+items:
+- apiVersion: v1
+  kind: DeploymentConfig
+  metadata:
+    labels:
+      app: foo
+      team: bar
+      template: foo-x
+    name: foo-x
+  spec:
+    paused: false
+    replicas: 3
+    template:
+      spec:
+        containers:
+        - env:
+          - name: UNKNOWN
+            value: ${UNKNOWN}
+          - name: QUOTED
+            value: foo bar
+          image: foo:v2
+          name: foo
+kind: List
+metadata: {}
+`,
+		},
+		"Fails on missing required param": {
+			expectedErr: "template.parameters[0]: parameter SUFFIX is required and must be specified",
+		},
+		"Fails on unknown param": {
+			params:      []string{"SUFFIX=x", "FOO=bar"},
+			expectedErr: `unknown parameter name "FOO"`,
+		},
+		"Ignores unknown param if requested": {
+			params:                  []string{"SUFFIX=x"},
+			paramFile:               "FOO=bar",
+			ignoreUnknownParameters: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, err := processTemplateLocally(template, tc.labels, tc.params, []byte(tc.paramFile), tc.ignoreUnknownParameters)
+			if len(tc.expectedErr) > 0 {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Fatalf("Expected error '%s', got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tc.expected) > 0 {
+				if diff := cmp.Diff(tc.expected, string(b)); diff != "" {
+					t.Fatalf("Processed template mismatch (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessTemplateLocallyGenerate(t *testing.T) {
+	template := []byte(
+		`apiVersion: v1
+kind: Template
+objects:
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: foo
+  stringData:
+    password: ${PASSWORD}
+    user: ${USER}
+    given: ${GIVEN}
+parameters:
+- name: PASSWORD
+  generate: expression
+  from: "[a-zA-Z0-9]{16}"
+- name: USER
+  generate: expression
+  from: "admin[\\d]{4}"
+- name: GIVEN
+  generate: expression
+  from: "[\\w]{8}"`)
+
+	b, err := processTemplateLocally(template, "", []string{"GIVEN=fixed"}, []byte{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list map[string]interface{}
+	err = yaml.Unmarshal(b, &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stringData := list["items"].([]interface{})[0].(map[string]interface{})["stringData"].(map[string]interface{})
+	if !regexp.MustCompile(`^[a-zA-Z0-9]{16}$`).MatchString(stringData["password"].(string)) {
+		t.Fatalf("Generated password does not match expression: %s", stringData["password"])
+	}
+	if !regexp.MustCompile(`^admin[0-9]{4}$`).MatchString(stringData["user"].(string)) {
+		t.Fatalf("Generated user does not match expression: %s", stringData["user"])
+	}
+	if stringData["given"] != "fixed" {
+		t.Fatalf("Expected given value to win over generator, got: %s", stringData["given"])
+	}
+}
+
+func TestGenerateExpressionValue(t *testing.T) {
+	tests := map[string]struct {
+		from        string
+		expected    *regexp.Regexp
+		expectedErr string
+	}{
+		"Range": {
+			from:     "[a-f]{10}",
+			expected: regexp.MustCompile(`^[a-f]{10}$`),
+		},
+		"Symbols": {
+			from:     `[\A]{5}`,
+			expected: regexp.MustCompile("^[" + regexp.QuoteMeta(generatorSymbols) + "]{5}$"),
+		},
+		"Letters and literal": {
+			from:     `x-[\a]{3}-y`,
+			expected: regexp.MustCompile(`^x-[a-zA-Z]{3}-y$`),
+		},
+		"Too long": {
+			from:        "[a-z]{256}",
+			expectedErr: "range must be within",
+		},
+		"Invalid range": {
+			from:        "[z-a]{2}",
+			expectedErr: "invalid range specified",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			v, err := generateExpressionValue(tc.from)
+			if len(tc.expectedErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("Expected error containing '%s', got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.expected.MatchString(v) {
+				t.Fatalf("Value %s does not match %s", v, tc.expected)
+			}
+		})
+	}
+}
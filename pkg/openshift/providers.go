@@ -0,0 +1,206 @@
+package openshift
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/opendevstack/tailor/pkg/cli"
+)
+
+// SecretProvider resolves references to values which are stored outside of
+// param files, such as "${exec:./get-secret.sh prod/db}". Resolved values are
+// kept in memory only.
+type SecretProvider interface {
+	// Scheme is the prefix of the references handled by the provider,
+	// e.g. "exec" for "${exec:...}".
+	Scheme() string
+	// Resolve returns the value of the reference (without scheme).
+	Resolve(ref string) (string, error)
+}
+
+var secretProviders = map[string]SecretProvider{}
+
+func init() {
+	RegisterSecretProvider(&execSecretProvider{})
+	RegisterSecretProvider(&fileSecretProvider{})
+	RegisterSecretProvider(&vaultSecretProvider{})
+}
+
+// RegisterSecretProvider makes a provider available to param files. A
+// provider registered for an existing scheme replaces the previous one.
+func RegisterSecretProvider(p SecretProvider) {
+	secretProviders[p.Scheme()] = p
+}
+
+// secretProviderOf returns the provider for the reference in val, if any.
+// References must span the whole value and be of form "${<scheme>:<ref>}",
+// so that plain values such as URLs are never resolved by accident.
+func secretProviderOf(val string) (SecretProvider, string, bool) {
+	if !strings.HasPrefix(val, "${") || !strings.HasSuffix(val, "}") {
+		return nil, "", false
+	}
+	parts := strings.SplitN(strings.TrimSuffix(strings.TrimPrefix(val, "${"), "}"), ":", 2)
+	if len(parts) != 2 {
+		return nil, "", false
+	}
+	p, ok := secretProviders[parts[0]]
+	return p, parts[1], ok
+}
+
+// resolveSecretReferences replaces the values of params referencing a secret
+// provider with the resolved values, in place so that the precedence of
+// params is kept. Resolved values are base64-encoded (unless the key ends in
+// ".B64"), as are the values of encrypted param files. If decoded is true,
+// they are cleartext instead (values of keys ending in ".B64" are decoded),
+// which must not span multiple lines.
+// It is returned whether any value was resolved, in which case the result
+// must not be written to disk.
+func resolveSecretReferences(input string, decoded bool) (string, bool, error) {
+	var output strings.Builder
+	resolved := false
+	for _, line := range strings.SplitAfter(input, "\n") {
+		trimmed := strings.TrimSpace(line)
+		pair := strings.SplitN(trimmed, "=", 2)
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") || len(pair) != 2 {
+			output.WriteString(line)
+			continue
+		}
+		key, val := pair[0], pair[1]
+		p, ref, ok := secretProviderOf(val)
+		if !ok {
+			output.WriteString(line)
+			continue
+		}
+		cli.DebugMsg(fmt.Sprintf("Resolving %s with %s provider", key, p.Scheme()))
+		secret, err := p.Resolve(ref)
+		if err != nil {
+			return "", false, fmt.Errorf("Could not resolve %s: %s", key, err)
+		}
+		if strings.HasSuffix(key, ".B64") {
+			key = strings.TrimSuffix(key, ".B64")
+			if decoded {
+				b, err := base64.StdEncoding.DecodeString(secret)
+				if err != nil {
+					return "", false, fmt.Errorf("Could not decode %s: %s", key, err)
+				}
+				secret = string(b)
+			}
+		} else if !decoded {
+			secret = base64.StdEncoding.EncodeToString([]byte(secret))
+		}
+		if decoded {
+			err := checkSingleLine(key, secret)
+			if err != nil {
+				return "", false, err
+			}
+		}
+		output.WriteString(key + "=" + secret + "\n")
+		resolved = true
+	}
+	return output.String(), resolved, nil
+}
+
+// execSecretProvider runs the referenced command, and uses its output as
+// value, e.g. "${exec:./get-secret.sh prod/db}".
+type execSecretProvider struct{}
+
+func (p *execSecretProvider) Scheme() string {
+	return "exec"
+}
+
+func (p *execSecretProvider) Resolve(ref string) (string, error) {
+	args := strings.Fields(ref)
+	if len(args) == 0 {
+		return "", errors.New("no command given")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %s %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
+
+// fileSecretProvider reads the referenced file, e.g.
+// "${file:/run/secrets/db-password}".
+type fileSecretProvider struct{}
+
+func (p *fileSecretProvider) Scheme() string {
+	return "file"
+}
+
+func (p *fileSecretProvider) Resolve(ref string) (string, error) {
+	b, err := ioutil.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+// vaultSecretProvider reads a field of a secret from HashiCorp Vault, e.g.
+// "${vault:secret/data/prod/db#password}". The address and token are taken
+// from VAULT_ADDR and VAULT_TOKEN. Both KV version 1 and 2 are supported.
+type vaultSecretProvider struct{}
+
+func (p *vaultSecretProvider) Scheme() string {
+	return "vault"
+}
+
+func (p *vaultSecretProvider) Resolve(ref string) (string, error) {
+	parts := strings.SplitN(ref, "#", 2)
+	if len(parts) != 2 {
+		return "", errors.New("reference must be of form <path>#<field>")
+	}
+	path, field := parts[0], parts[1]
+	addr := os.Getenv("VAULT_ADDR")
+	if len(addr) == 0 {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+	req, err := http.NewRequest("GET", strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("reading %s failed with status %d", path, res.StatusCode)
+	}
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&secret)
+	if err != nil {
+		return "", fmt.Errorf("could not read response for %s: %s", path, err)
+	}
+	data := secret.Data
+	// KV version 2 nests the fields in another data object
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, isMetadata := data["metadata"]; isMetadata {
+			data = nested
+		}
+	}
+	val, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("%s has no field %s", path, field)
+	}
+	s, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("field %s of %s is not a string", field, path)
+	}
+	return s, nil
+}
@@ -0,0 +1,271 @@
+package openshift
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/opendevstack/tailor/pkg/cli"
+)
+
+func TestExecAndFileSecretProviders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailor-providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "get-secret.sh")
+	err = ioutil.WriteFile(script, []byte("#!/bin/sh\necho \"secret of $1\"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretFile := filepath.Join(dir, "password")
+	err = ioutil.WriteFile(secretFile, []byte("s3cret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		val       string
+		expected  string
+		expectErr string
+	}{
+		"exec with argument": {
+			val:      "${exec:" + script + " prod/db}",
+			expected: "secret of prod/db",
+		},
+		"file": {
+			val:      "${file:" + secretFile + "}",
+			expected: "s3cret",
+		},
+		"missing file": {
+			val:       "${file:" + filepath.Join(dir, "missing") + "}",
+			expectErr: "open " + filepath.Join(dir, "missing") + ": no such file or directory",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, ref, ok := secretProviderOf(tc.val)
+			if !ok {
+				t.Fatalf("No provider found for %s", tc.val)
+			}
+			actual, err := p.Resolve(ref)
+			if len(tc.expectErr) > 0 {
+				if err == nil || err.Error() != tc.expectErr {
+					t.Fatalf("Expected error '%s', got: %v", tc.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != tc.expected {
+				t.Fatalf("Expected '%s', got: '%s'", tc.expected, actual)
+			}
+		})
+	}
+}
+
+// paramFileRecorder records the content of the param file passed to
+// "oc process".
+type paramFileRecorder struct {
+	paramFiles []string
+}
+
+func (p *paramFileRecorder) Process(args []string) ([]byte, []byte, error) {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--param-file=") {
+			b, err := ioutil.ReadFile(strings.TrimPrefix(arg, "--param-file="))
+			if err != nil {
+				return nil, nil, err
+			}
+			p.paramFiles = append(p.paramFiles, string(b))
+		}
+	}
+	return []byte("apiVersion: v1\nkind: List\nitems: []\n"), nil, nil
+}
+
+func TestProcessTemplateKeepsResolvedValuesInMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailor-providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "get-secret.sh")
+	files := map[string]string{
+		"get-secret.sh": "#!/bin/sh\necho s3cret-from-exec\n",
+		"foo.yml": `apiVersion: v1
+kind: Template
+objects:
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: foo
+  data:
+    password: ${PASSWORD}
+    user: ${USER}
+parameters:
+- name: PASSWORD
+  required: true
+- name: USER
+  required: true
+`,
+		"foo.env": "USER=dXNlcg==\nPASSWORD=${exec:" + script + "}\n",
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var debugOutput bytes.Buffer
+	output := color.Output
+	color.Output = &debugOutput
+	defer func() { color.Output = output }()
+	globalOptions, err := cli.NewGlobalOptions(
+		false, "Tailorfile", false, true, false,
+		"oc", "oc", false, "",
+		[]string{}, []string{}, "", "recipients.yml",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.NewGlobalOptions(
+		false, "Tailorfile", false, false, false,
+		"oc", "oc", false, "",
+		[]string{}, []string{}, "", "recipients.yml",
+	)
+
+	ocClient := &paramFileRecorder{}
+	compareOptions := &cli.CompareOptions{
+		GlobalOptions:    globalOptions,
+		NamespaceOptions: &cli.NamespaceOptions{Namespace: "foo"},
+	}
+	b, err := ProcessTemplate(dir, "foo.yml", dir, compareOptions, ocClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "s3cret-from-exec", base64-encoded.
+	encoded := "czNjcmV0LWZyb20tZXhlYw=="
+	if !strings.Contains(string(b), encoded) {
+		t.Fatalf("Expected resolved password in processed template, got:\n%s", b)
+	}
+	if len(ocClient.paramFiles) > 0 {
+		t.Fatalf("Expected no param file to be written, got: %v", ocClient.paramFiles)
+	}
+	for _, secret := range []string{"s3cret-from-exec", encoded} {
+		if strings.Contains(debugOutput.String(), secret) {
+			t.Fatalf("Debug output contains resolved value:\n%s", debugOutput.String())
+		}
+	}
+	if !strings.Contains(debugOutput.String(), "Resolving PASSWORD with exec provider") {
+		t.Fatalf("Expected debug output, got:\n%s", debugOutput.String())
+	}
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/prod/db":
+			fmt.Fprint(w, `{"data":{"data":{"password":"s3cret"},"metadata":{"version":1}}}`)
+		case "/v1/kv/prod/db":
+			fmt.Fprint(w, `{"data":{"password":"v1-s3cret"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	os.Setenv("VAULT_ADDR", srv.URL)
+	os.Setenv("VAULT_TOKEN", "test-token")
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	tests := map[string]struct {
+		ref       string
+		expected  string
+		expectErr string
+	}{
+		"KV version 2": {
+			ref:      "secret/data/prod/db#password",
+			expected: "s3cret",
+		},
+		"KV version 1": {
+			ref:      "kv/prod/db#password",
+			expected: "v1-s3cret",
+		},
+		"missing field": {
+			ref:       "kv/prod/db#user",
+			expectErr: "kv/prod/db has no field user",
+		},
+		"missing secret": {
+			ref:       "kv/prod/app#password",
+			expectErr: "reading kv/prod/app failed with status 404",
+		},
+	}
+	p := &vaultSecretProvider{}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := p.Resolve(tc.ref)
+			if len(tc.expectErr) > 0 {
+				if err == nil || err.Error() != tc.expectErr {
+					t.Fatalf("Expected error '%s', got: %v", tc.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != tc.expected {
+				t.Fatalf("Expected '%s', got: '%s'", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestResolveSecretReferencesError(t *testing.T) {
+	_, _, err := resolveSecretReferences("FOO=${exec:false}\n", false)
+	if err == nil || !strings.HasPrefix(err.Error(), "Could not resolve FOO: false failed") {
+		t.Fatalf("Expected error for failing command, got: %v", err)
+	}
+}
+
+func TestResolveSecretReferencesPlainValues(t *testing.T) {
+	input := "CALLBACK=file:///srv/x\nCMD=exec:false\nURL=vault:8200\nFOO=${FOO}\n"
+	actual, resolved, err := resolveSecretReferences(input, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved {
+		t.Fatal("Expected no value to be resolved")
+	}
+	if actual != input {
+		t.Fatalf("Expected plain values to be kept, got: %s", actual)
+	}
+}
+
+func TestResolveSecretReferencesMultiLine(t *testing.T) {
+	input := "KEY=${exec:printf a\\nb}\n"
+	actual, _, err := resolveSecretReferences(input, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != "KEY=YQpi\n" {
+		t.Fatalf("Expected base64-encoded value, got: %s", actual)
+	}
+	_, _, err = resolveSecretReferences(input, true)
+	if err == nil || err.Error() != "Value of KEY spans multiple lines, which is only supported for templates" {
+		t.Fatalf("Expected error for multi-line value, got: %v", err)
+	}
+}
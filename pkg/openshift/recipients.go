@@ -0,0 +1,333 @@
+package openshift
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/opendevstack/tailor/pkg/utils"
+)
+
+// RecipientsPolicy restricts for which public keys the values of param files
+// are encrypted. Recipients are named after their public key file (e.g.
+// "john-doe" for "john-doe.key"), or refer to a group of such names.
+type RecipientsPolicy struct {
+	Groups map[string][]string `json:"groups"`
+	Rules  []*RecipientsRule   `json:"rules"`
+}
+
+// RecipientsRule defines the recipients of all values in files matching the
+// glob in Files. Keys can override the recipients for individual params.
+type RecipientsRule struct {
+	Files      string                 `json:"files"`
+	Recipients []string               `json:"recipients"`
+	Keys       []*KeyRecipientsPolicy `json:"keys,omitempty"`
+}
+
+// KeyRecipientsPolicy defines the recipients of params matching the glob in
+// Name.
+type KeyRecipientsPolicy struct {
+	Name       string   `json:"name"`
+	Recipients []string `json:"recipients"`
+}
+
+// ReadRecipientsPolicy reads the policy from given file. If the file does not
+// exist, nil is returned, meaning that all public keys are recipients.
+func ReadRecipientsPolicy(filename string) (*RecipientsPolicy, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	p := &RecipientsPolicy{}
+	err = yaml.Unmarshal(b, p)
+	if err != nil {
+		return nil, utils.DisplaySyntaxError(b, err)
+	}
+	for i, r := range p.Rules {
+		if len(r.Files) == 0 || len(r.Recipients) == 0 {
+			return nil, fmt.Errorf("rules[%d]: files and recipients are required", i)
+		}
+		if _, err := path.Match(r.Files, ""); err != nil {
+			return nil, fmt.Errorf("rules[%d]: invalid glob '%s'", i, r.Files)
+		}
+		for j, k := range r.Keys {
+			if len(k.Name) == 0 || len(k.Recipients) == 0 {
+				return nil, fmt.Errorf("rules[%d].keys[%d]: name and recipients are required", i, j)
+			}
+			if _, err := path.Match(k.Name, ""); err != nil {
+				return nil, fmt.Errorf("rules[%d].keys[%d]: invalid glob '%s'", i, j, k.Name)
+			}
+		}
+	}
+	return p, nil
+}
+
+// RecipientsFor returns the names of the public keys for which the param key
+// in given file needs to be encrypted. The first rule matching the file
+// applies. Globs without a slash are matched against the base name of the
+// file only.
+func (p *RecipientsPolicy) RecipientsFor(filename string, key string) ([]string, error) {
+	filename = filepath.ToSlash(filepath.Clean(filename))
+	for _, r := range p.Rules {
+		if !globMatches(r.Files, filename) {
+			continue
+		}
+		recipients := r.Recipients
+		for _, k := range r.Keys {
+			if globMatches(k.Name, key) || globMatches(k.Name, strings.TrimSuffix(key, ".B64")) {
+				recipients = k.Recipients
+				break
+			}
+		}
+		return p.resolve(recipients), nil
+	}
+	return nil, fmt.Errorf("No rule of the recipients policy matches '%s'", filename)
+}
+
+// resolve expands groups, and returns the sorted, unique key names.
+func (p *RecipientsPolicy) resolve(recipients []string) []string {
+	names := []string{}
+	for _, r := range recipients {
+		members, ok := p.Groups[r]
+		if !ok {
+			members = []string{r}
+		}
+		for _, m := range members {
+			if !utils.Includes(names, m) {
+				names = append(names, m)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func globMatches(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(name)
+	}
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
+
+// DescribeRecipients explains for each value of the encrypted input which
+// recipients it is encrypted for. PGP-encrypted values list the key IDs they
+// are encrypted for, which are mapped to the public key files in
+// publicKeyDir. age does not reveal the recipients, so only their number is
+// known. If a policy is given, the recipients it requires are listed too.
+func DescribeRecipients(input, filename, publicKeyDir string, policy *RecipientsPolicy) (string, error) {
+	keys, err := readPublicKeys(publicKeyDir)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	err = extractKeyValuePairs(input, func(key, val string) error {
+		fmt.Fprintf(&sb, "%s: ", key)
+		switch utils.EncryptionOf(val) {
+		case utils.AgeEncryption:
+			n, err := utils.AgeRecipientCount(val)
+			if err != nil {
+				return fmt.Errorf("Could not read %s: %s", key, err)
+			}
+			fmt.Fprintf(&sb, "age, %d recipient(s) (age does not reveal which)", n)
+		default:
+			ids, err := utils.PGPRecipientKeyIDs(val)
+			if err != nil {
+				return fmt.Errorf("Could not read %s: %s", key, err)
+			}
+			names := []string{}
+			for _, id := range ids {
+				if name, ok := keys.nameOf(id); ok {
+					names = append(names, fmt.Sprintf("%s (%X)", name, id))
+				} else {
+					names = append(names, fmt.Sprintf("unknown key %X", id))
+				}
+			}
+			sort.Strings(names)
+			fmt.Fprintf(&sb, "pgp, %s", strings.Join(names, ", "))
+		}
+		if policy != nil {
+			recipients, err := policy.RecipientsFor(filename, key)
+			if err != nil {
+				fmt.Fprintf(&sb, "; policy: %s", err)
+			} else {
+				fmt.Fprintf(&sb, "; policy: %s", strings.Join(recipients, ", "))
+			}
+		}
+		sb.WriteString("\n")
+		return nil
+	}, func(line string) {})
+	return sb.String(), err
+}
+
+// AuditRecipients checks, without decrypting, whether each value of the
+// encrypted input is encrypted for exactly the expected recipients: those
+// required by the policy if given, otherwise all public keys in publicKeyDir
+// of the backend the value is encrypted with. Revoked PGP keys are not
+// expected. The returned problems are prefixed with the param key.
+func AuditRecipients(input, filename, publicKeyDir string, policy *RecipientsPolicy) ([]string, error) {
+	keys, err := readPublicKeys(publicKeyDir)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []string{}
+	err = extractKeyValuePairs(input, func(key, val string) error {
+		for _, p := range keys.audit(filename, key, val, policy) {
+			problems = append(problems, key+": "+p)
+		}
+		return nil
+	}, func(line string) {})
+	return problems, err
+}
+
+// audit returns the problems with the recipients of the encrypted value of
+// key, see AuditRecipients.
+func (keys publicKeys) audit(filename, key, val string, policy *RecipientsPolicy) []string {
+	problems := []string{}
+	report := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+	encryption := utils.EncryptionOf(val)
+
+	expected := []string{}
+	if policy != nil {
+		recipients, err := policy.RecipientsFor(filename, key)
+		if err != nil {
+			report("%s", err)
+			return problems
+		}
+		for _, r := range recipients {
+			info, ok := keys[r]
+			if !ok {
+				report("no public key found for recipient %s", r)
+			} else if info.Encryption == encryption {
+				expected = append(expected, r)
+			}
+		}
+	} else {
+		for name, info := range keys {
+			if info.Encryption == encryption {
+				expected = append(expected, name)
+			}
+		}
+	}
+	sort.Strings(expected)
+
+	if encryption == utils.AgeEncryption {
+		n, err := utils.AgeRecipientCount(val)
+		if err != nil {
+			report("undecryptable (%s)", err)
+		} else if n != len(expected) {
+			report("encrypted for %d recipient(s), but %d expected (%s)", n, len(expected), strings.Join(expected, ", "))
+		}
+		return problems
+	}
+
+	ids, err := utils.PGPRecipientKeyIDs(val)
+	if err != nil {
+		report("undecryptable (%s)", err)
+		return problems
+	}
+	found := map[string]bool{}
+	decryptable := false
+	for _, id := range ids {
+		name, ok := keys.nameOf(id)
+		if !ok {
+			report("encrypted for removed key %X", id)
+			continue
+		}
+		found[name] = true
+		if keys[name].Revoked {
+			report("encrypted for revoked key %s (%X)", name, id)
+			continue
+		}
+		decryptable = true
+		if !utils.Includes(expected, name) {
+			report("encrypted for %s (%X), which is not a recipient according to the policy", name, id)
+		}
+	}
+	for _, name := range expected {
+		if !found[name] && !keys[name].Revoked {
+			report("missing recipient %s", name)
+		}
+	}
+	if !decryptable {
+		report("undecryptable, none of the current public keys is a recipient")
+	}
+	return problems
+}
+
+// publicKeys maps the names of the public key files to their description.
+type publicKeys map[string]*utils.PublicKeyInfo
+
+// nameOf returns the name of the PGP key with given (sub)key ID.
+func (keys publicKeys) nameOf(id uint64) (string, bool) {
+	for name, info := range keys {
+		for _, i := range info.IDs {
+			if i == id {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+func readPublicKeys(publicKeyDir string) (publicKeys, error) {
+	_, keyFiles, err := publicKeyFiles(publicKeyDir)
+	if err != nil {
+		return nil, err
+	}
+	keys := publicKeys{}
+	for name, f := range keyFiles {
+		info, err := utils.ReadPublicKeyInfo(f)
+		if err != nil {
+			return nil, err
+		}
+		keys[name] = info
+	}
+	return keys, nil
+}
+
+// publicKeyFiles returns the public key files in publicKeyDir by name. If
+// publicKeyDir is ".", a "public-keys" folder is preferred.
+func publicKeyFiles(publicKeyDir string) (string, map[string]string, error) {
+	// Prefer "public-keys" folder over current directory
+	if publicKeyDir == "." {
+		if _, err := os.Stat("public-keys"); err == nil {
+			publicKeyDir = "public-keys"
+		}
+	}
+
+	files, err := ioutil.ReadDir(publicKeyDir)
+	if err != nil {
+		return publicKeyDir, nil, err
+	}
+	keyFiles := map[string]string{}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), "private.key") {
+			continue
+		}
+		if !strings.HasSuffix(file.Name(), ".key") {
+			continue
+		}
+		name := strings.TrimSuffix(file.Name(), ".key")
+		keyFiles[name] = publicKeyDir + string(os.PathSeparator) + file.Name()
+	}
+	if len(keyFiles) == 0 {
+		return publicKeyDir, nil, errors.New(
+			"No public key files found in '" + publicKeyDir + "'. Files need to end in '.key'",
+		)
+	}
+	return publicKeyDir, keyFiles, nil
+}
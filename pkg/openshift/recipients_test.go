@@ -0,0 +1,275 @@
+package openshift
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/tailor/pkg/utils"
+)
+
+const testRecipientsPolicy = `groups:
+  admins: [alice]
+  developers: [bob, carol]
+rules:
+- files: "prod/*.env.enc"
+  recipients: [admins]
+  keys:
+  - name: "DEV_*"
+    recipients: [admins, developers]
+- files: "*.env.enc"
+  recipients: [admins, developers]
+`
+
+func writeRecipientsPolicy(t *testing.T, dir, content string) string {
+	filename := filepath.Join(dir, "recipients.yml")
+	err := ioutil.WriteFile(filename, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestRecipientsFor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailor-recipients")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	policy, err := ReadRecipientsPolicy(writeRecipientsPolicy(t, dir, testRecipientsPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		filename  string
+		key       string
+		expected  []string
+		expectErr string
+	}{
+		"file rule": {
+			filename: "prod/app.env.enc",
+			key:      "PASSWORD",
+			expected: []string{"alice"},
+		},
+		"key rule": {
+			filename: "./prod/app.env.enc",
+			key:      "DEV_TOKEN.B64",
+			expected: []string{"alice", "bob", "carol"},
+		},
+		"base name rule": {
+			filename: "dev/app.env.enc",
+			key:      "PASSWORD",
+			expected: []string{"alice", "bob", "carol"},
+		},
+		"no rule": {
+			filename:  "app.env",
+			key:       "PASSWORD",
+			expectErr: "No rule of the recipients policy matches 'app.env'",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := policy.RecipientsFor(tc.filename, tc.key)
+			if len(tc.expectErr) > 0 {
+				if err == nil || err.Error() != tc.expectErr {
+					t.Fatalf("Expected error '%s', got: %v", tc.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Fatalf("Recipients mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadRecipientsPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailor-recipients")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	policy, err := ReadRecipientsPolicy(filepath.Join(dir, "missing.yml"))
+	if err != nil || policy != nil {
+		t.Fatalf("Expected no policy for missing file, got: %v, %v", policy, err)
+	}
+
+	_, err = ReadRecipientsPolicy(writeRecipientsPolicy(t, dir, "rules:\n- files: \"*.env.enc\"\n"))
+	if err == nil || err.Error() != "rules[0]: files and recipients are required" {
+		t.Fatalf("Expected error for incomplete rule, got: %v", err)
+	}
+}
+
+func TestEncryptedParamsRecipientsPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailor-recipients")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	privateKeys := map[string]string{}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		identity, err := utils.GenerateAgeIdentity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		privateKeys[name] = filepath.Join(dir, name+"-private.key")
+		err = utils.PrintAgeKeys(identity, name, filepath.Join(dir, name+".key"), privateKeys[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	policy, err := ReadRecipientsPolicy(writeRecipientsPolicy(t, dir, testRecipientsPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleartext := "PASSWORD=secret\nDEV_TOKEN=token\n"
+	actual, err := EncryptedParams(cleartext, "", "prod/app.env.enc", dir, "", "", "age", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revealed, err := DecryptedParams(actual, privateKeys["alice"], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revealed != cleartext {
+		t.Fatalf("Mismatch, got: %v, want: %v.", revealed, cleartext)
+	}
+	_, err = DecryptedParams(actual, privateKeys["bob"], "")
+	if err == nil || !strings.Contains(err.Error(), "Could not decrypt PASSWORD") {
+		t.Fatalf("Expected bob not to be able to decrypt PASSWORD, got: %v", err)
+	}
+	devToken := strings.SplitN(actual, "\n", 2)[1]
+	revealed, err = DecryptedParams(devToken, privateKeys["bob"], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revealed != "DEV_TOKEN=token\n" {
+		t.Fatalf("Mismatch, got: %v, want: DEV_TOKEN=token.", revealed)
+	}
+
+	description, err := DescribeRecipients(actual, "prod/app.env.enc", dir, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `PASSWORD: age, 1 recipient(s) (age does not reveal which); policy: alice
+DEV_TOKEN: age, 3 recipient(s) (age does not reveal which); policy: alice, bob, carol
+`
+	if diff := cmp.Diff(expected, description); diff != "" {
+		t.Fatalf("Description mismatch (-want +got):\n%s", diff)
+	}
+
+	// bob can edit the values he is a recipient of, and keeps the others.
+	editable, undecryptable, err := EditableParams(actual, privateKeys["bob"], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"PASSWORD"}, undecryptable); diff != "" {
+		t.Fatalf("Undecryptable keys mismatch (-want +got):\n%s", diff)
+	}
+	password := strings.SplitN(actual, "\n", 2)[0]
+	if expected := password + "\nDEV_TOKEN=token\n"; editable != expected {
+		t.Fatalf("Mismatch, got: %v, want: %v.", editable, expected)
+	}
+	edited := strings.Replace(editable, "DEV_TOKEN=token", "DEV_TOKEN=changed", 1)
+	updated, err := EncryptedParams(edited, actual, "prod/app.env.enc", dir, privateKeys["bob"], "", "age", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(updated, password+"\n") {
+		t.Fatalf("Expected PASSWORD to be kept, got: %v", updated)
+	}
+	revealed, err = DecryptedParams(updated, privateKeys["alice"], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "PASSWORD=secret\nDEV_TOKEN=changed\n"; revealed != expected {
+		t.Fatalf("Mismatch, got: %v, want: %v.", revealed, expected)
+	}
+	// Once the recipients of PASSWORD change, bob cannot keep its value.
+	_, err = EncryptedParams(edited, actual, "prod/app.env.enc", dir, privateKeys["bob"], "", "age", &RecipientsPolicy{
+		Rules: []*RecipientsRule{{Files: "*", Recipients: []string{"alice", "bob"}}},
+	})
+	expectedErr := "PASSWORD cannot be kept as it is not encrypted for the expected recipients " +
+		"(encrypted for 1 recipient(s), but 2 expected (alice, bob)), and cannot be re-encrypted as you cannot decrypt it. " +
+		"Ask one of its recipients to re-encrypt it"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("Expected error for changed recipients, got: %v", err)
+	}
+
+	_, err = EncryptedParams(cleartext, "", "prod/app.env.enc", dir, "", "", "age", &RecipientsPolicy{
+		Rules: []*RecipientsRule{{Files: "*", Recipients: []string{"dave"}}},
+	})
+	if err == nil || err.Error() != "No public key found for recipient 'dave' of PASSWORD" {
+		t.Fatalf("Expected error for unknown recipient, got: %v", err)
+	}
+}
+
+func TestDescribeRecipientsPGP(t *testing.T) {
+	input := readFileContent(t, "test-encrypted.env")
+	actual, err := DescribeRecipients(input, "test.env.enc", ".", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(actual, "\n"), "\n") {
+		if !strings.Contains(line, ": pgp, test-public (") {
+			t.Fatalf("Expected value encrypted for test-public, got: %s", line)
+		}
+	}
+}
+
+func TestAuditRecipients(t *testing.T) {
+	input := readFileContent(t, "test-encrypted.env")
+	problems, err := AuditRecipients(input, "test.env.enc", ".", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Fatalf("Expected no problems, got: %v", problems)
+	}
+
+	dir, err := ioutil.TempDir("", "tailor-recipients")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	entity, err := utils.CreateEntity("Jane Doe", "jane.doe@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = utils.PrintPublicKey(entity, filepath.Join(dir, "jane-doe.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstLine := strings.SplitN(input, "\n", 2)[0]
+	key := strings.SplitN(firstLine, "=", 2)[0]
+	ids, err := utils.PGPRecipientKeyIDs(strings.SplitN(firstLine, "=", 2)[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Key of test-public.key removed, and new key of jane-doe added
+	problems, err = AuditRecipients(firstLine+"\nBROKEN=Zm9v\n", "test.env.enc", dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		fmt.Sprintf("%s: encrypted for removed key %X", key, ids[0]),
+		key + ": missing recipient jane-doe",
+		key + ": undecryptable, none of the current public keys is a recipient",
+		"BROKEN: undecryptable (Reading 'Zm9v' failed: openpgp: invalid data: tag byte does not have MSB set)",
+	}
+	if diff := cmp.Diff(expected, problems); diff != "" {
+		t.Fatalf("Problems mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,341 @@
+package openshift
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/opendevstack/tailor/pkg/utils"
+)
+
+// OrderByReferences orders the changes so that a resource is created or
+// updated after the resources it references (e.g. a DeploymentConfig after
+// the Secret it mounts), and deleted before them. This holds across actions
+// as well: a resource is updated before a resource it stops referencing is
+// deleted, and a recreated resource is deleted before it is created again.
+// Apart from that, changes are applied in the order create, delete, update,
+// and by kind. A cycle of references is an error.
+func (c *Changeset) OrderByReferences() error {
+	all := []*Change{}
+	all = append(all, c.Create...)
+	all = append(all, c.Delete...)
+	all = append(all, c.Update...)
+	byName := map[string][]*Change{}
+	for _, change := range all {
+		change.After = nil
+		byName[change.Kind+"/"+change.Name] = append(byName[change.Kind+"/"+change.Name], change)
+	}
+
+	// before lists for each change the changes which need to go first.
+	before := map[*Change][]*Change{}
+	for _, change := range all {
+		if change.Action != "Delete" {
+			refs, err := stateReferences(change.Kind, change.DesiredState)
+			if err != nil {
+				return fmt.Errorf("Could not determine references of %s: %s", change.ItemName(), err)
+			}
+			for _, ref := range refs {
+				for _, d := range byName[ref] {
+					if d != change && d.Action != "Delete" {
+						before[change] = append(before[change], d)
+					}
+				}
+			}
+		}
+		if change.Action != "Create" {
+			refs, err := stateReferences(change.Kind, change.CurrentState)
+			if err != nil {
+				return fmt.Errorf("Could not determine references of %s: %s", change.ItemName(), err)
+			}
+			for _, ref := range refs {
+				for _, d := range byName[ref] {
+					if d != change && d.Action == "Delete" {
+						before[d] = append(before[d], change)
+					}
+				}
+			}
+		}
+		if change.Action == "Create" {
+			for _, d := range byName[change.Kind+"/"+change.Name] {
+				if d.Action == "Delete" {
+					before[change] = append(before[change], d)
+				}
+			}
+		}
+	}
+
+	// Within each action, referenced resources are pulled forward (or, for
+	// deletions, pushed back), keeping the order by kind otherwise.
+	referenced := map[*Change][]*Change{}
+	for change, deps := range before {
+		for _, d := range deps {
+			referenced[d] = append(referenced[d], change)
+		}
+	}
+	preferred := []*Change{}
+	create, err := sortTopologically(sortedByKind(c.Create), before)
+	if err != nil {
+		return err
+	}
+	preferred = append(preferred, create...)
+	// Deletions are ordered by the resources they reference, and reversed.
+	del, err := sortTopologically(sortedByKind(c.Delete), referenced)
+	if err != nil {
+		return err
+	}
+	for i := len(del) - 1; i >= 0; i-- {
+		preferred = append(preferred, del[i])
+	}
+	update, err := sortTopologically(sortedByKind(c.Update), before)
+	if err != nil {
+		return err
+	}
+	preferred = append(preferred, update...)
+
+	ordered, err := sortTopologically(preferred, before)
+	if err != nil {
+		return err
+	}
+	for change, deps := range before {
+		for _, d := range deps {
+			if !utils.Includes(change.After, d.ItemName()) {
+				change.After = append(change.After, d.ItemName())
+			}
+		}
+		sort.Strings(change.After)
+	}
+
+	c.order = ordered
+	c.Create, c.Delete, c.Update = []*Change{}, []*Change{}, []*Change{}
+	for _, change := range ordered {
+		switch change.Action {
+		case "Create":
+			c.Create = append(c.Create, change)
+		case "Delete":
+			c.Delete = append(c.Delete, change)
+		case "Update":
+			c.Update = append(c.Update, change)
+		}
+	}
+	return nil
+}
+
+// Ordered returns all changes in the order in which they are applied. If the
+// changes have not been ordered by references, they are applied in the order
+// create, delete, update.
+func (c *Changeset) Ordered() []*Change {
+	if c.order != nil {
+		return c.order
+	}
+	changes := []*Change{}
+	changes = append(changes, c.Create...)
+	changes = append(changes, c.Delete...)
+	changes = append(changes, c.Update...)
+	return changes
+}
+
+// sortedByKind returns a copy of changes sorted by kind and name.
+func sortedByKind(changes []*Change) []*Change {
+	sorted := make([]*Change, len(changes))
+	copy(sorted, changes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := kindRank(sorted[i].Kind), kindRank(sorted[j].Kind)
+		if ri != rj {
+			return ri < rj
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// sortTopologically returns changes so that every change comes after its
+// dependencies, keeping the given order as far as possible. Dependencies
+// which are not part of changes are ignored.
+func sortTopologically(changes []*Change, dependencies map[*Change][]*Change) ([]*Change, error) {
+	included := map[*Change]bool{}
+	for _, change := range changes {
+		included[change] = true
+	}
+	ordered := []*Change{}
+	visited := map[*Change]bool{}
+	path := []*Change{}
+	var visit func(change *Change) error
+	visit = func(change *Change) error {
+		for i, p := range path {
+			if p == change {
+				names := []string{}
+				for _, c := range append(path[i:], change) {
+					names = append(names, c.ItemName())
+				}
+				return fmt.Errorf("Cyclic references between resources: %s", strings.Join(names, " -> "))
+			}
+		}
+		if visited[change] {
+			return nil
+		}
+		path = append(path, change)
+		for _, d := range dependencies[change] {
+			if !included[d] {
+				continue
+			}
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		visited[change] = true
+		ordered = append(ordered, change)
+		return nil
+	}
+	for _, change := range changes {
+		if err := visit(change); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// stateReferences parses the YAML state of a resource and returns the
+// resources it references (see resourceReferences).
+func stateReferences(kind string, state string) ([]string, error) {
+	if len(state) == 0 {
+		return []string{}, nil
+	}
+	var m map[string]interface{}
+	err := yaml.Unmarshal([]byte(state), &m)
+	if err != nil {
+		return nil, err
+	}
+	return resourceReferences(kind, m), nil
+}
+
+// resourceReferences returns the resources (as Kind/name) referenced by the
+// given resource config. References to other namespaces are ignored.
+func resourceReferences(kind string, m map[string]interface{}) []string {
+	refs := []string{}
+	add := func(refKind string, name interface{}) {
+		if n, ok := name.(string); ok && len(n) > 0 {
+			ref := refKind + "/" + n
+			for _, r := range refs {
+				if r == ref {
+					return
+				}
+			}
+			refs = append(refs, ref)
+		}
+	}
+	addImageStreamTag := func(from interface{}) {
+		f, ok := from.(map[string]interface{})
+		if !ok || f["kind"] != "ImageStreamTag" || f["namespace"] != nil {
+			return
+		}
+		if name, ok := f["name"].(string); ok {
+			add("ImageStream", strings.SplitN(name, ":", 2)[0])
+		}
+	}
+
+	spec := mapAt(m, "spec")
+	switch kind {
+	case "Pod":
+		podSpecReferences(spec, add)
+	case "CronJob":
+		podSpecReferences(mapAt(m, "spec", "jobTemplate", "spec", "template", "spec"), add)
+	default:
+		podSpecReferences(mapAt(m, "spec", "template", "spec"), add)
+	}
+
+	switch kind {
+	case "DeploymentConfig":
+		for _, t := range sliceAt(spec, "triggers") {
+			addImageStreamTag(mapAt(asMap(t), "imageChangeParams")["from"])
+		}
+	case "BuildConfig":
+		addImageStreamTag(mapAt(spec, "output")["to"])
+		add("Secret", mapAt(spec, "output", "pushSecret")["name"])
+		add("Secret", mapAt(spec, "source", "sourceSecret")["name"])
+		for _, strategy := range []string{"sourceStrategy", "dockerStrategy", "customStrategy"} {
+			s := mapAt(spec, "strategy", strategy)
+			addImageStreamTag(s["from"])
+			add("Secret", mapAt(s, "pullSecret")["name"])
+		}
+		for _, t := range sliceAt(spec, "triggers") {
+			addImageStreamTag(mapAt(asMap(t), "imageChange")["from"])
+		}
+	case "Route":
+		backends := []interface{}{spec["to"]}
+		backends = append(backends, sliceAt(spec, "alternateBackends")...)
+		for _, b := range backends {
+			if bm := asMap(b); bm["kind"] == "Service" {
+				add("Service", bm["name"])
+			}
+		}
+	case "RoleBinding":
+		for _, s := range sliceAt(m, "subjects") {
+			sm := asMap(s)
+			if sm["kind"] == "ServiceAccount" && sm["namespace"] == nil {
+				add("ServiceAccount", sm["name"])
+			}
+		}
+	}
+	return refs
+}
+
+// podSpecReferences adds the references of a pod spec: service account, pull
+// secrets, volumes, and environment of (init) containers.
+func podSpecReferences(podSpec map[string]interface{}, add func(string, interface{})) {
+	if len(podSpec) == 0 {
+		return
+	}
+	add("ServiceAccount", podSpec["serviceAccountName"])
+	add("ServiceAccount", podSpec["serviceAccount"])
+	for _, s := range sliceAt(podSpec, "imagePullSecrets") {
+		add("Secret", asMap(s)["name"])
+	}
+	for _, v := range sliceAt(podSpec, "volumes") {
+		vm := asMap(v)
+		add("Secret", mapAt(vm, "secret")["secretName"])
+		add("ConfigMap", mapAt(vm, "configMap")["name"])
+		add("PersistentVolumeClaim", mapAt(vm, "persistentVolumeClaim")["claimName"])
+		for _, s := range sliceAt(mapAt(vm, "projected"), "sources") {
+			add("Secret", mapAt(asMap(s), "secret")["name"])
+			add("ConfigMap", mapAt(asMap(s), "configMap")["name"])
+		}
+	}
+	containers := append([]interface{}{}, sliceAt(podSpec, "initContainers")...)
+	containers = append(containers, sliceAt(podSpec, "containers")...)
+	for _, c := range containers {
+		cm := asMap(c)
+		for _, e := range sliceAt(cm, "env") {
+			valueFrom := mapAt(asMap(e), "valueFrom")
+			add("Secret", mapAt(valueFrom, "secretKeyRef")["name"])
+			add("ConfigMap", mapAt(valueFrom, "configMapKeyRef")["name"])
+		}
+		for _, e := range sliceAt(cm, "envFrom") {
+			add("Secret", mapAt(asMap(e), "secretRef")["name"])
+			add("ConfigMap", mapAt(asMap(e), "configMapRef")["name"])
+		}
+	}
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+// mapAt returns the map at given keys, or an empty map if there is none.
+func mapAt(m map[string]interface{}, keys ...string) map[string]interface{} {
+	for _, k := range keys {
+		m = asMap(m[k])
+	}
+	if m == nil {
+		return map[string]interface{}{}
+	}
+	return m
+}
+
+// sliceAt returns the slice at given key, or nil if there is none.
+func sliceAt(m map[string]interface{}, key string) []interface{} {
+	s, _ := m[key].([]interface{})
+	return s
+}
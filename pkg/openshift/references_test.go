@@ -0,0 +1,282 @@
+package openshift
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResourceReferences(t *testing.T) {
+	tests := map[string]struct {
+		kind     string
+		state    string
+		expected []string
+	}{
+		"DeploymentConfig": {
+			kind: "DeploymentConfig",
+			state: `spec:
+  triggers:
+  - type: ImageChange
+    imageChangeParams:
+      from:
+        kind: ImageStreamTag
+        name: foo:latest
+  - type: ImageChange
+    imageChangeParams:
+      from:
+        kind: ImageStreamTag
+        name: base:latest
+        namespace: other
+  template:
+    spec:
+      serviceAccountName: deployer
+      volumes:
+      - name: data
+        persistentVolumeClaim:
+          claimName: data
+      - name: certs
+        secret:
+          secretName: certs
+      containers:
+      - name: foo
+        env:
+        - name: PASSWORD
+          valueFrom:
+            secretKeyRef:
+              name: credentials
+              key: password
+        envFrom:
+        - configMapRef:
+            name: settings`,
+			expected: []string{
+				"ServiceAccount/deployer",
+				"PersistentVolumeClaim/data",
+				"Secret/certs",
+				"Secret/credentials",
+				"ConfigMap/settings",
+				"ImageStream/foo",
+			},
+		},
+		"CronJob": {
+			kind: "CronJob",
+			state: `spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: foo
+            envFrom:
+            - secretRef:
+                name: credentials`,
+			expected: []string{"Secret/credentials"},
+		},
+		"Route": {
+			kind: "Route",
+			state: `spec:
+  to:
+    kind: Service
+    name: foo
+  alternateBackends:
+  - kind: Service
+    name: bar`,
+			expected: []string{"Service/foo", "Service/bar"},
+		},
+		"RoleBinding": {
+			kind: "RoleBinding",
+			state: `subjects:
+- kind: ServiceAccount
+  name: foo
+- kind: ServiceAccount
+  name: bar
+  namespace: other
+- kind: User
+  name: baz`,
+			expected: []string{"ServiceAccount/foo"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := stateReferences(tc.kind, tc.state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Fatalf("References mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestOrderByReferences(t *testing.T) {
+	newChanges := func(action string, prefix string) []*Change {
+		dc := `spec:
+  template:
+    spec:
+      serviceAccountName: ` + prefix + `zz-deployer`
+		route := `spec:
+  to:
+    kind: Service
+    name: ` + prefix + `foo`
+		state := func(s string) (string, string) {
+			if action == "Delete" {
+				return s, ""
+			}
+			return "", s
+		}
+		changes := []*Change{}
+		for _, c := range []struct{ kind, name, state string }{
+			{"Route", "foo", route},
+			{"DeploymentConfig", "foo", dc},
+			{"ServiceAccount", "zz-deployer", ""},
+			{"ConfigMap", "foo", ""},
+			{"Service", "foo", ""},
+		} {
+			current, desired := state(c.state)
+			changes = append(changes, &Change{
+				Action:       action,
+				Kind:         c.kind,
+				Name:         prefix + c.name,
+				CurrentState: current,
+				DesiredState: desired,
+			})
+		}
+		return changes
+	}
+
+	cs := &Changeset{Create: newChanges("Create", ""), Delete: newChanges("Delete", "old-")}
+	err := cs.OrderByReferences()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The service account is not first by kind, but needed by the DC.
+	wantCreate := []string{"cm/foo", "serviceaccount/zz-deployer", "dc/foo", "svc/foo", "route/foo"}
+	if diff := cmp.Diff(wantCreate, itemNames(cs.Create)); diff != "" {
+		t.Fatalf("Create order mismatch (-want +got):\n%s", diff)
+	}
+	wantDelete := []string{"route/old-foo", "svc/old-foo", "dc/old-foo", "serviceaccount/old-zz-deployer", "cm/old-foo"}
+	if diff := cmp.Diff(wantDelete, itemNames(cs.Delete)); diff != "" {
+		t.Fatalf("Delete order mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(append(wantCreate, wantDelete...), itemNames(cs.Ordered())); diff != "" {
+		t.Fatalf("Order mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"serviceaccount/zz-deployer"}, cs.Create[2].After); diff != "" {
+		t.Fatalf("After mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"dc/old-foo"}, cs.Delete[3].After); diff != "" {
+		t.Fatalf("After mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOrderByReferencesAcrossActions(t *testing.T) {
+	mounting := func(secret string) string {
+		return `spec:
+  template:
+    spec:
+      volumes:
+      - name: certs
+        secret:
+          secretName: ` + secret
+	}
+	cs := &Changeset{
+		Create: []*Change{
+			{Action: "Create", Kind: "Secret", Name: "new"},
+			{Action: "Create", Kind: "Route", Name: "foo", DesiredState: "spec: {to: {kind: Service, name: foo}}"},
+			{Action: "Create", Kind: "ImageStream", Name: "foo", DesiredState: "spec: {}"},
+		},
+		Delete: []*Change{
+			{Action: "Delete", Kind: "Secret", Name: "old"},
+			{Action: "Delete", Kind: "ImageStream", Name: "foo", CurrentState: "spec: {}"},
+		},
+		Update: []*Change{
+			{
+				Action:       "Update",
+				Kind:         "DeploymentConfig",
+				Name:         "foo",
+				CurrentState: mounting("old"),
+				DesiredState: mounting("new"),
+			},
+			{Action: "Update", Kind: "Service", Name: "foo"},
+		},
+	}
+	err := cs.OrderByReferences()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The service is updated before the route pointing to it is created, the
+	// DC stops using the old secret before it is deleted, and the recreated
+	// image stream is deleted before it is created again.
+	want := []string{
+		"+ secret/new",
+		"- is/foo",
+		"+ is/foo",
+		"~ svc/foo",
+		"+ route/foo",
+		"~ dc/foo",
+		"- secret/old",
+	}
+	got := []string{}
+	symbols := map[string]string{"Create": "+", "Delete": "-", "Update": "~"}
+	for _, c := range cs.Ordered() {
+		got = append(got, symbols[c.Action]+" "+c.ItemName())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Order mismatch (-want +got):\n%s", diff)
+	}
+	after := map[string][]string{}
+	for _, c := range cs.Ordered() {
+		if len(c.After) > 0 {
+			after[symbols[c.Action]+" "+c.ItemName()] = c.After
+		}
+	}
+	wantAfter := map[string][]string{
+		"+ route/foo":  {"svc/foo"},
+		"+ is/foo":     {"is/foo"},
+		"~ dc/foo":     {"secret/new"},
+		"- secret/old": {"dc/foo"},
+	}
+	if diff := cmp.Diff(wantAfter, after); diff != "" {
+		t.Fatalf("After mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func itemNames(changes []*Change) []string {
+	n := []string{}
+	for _, c := range changes {
+		n = append(n, c.ItemName())
+	}
+	return n
+}
+
+func TestOrderByReferencesCycle(t *testing.T) {
+	// Real resources rarely reference each other, but the generic pod spec
+	// lookup makes it possible to construct a cycle.
+	cs := &Changeset{
+		Create: []*Change{
+			{
+				Action:       "Create",
+				Kind:         "Secret",
+				Name:         "b",
+				DesiredState: "spec: {template: {spec: {serviceAccountName: a}}}",
+			},
+			{
+				Action:       "Create",
+				Kind:         "ServiceAccount",
+				Name:         "a",
+				DesiredState: "spec: {template: {spec: {imagePullSecrets: [{name: b}]}}}",
+			},
+		},
+	}
+	err := cs.OrderByReferences()
+	if err == nil {
+		t.Fatal("Expected error for cyclic references")
+	}
+	expected := "Cyclic references between resources: secret/b -> serviceaccount/a -> secret/b"
+	if err.Error() != expected {
+		t.Fatalf("Expected error '%s', got: %s", expected, err)
+	}
+}
@@ -0,0 +1,77 @@
+package openshift
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/opendevstack/tailor/pkg/cli"
+)
+
+// RenderTemplate renders the desired state of template t by running its
+// renderer (see FindTemplates) with "sh -c" in the template dir. The command
+// gets the path of the template (relative to the template dir) as
+// TAILOR_RENDER_PATH, the namespace as TAILOR_NAMESPACE, and the params
+// (from --param and the param files) as environment variables. Other than
+// templates, the command gets all values in cleartext: secrets are decrypted
+// and not base64-encoded, and values of ".B64" params are decoded. It must
+// write manifests to STDOUT, which are returned as list.
+func RenderTemplate(t *TemplateFile, paramDir string, compareOptions *cli.CompareOptions) ([]byte, error) {
+	paramFileBytes := []byte{}
+	actualParamFiles := calculateParamFiles(t.Name, paramDir, compareOptions)
+	if len(actualParamFiles) > 0 {
+		b, _, err := readParamFileBytes(
+			actualParamFiles,
+			compareOptions.PrivateKey,
+			compareOptions.Passphrase,
+			true,
+		)
+		if err != nil {
+			return []byte{}, err
+		}
+		paramFileBytes = b
+	}
+	values, err := parameterValues(compareOptions.Params, paramFileBytes)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	env := os.Environ()
+	env = append(env, "TAILOR_NAMESPACE="+compareOptions.Namespace, "TAILOR_RENDER_PATH="+t.Name)
+	keys := []string{}
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+values[k])
+	}
+
+	cli.DebugMsg("Rendering", t.Path(), "with:", t.Renderer)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", t.Renderer)
+	cmd.Dir = t.Dir
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return []byte{}, fmt.Errorf("Renderer '%s' failed: %s %s", t.Renderer, err, strings.TrimSpace(stderr.String()))
+	}
+	if stderr.Len() > 0 {
+		cli.DebugMsg("Renderer wrote to STDERR:", strings.TrimSpace(stderr.String()))
+	}
+
+	objects, isTemplate, err := splitManifest(stdout.Bytes())
+	if err != nil {
+		return []byte{}, fmt.Errorf("Could not parse output of renderer '%s': %s", t.Renderer, err)
+	}
+	if isTemplate {
+		return []byte{}, fmt.Errorf("Renderer '%s' must write manifests, not a template", t.Renderer)
+	}
+	// Params have been taken care of by the renderer already.
+	return processManifest(objects, compareOptions.Labels, nil, nil)
+}
@@ -0,0 +1,131 @@
+package openshift
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/tailor/pkg/cli"
+	"github.com/opendevstack/tailor/pkg/utils"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailor-renderer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"templates/render.sh": `#!/bin/sh
+cat <<EOF
+kind: ConfigMap
+metadata:
+  name: ${TAILOR_RENDER_PATH}
+data:
+  namespace: ${TAILOR_NAMESPACE}
+  size: "${SIZE}"
+  color: ${COLOR}
+  token: ${TOKEN}
+  cert: ${CERT}
+  password: ${PASSWORD}
+---
+kind: List
+items:
+- kind: Service
+  metadata:
+    name: ${TAILOR_RENDER_PATH}
+EOF
+`,
+		"templates/chart/Chart.yaml": "name: chart",
+		"params/chart.env":           "SIZE=1\nCOLOR=red\nTOKEN=${exec:echo s3cret}\nCERT.B64=${exec:echo Y2VydA==}\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Secrets are passed in cleartext.
+	encrypted, err := EncryptedParams("PASSWORD=secret\n", "", "chart.env.enc", ".", "test-private.key", "", "pgp", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "params/chart.env.enc"), []byte(encrypted), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		renderer    string
+		expected    string
+		expectedErr string
+	}{
+		"renders manifests": {
+			renderer: "./render.sh",
+			expected: `apiVersion: v1
+items:
+- data:
+    cert: cert
+    color: blue
+    namespace: foo
+    password: secret
+    size: "1"
+    token: s3cret
+  kind: ConfigMap
+  metadata:
+    labels:
+      app: foo
+    name: chart
+- kind: Service
+  metadata:
+    labels:
+      app: foo
+    name: chart
+kind: List
+metadata: {}
+`,
+		},
+		"fails with command": {
+			renderer:    "echo oops >&2; exit 3",
+			expectedErr: "Renderer 'echo oops >&2; exit 3' failed: exit status 3 oops",
+		},
+		"refuses templates": {
+			renderer:    "echo 'kind: Template'",
+			expectedErr: "Renderer 'echo 'kind: Template'' must write manifests, not a template",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			compareOptions := &cli.CompareOptions{
+				GlobalOptions:    cli.InitGlobalOptions(&utils.OsFS{}),
+				NamespaceOptions: &cli.NamespaceOptions{Namespace: "foo"},
+				Labels:           "app=foo",
+				Params:           []string{"COLOR=blue"},
+				PrivateKey:       "test-private.key",
+			}
+			template := &TemplateFile{
+				Dir:      filepath.Join(dir, "templates"),
+				Name:     "chart",
+				Renderer: tc.renderer,
+			}
+			b, err := RenderTemplate(template, filepath.Join(dir, "params"), compareOptions)
+			if len(tc.expectedErr) > 0 {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Fatalf("Expected error '%s', got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, string(b)); diff != "" {
+				t.Fatalf("Rendered manifests mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package openshift
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// ChangesetReportAPIVersion identifies the version of the machine-readable
+	// changeset format. It changes whenever the format changes incompatibly.
+	ChangesetReportAPIVersion = "tailor.opendevstack.org/v1alpha1"
+	// ChangesetReportKind is the kind of the machine-readable changeset format.
+	ChangesetReportKind = "Changeset"
+)
+
+// ChangesetReport is a machine-readable representation of a changeset.
+type ChangesetReport struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Namespace  string           `json:"namespace"`
+	Summary    ChangesetSummary `json:"summary"`
+	Changes    []*ChangeReport  `json:"changes"`
+}
+
+// ChangesetSummary counts the changes per action.
+type ChangesetSummary struct {
+	InSync int `json:"inSync"`
+	Create int `json:"create"`
+	Update int `json:"update"`
+	Delete int `json:"delete"`
+}
+
+// ChangeReport is a machine-readable representation of a change.
+type ChangeReport struct {
+	Action       string         `json:"action"`
+	Kind         string         `json:"kind"`
+	Name         string         `json:"name"`
+	Paths        []string       `json:"paths"`
+	Fields       []*FieldChange `json:"fields,omitempty"`
+	After        []string       `json:"after,omitempty"`
+	Overlays     []string       `json:"overlays,omitempty"`
+	CurrentState interface{}    `json:"currentState"`
+	DesiredState interface{}    `json:"desiredState"`
+}
+
+// NewChangesetReport creates a report of given changeset. Unless revealSecrets
+// is true, the secret data of Secret resources is redacted the same way as in
+// the human-readable output.
+func NewChangesetReport(namespace string, changeset *Changeset, revealSecrets bool) (*ChangesetReport, error) {
+	r := &ChangesetReport{
+		APIVersion: ChangesetReportAPIVersion,
+		Kind:       ChangesetReportKind,
+		Namespace:  namespace,
+		Summary: ChangesetSummary{
+			InSync: len(changeset.Noop),
+			Create: len(changeset.Create),
+			Update: len(changeset.Update),
+			Delete: len(changeset.Delete),
+		},
+		Changes: []*ChangeReport{},
+	}
+	// Same order as the human-readable output
+	groups := [][]*Change{changeset.Noop, changeset.Delete, changeset.Create, changeset.Update}
+	for _, changes := range groups {
+		for _, change := range changes {
+			cr, err := newChangeReport(change, revealSecrets)
+			if err != nil {
+				return nil, err
+			}
+			r.Changes = append(r.Changes, cr)
+		}
+	}
+	return r, nil
+}
+
+// Marshal serializes the report as either "json" or "yaml".
+func (r *ChangesetReport) Marshal(format string) ([]byte, error) {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	case "yaml":
+		return yaml.Marshal(r)
+	}
+	return nil, fmt.Errorf("Unknown format '%s'", format)
+}
+
+func newChangeReport(change *Change, revealSecrets bool) (*ChangeReport, error) {
+	cr := &ChangeReport{
+		Action:   change.Action,
+		Kind:     change.Kind,
+		Name:     change.Name,
+		Paths:    change.ChangedPaths,
+		After:    change.After,
+		Overlays: change.Overlays,
+	}
+	if cr.Paths == nil {
+		cr.Paths = []string{}
+	}
+	redact := change.isSecret() && !revealSecrets
+	for _, f := range change.Fields {
+		rf := *f
+		if redact && isSecretFieldPath(rf.Path) {
+			rf.Current = redactSecretField(rf.Path, rf.Current)
+			rf.Desired = redactSecretField(rf.Path, rf.Desired)
+		}
+		cr.Fields = append(cr.Fields, &rf)
+	}
+	currentState, err := unmarshalState(change.CurrentState, redact)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse current state of %s: %s", change.ItemName(), err)
+	}
+	cr.CurrentState = currentState
+	desiredState, err := unmarshalState(change.DesiredState, redact)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse desired state of %s: %s", change.ItemName(), err)
+	}
+	cr.DesiredState = desiredState
+	return cr, nil
+}
+
+// unmarshalState turns a YAML state into an object. An empty state is nil.
+func unmarshalState(state string, redact bool) (interface{}, error) {
+	if len(state) == 0 {
+		return nil, nil
+	}
+	var f interface{}
+	err := yaml.Unmarshal([]byte(state), &f)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := f.(map[string]interface{}); ok && redact {
+		redactSecretData(m)
+	}
+	return f, nil
+}
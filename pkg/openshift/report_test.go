@@ -0,0 +1,156 @@
+package openshift
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewChangesetReport(t *testing.T) {
+	platformInput := []byte(
+		`kind: Template
+apiVersion: v1
+objects:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: foo
+  data:
+    bar: baz
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: foo
+  data:
+    token: b2xk
+  type: Opaque
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: old
+  data:
+    bar: baz`)
+
+	templateInput := []byte(
+		`kind: List
+apiVersion: v1
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: foo
+  data:
+    bar: qux
+    new: value
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: foo
+    labels:
+      app: foo
+  data:
+    token: bmV3
+  type: Opaque`)
+
+	filter, err := NewResourceFilter("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changeset := getChangeset(t, filter, platformInput, templateInput, false, true, []string{})
+
+	tests := map[string]struct {
+		revealSecrets       bool
+		expectedSecretToken string
+	}{
+		"Secrets are redacted": {
+			revealSecrets:       false,
+			expectedSecretToken: redactedSecretValue("bmV3"),
+		},
+		"Secrets are revealed": {
+			revealSecrets:       true,
+			expectedSecretToken: "bmV3",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			report, err := NewChangesetReport("foo", changeset, tc.revealSecrets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := report.Marshal("json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := &ChangesetReport{}
+			err = json.Unmarshal(b, actual)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantSummary := ChangesetSummary{InSync: 0, Create: 0, Update: 2, Delete: 1}
+			if diff := cmp.Diff(wantSummary, actual.Summary); diff != "" {
+				t.Fatalf("Summary mismatch (-want +got):\n%s", diff)
+			}
+			if actual.APIVersion != ChangesetReportAPIVersion {
+				t.Fatalf("Expected apiVersion %s, got: %s", ChangesetReportAPIVersion, actual.APIVersion)
+			}
+
+			changes := map[string]*ChangeReport{}
+			for _, c := range actual.Changes {
+				changes[c.Action+":"+c.Kind+"/"+c.Name] = c
+			}
+
+			cm, ok := changes["Update:ConfigMap/foo"]
+			if !ok {
+				t.Fatalf("Expected update of ConfigMap/foo, got: %v", changes)
+			}
+			wantPaths := []string{"/data/bar", "/data/new"}
+			if diff := cmp.Diff(wantPaths, cm.Paths); diff != "" {
+				t.Fatalf("Paths mismatch (-want +got):\n%s", diff)
+			}
+
+			deletion, ok := changes["Delete:ConfigMap/old"]
+			if !ok {
+				t.Fatalf("Expected deletion of ConfigMap/old, got: %v", changes)
+			}
+			if deletion.DesiredState != nil {
+				t.Fatalf("Expected no desired state for deletion, got: %v", deletion.DesiredState)
+			}
+
+			secret, ok := changes["Update:Secret/foo"]
+			if !ok {
+				t.Fatalf("Expected update of Secret/foo, got: %v", changes)
+			}
+			desiredData := secret.DesiredState.(map[string]interface{})["data"].(map[string]interface{})
+			if desiredData["token"] != tc.expectedSecretToken {
+				t.Fatalf("Expected token to be %s, got: %s", tc.expectedSecretToken, desiredData["token"])
+			}
+			// Fields are redacted like the human-readable output: only
+			// secret data is hidden.
+			fields := map[string]interface{}{}
+			for _, f := range secret.Fields {
+				fields[f.Path] = f.Desired
+			}
+			wantFields := map[string]interface{}{
+				"/data/token":      tc.expectedSecretToken,
+				"/metadata/labels": map[string]interface{}{"app": "foo"},
+			}
+			if diff := cmp.Diff(wantFields, fields); diff != "" {
+				t.Fatalf("Fields mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestChangesetReportMarshalUnknownFormat(t *testing.T) {
+	report, err := NewChangesetReport("foo", &Changeset{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = report.Marshal("xml")
+	if err == nil {
+		t.Fatal("Expected error for unknown format")
+	}
+}
@@ -5,6 +5,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -14,35 +18,146 @@ import (
 	"github.com/xeipuuv/gojsonpointer"
 )
 
-// ExportAsTemplateFile exports resources in template format.
-func ExportAsTemplateFile(filter *ResourceFilter, withAnnotations bool, ocClient cli.OcClientExporter) (string, error) {
+// ExportAsTemplateFile exports resources in template format. If parameterizer
+// is given, environment-specific values are replaced by parameters.
+func ExportAsTemplateFile(filter *ResourceFilter, withAnnotations bool, parameterizer *Parameterizer, ocClient cli.OcClientExporter) (string, error) {
+	m, err := exportTemplate(filter, withAnnotations, ocClient)
+	if err != nil || m == nil {
+		return "", err
+	}
+	if parameterizer != nil {
+		objects, _ := m["objects"].([]interface{})
+		parameterizer.Parameterize(objects)
+		m["parameters"], _ = parameterizer.Parameters(objects)
+	}
+
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf(
+			"Could not marshal modified template: %s", err,
+		)
+	}
+
+	return string(b), err
+}
+
+// ExportedTemplate is one of the templates exported by ExportAsTemplateFiles.
+type ExportedTemplate struct {
+	Content string
+	// Params are the values of the parameters of the template (if it was
+	// parameterized), except TAILOR_NAMESPACE.
+	Params map[string]string
+}
+
+// ExportAsTemplateFiles exports resources in template format, split into
+// several templates. splitBy is one of "app" (by the "app" label), "kind" or
+// "resource" (one template per resource). The result maps the file name of
+// each template to the template. Both do not depend on the order of the
+// exported resources, so that exporting again leads to the same files. If
+// parameterizer is given, environment-specific values are replaced by
+// parameters, which are shared across the templates.
+func ExportAsTemplateFiles(filter *ResourceFilter, withAnnotations bool, splitBy string, parameterizer *Parameterizer, ocClient cli.OcClientExporter) (map[string]*ExportedTemplate, error) {
+	files := map[string]*ExportedTemplate{}
+	m, err := exportTemplate(filter, withAnnotations, ocClient)
+	if err != nil || m == nil {
+		return files, err
+	}
+
+	groups := map[string][]*ResourceItem{}
+	configs := []interface{}{}
+	objects, _ := m["objects"].([]interface{})
+	for _, v := range objects {
+		item, err := NewResourceItem(v.(map[string]interface{}), "platform")
+		if err != nil {
+			return files, fmt.Errorf(
+				"Could not parse object of exported template: %s", err,
+			)
+		}
+		var group string
+		switch splitBy {
+		case "app":
+			group = "unlabeled"
+			if app, ok := item.Labels["app"].(string); ok && len(app) > 0 {
+				group = app
+			}
+		case "kind":
+			group = strings.ToLower(item.Kind)
+		case "resource":
+			group = strings.ToLower(item.Kind) + "-" + item.Name
+		default:
+			return files, fmt.Errorf("Unknown split-by '%s'", splitBy)
+		}
+		filename := templateFileNameExp.ReplaceAllString(group, "-") + ".yml"
+		groups[filename] = append(groups[filename], item)
+		configs = append(configs, item.Config)
+	}
+	// Parameters are shared, and the grouping must not depend on them.
+	if parameterizer != nil {
+		parameterizer.Parameterize(configs)
+	}
+
+	for filename, items := range groups {
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].FullName() < items[j].FullName()
+		})
+		groupObjects := []interface{}{}
+		for _, item := range items {
+			groupObjects = append(groupObjects, item.Config)
+		}
+		t := map[string]interface{}{}
+		for k, v := range m {
+			t[k] = v
+		}
+		t["objects"] = groupObjects
+		exported := &ExportedTemplate{}
+		if parameterizer != nil {
+			t["parameters"], exported.Params = parameterizer.Parameters(groupObjects)
+		}
+		b, err := yaml.Marshal(t)
+		if err != nil {
+			return files, fmt.Errorf(
+				"Could not marshal template %s: %s", filename, err,
+			)
+		}
+		exported.Content = string(b)
+		files[filename] = exported
+	}
+	return files, nil
+}
+
+// templateFileNameExp matches characters not allowed in exported file names.
+var templateFileNameExp = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// exportTemplate exports resources as template, without its metadata. The
+// template is nil if no resources were exported.
+func exportTemplate(filter *ResourceFilter, withAnnotations bool, ocClient cli.OcClientExporter) (map[string]interface{}, error) {
 	outBytes, err := ocClient.Export(filter.ConvertToKinds(), filter.Label)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if len(outBytes) == 0 {
-		return "", nil
+		return nil, nil
 	}
 
 	var f interface{}
 	err = yaml.Unmarshal(outBytes, &f)
 	if err != nil {
 		err = utils.DisplaySyntaxError(outBytes, err)
-		return "", err
+		return nil, err
 	}
 	m := f.(map[string]interface{})
 
 	objectsPointer, _ := gojsonpointer.NewJsonPointer("/objects")
 	items, _, err := objectsPointer.Get(m)
 	if err != nil {
-		return "", fmt.Errorf(
+		return nil, fmt.Errorf(
 			"Could not get objects of exported template: %s", err,
 		)
 	}
 	for k, v := range items.([]interface{}) {
 		item, err := NewResourceItem(v.(map[string]interface{}), "platform")
 		if err != nil {
-			return "", fmt.Errorf(
+			return nil, fmt.Errorf(
 				"Could not parse object of exported template: %s", err,
 			)
 		}
@@ -67,57 +182,242 @@ func ExportAsTemplateFile(filter *ResourceFilter, withAnnotations bool, ocClient
 		cli.DebugMsg("Could not delete metadata from template")
 	}
 
-	b, err := yaml.Marshal(m)
-	if err != nil {
-		return "", fmt.Errorf(
-			"Could not marshal modified template: %s", err,
-		)
-	}
+	return m, nil
+}
 
-	return string(b), err
+// defaultTemplatePatterns are used when no patterns to include are given.
+var defaultTemplatePatterns = []string{"*.yml", "*.yaml"}
+
+// TemplateFile is a template found in one of the template dirs. Name is the
+// path relative to the template dir, which determines the param file. If
+// Renderer is set, the template (which might be a directory) is rendered by
+// that command instead of being processed.
+type TemplateFile struct {
+	Dir      string
+	Name     string
+	Renderer string
 }
 
-// ProcessTemplate processes template "name" in "templateDir".
-func ProcessTemplate(templateDir string, name string, paramDir string, compareOptions *cli.CompareOptions, ocClient cli.OcClientProcessor) ([]byte, error) {
-	filename := templateDir + string(os.PathSeparator) + name
+// Path returns the path of the template file.
+func (f *TemplateFile) Path() string {
+	return filepath.Join(f.Dir, f.Name)
+}
 
-	args := []string{"--filename=" + filename, "--output=yaml"}
+// FindTemplates returns the templates in given dirs which match any of the
+// include patterns (by default "*.yml" and "*.yaml") and none of the exclude
+// patterns. Subdirectories (except hidden ones) are searched if recursive is
+// true. Patterns are matched against the path relative to the template dir,
+// or against the base name if they do not contain a "/". Files and
+// directories matching the pattern of a renderer (given as PATTERN=COMMAND)
+// are returned with that renderer, regardless of the include patterns. Files
+// given in skipFiles (such as the recipients policy) are never returned.
+func FindTemplates(dirs []string, recursive bool, include []string, exclude []string, renderers []string, skipFiles []string) ([]*TemplateFile, error) {
+	if len(include) == 0 {
+		include = defaultTemplatePatterns
+	}
+	skipped := map[string]bool{}
+	for _, f := range skipFiles {
+		if abs, err := filepath.Abs(f); err == nil {
+			skipped[abs] = true
+		}
+	}
+	templates := []*TemplateFile{}
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if p == dir {
+				return nil
+			}
+			name, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			hidden := info.IsDir() && strings.HasPrefix(info.Name(), ".")
+			if hidden || matchesTemplatePattern(exclude, name) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if abs, err := filepath.Abs(p); err == nil && skipped[abs] {
+				cli.DebugMsg("Skipping", p, "as it is not a template")
+				return nil
+			}
+			if renderer := matchingRenderer(renderers, name); len(renderer) > 0 {
+				templates = append(templates, &TemplateFile{Dir: dir, Name: name, Renderer: renderer})
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() {
+				if !recursive {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if matchesTemplatePattern(include, name) {
+				templates = append(templates, &TemplateFile{Dir: dir, Name: name})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
 
-	if len(compareOptions.Labels) > 0 {
-		args = append(args, "--labels="+compareOptions.Labels)
+// matchingRenderer returns the command of the first renderer whose pattern
+// matches name, or an empty string.
+func matchingRenderer(renderers []string, name string) string {
+	for _, r := range renderers {
+		pair := strings.SplitN(r, "=", 2)
+		if len(pair) == 2 && matchesTemplatePattern(pair[:1], name) {
+			return pair[1]
+		}
 	}
+	return ""
+}
 
-	for _, param := range compareOptions.Params {
-		args = append(args, "--param="+param)
+func matchesTemplatePattern(patterns []string, name string) bool {
+	name = filepath.ToSlash(name)
+	for _, pattern := range patterns {
+		target := name
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(name)
+		}
+		if matched, _ := path.Match(pattern, target); matched {
+			return true
+		}
 	}
-	containsNamespace, err := templateContainsTailorNamespaceParam(filename)
+	return false
+}
+
+// ProcessTemplate processes template "name" in "templateDir". The name might
+// contain subdirectories, which are taken into account for the param file.
+// Instead of a template, the file might contain plain manifests, in which
+// params are substituted only if compareOptions.SubstituteParams is set.
+func ProcessTemplate(templateDir string, name string, paramDir string, compareOptions *cli.CompareOptions, ocClient cli.OcClientProcessor) ([]byte, error) {
+	filename := templateDir + string(os.PathSeparator) + name
+
+	templateBytes, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return []byte{}, err
 	}
-	if containsNamespace {
-		args = append(args, "--param=TAILOR_NAMESPACE="+compareOptions.Namespace)
+	objects, isTemplate, err := splitManifest(templateBytes)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	// Manifests might contain "${...}" for other purposes, e.g. in scripts,
+	// so they are taken as they are unless asked otherwise.
+	if !isTemplate && !compareOptions.SubstituteParams {
+		outBytes, err := processManifest(objects, compareOptions.Labels, nil, nil)
+		if err != nil {
+			return []byte{}, err
+		}
+		cli.DebugMsg("Processed manifest:", filename)
+		return outBytes, nil
+	}
+
+	params := append([]string{}, compareOptions.Params...)
+	if isTemplate {
+		containsNamespace, err := templateContainsTailorNamespaceParam(filename)
+		if err != nil {
+			return []byte{}, err
+		}
+		if containsNamespace {
+			params = append(params, "TAILOR_NAMESPACE="+compareOptions.Namespace)
+		}
+	} else {
+		// Manifests do not declare parameters, so the namespace is always
+		// available (unless given explicitly).
+		params = append([]string{"TAILOR_NAMESPACE=" + compareOptions.Namespace}, params...)
 	}
 
 	actualParamFiles := calculateParamFiles(name, paramDir, compareOptions)
 
-	// Now turn the param files into arguments for the oc binary
+	paramFileBytes := []byte{}
+	containsResolved := false
 	if len(actualParamFiles) > 0 {
-		paramFileBytes, err := readParamFileBytes(
+		paramFileBytes, containsResolved, err = readParamFileBytes(
 			actualParamFiles,
 			compareOptions.PrivateKey,
 			compareOptions.Passphrase,
+			false,
+		)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	// Plain manifests are not processed by oc, only params are substituted.
+	if !isTemplate {
+		outBytes, err := processManifest(
+			objects,
+			compareOptions.Labels,
+			params,
+			paramFileBytes,
 		)
 		if err != nil {
 			return []byte{}, err
 		}
-		tempParamFile := ".combined.env"
-		defer os.Remove(tempParamFile)
-		cli.DebugMsg("Writing contents of param files into", tempParamFile)
-		err = ioutil.WriteFile(tempParamFile, paramFileBytes, 0644)
+		cli.DebugMsg("Processed manifest:", filename)
+		return outBytes, nil
+	}
+
+	// Values of secret providers must not be written to disk, which would
+	// be required to pass them to oc.
+	localProcessing := compareOptions.LocalProcessing
+	if !localProcessing && containsResolved {
+		cli.DebugMsg("Processing template locally as params reference secret providers:", filename)
+		localProcessing = true
+	}
+
+	if localProcessing {
+		outBytes, err := processTemplateLocally(
+			templateBytes,
+			compareOptions.Labels,
+			params,
+			paramFileBytes,
+			compareOptions.IgnoreUnknownParameters,
+		)
 		if err != nil {
 			return []byte{}, err
 		}
-		args = append(args, "--param-file="+tempParamFile)
+		cli.DebugMsg("Processed template locally:", filename)
+		return outBytes, nil
+	}
+
+	args := []string{"--filename=" + filename, "--output=yaml"}
+
+	if len(compareOptions.Labels) > 0 {
+		args = append(args, "--labels="+compareOptions.Labels)
+	}
+
+	for _, param := range params {
+		args = append(args, "--param="+param)
+	}
+
+	// Now turn the param files into arguments for the oc binary
+	if len(actualParamFiles) > 0 {
+		// Use a unique file as templates of several namespaces might be
+		// processed at the same time.
+		tempParamFile, err := ioutil.TempFile("", "tailor-*.env")
+		if err != nil {
+			return []byte{}, err
+		}
+		defer os.Remove(tempParamFile.Name())
+		cli.DebugMsg("Writing contents of param files into", tempParamFile.Name())
+		_, err = tempParamFile.Write(paramFileBytes)
+		tempParamFile.Close()
+		if err != nil {
+			return []byte{}, err
+		}
+		args = append(args, "--param-file="+tempParamFile.Name())
 	}
 
 	if compareOptions.IgnoreUnknownParameters {
@@ -177,9 +477,7 @@ func calculateParamFiles(name string, paramDir string, compareOptions *cli.Compa
 
 		cli.DebugMsg(fmt.Sprintf("Looking for param files in '%s'", paramDir))
 
-		fileParts := strings.Split(name, ".")
-		fileParts[len(fileParts)-1] = "env"
-		f := strings.Join(fileParts, ".")
+		f := strings.TrimSuffix(name, filepath.Ext(name)) + ".env"
 		if paramDir != "." {
 			f = paramDir + string(os.PathSeparator) + f
 		}
@@ -198,19 +496,30 @@ func calculateParamFiles(name string, paramDir string, compareOptions *cli.Compa
 	return files
 }
 
-func readParamFileBytes(paramFiles []string, privateKey string, passphrase string) ([]byte, error) {
+// readParamFileBytes concatenates the given param files and their encrypted
+// counterparts. Params referencing a secret provider are resolved in place.
+// Secret values are base64-encoded as expected by templates, or cleartext if
+// decoded is true (see DecodedParams). It is returned whether any param was
+// resolved, in which case the content must never be written to disk.
+func readParamFileBytes(paramFiles []string, privateKey string, passphrase string, decoded bool) ([]byte, bool, error) {
 	paramFileBytes := []byte{}
+	containsResolved := false
 	for _, f := range paramFiles {
 		cli.DebugMsg("Reading content of param file", f)
 		b, err := ioutil.ReadFile(f)
 		if err != nil {
-			return []byte{}, err
+			return []byte{}, false, err
 		}
 		eol := []byte("\n")
 		if !bytes.HasSuffix(b, eol) {
 			b = append(b, eol...)
 		}
-		paramFileBytes = append(paramFileBytes, b...)
+		content, resolved, err := resolveSecretReferences(string(b), decoded)
+		if err != nil {
+			return []byte{}, false, err
+		}
+		paramFileBytes = append(paramFileBytes, []byte(content)...)
+		containsResolved = containsResolved || resolved
 		// Check if encrypted param file exists, and if so, decrypt and
 		// append its content
 		encFile := f + ".enc"
@@ -218,14 +527,18 @@ func readParamFileBytes(paramFiles []string, privateKey string, passphrase strin
 			cli.DebugMsg("Reading content of encrypted param file", encFile)
 			b, err := ioutil.ReadFile(encFile)
 			if err != nil {
-				return []byte{}, err
+				return []byte{}, false, err
+			}
+			params := EncodedParams
+			if decoded {
+				params = DecodedParams
 			}
-			encoded, err := EncodedParams(string(b), privateKey, passphrase)
+			content, err := params(string(b), privateKey, passphrase)
 			if err != nil {
-				return []byte{}, err
+				return []byte{}, false, fmt.Errorf("Could not read %s: %s", encFile, err)
 			}
-			paramFileBytes = append(paramFileBytes, []byte(encoded)...)
+			paramFileBytes = append(paramFileBytes, []byte(content)...)
 		}
 	}
-	return paramFileBytes, nil
+	return paramFileBytes, containsResolved, nil
 }
@@ -1,8 +1,12 @@
 package openshift
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/ghodss/yaml"
 	"github.com/google/go-cmp/cmp"
 	"github.com/opendevstack/tailor/internal/test/helper"
 	"github.com/opendevstack/tailor/pkg/cli"
@@ -49,7 +53,7 @@ func TestExportAsTemplateFile(t *testing.T) {
 			}
 
 			c := &mockOcExportClient{t: t, fixture: tc.fixture}
-			actual, err := ExportAsTemplateFile(filter, tc.withAnnotations, c)
+			actual, err := ExportAsTemplateFile(filter, tc.withAnnotations, nil, c)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -63,6 +67,74 @@ func TestExportAsTemplateFile(t *testing.T) {
 	}
 }
 
+func TestExportAsTemplateFiles(t *testing.T) {
+	tests := map[string]struct {
+		splitBy  string
+		expected map[string][]string
+	}{
+		"By app": {
+			splitBy: "app",
+			expected: map[string][]string{
+				"bar.yml":       {"ConfigMap/bar"},
+				"foo.yml":       {"ConfigMap/foo", "Service/foo"},
+				"unlabeled.yml": {"ServiceAccount/builder"},
+			},
+		},
+		"By kind": {
+			splitBy: "kind",
+			expected: map[string][]string{
+				"configmap.yml":      {"ConfigMap/bar", "ConfigMap/foo"},
+				"service.yml":        {"Service/foo"},
+				"serviceaccount.yml": {"ServiceAccount/builder"},
+			},
+		},
+		"By resource": {
+			splitBy: "resource",
+			expected: map[string][]string{
+				"configmap-bar.yml":          {"ConfigMap/bar"},
+				"configmap-foo.yml":          {"ConfigMap/foo"},
+				"service-foo.yml":            {"Service/foo"},
+				"serviceaccount-builder.yml": {"ServiceAccount/builder"},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			filter, err := NewResourceFilter("svc,cm", "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &mockOcExportClient{t: t, fixture: "split.yml"}
+			files, err := ExportAsTemplateFiles(filter, false, tc.splitBy, nil, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := map[string][]string{}
+			for filename, exported := range files {
+				var f map[string]interface{}
+				err := yaml.Unmarshal([]byte(exported.Content), &f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if f["kind"] != "Template" {
+					t.Fatalf("%s should be a template, got kind %v", filename, f["kind"])
+				}
+				for _, o := range f["objects"].([]interface{}) {
+					item, err := NewResourceItem(o.(map[string]interface{}), "template")
+					if err != nil {
+						t.Fatal(err)
+					}
+					actual[filename] = append(actual[filename], item.FullName())
+				}
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Fatalf("Templates mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestTemplateContainsTailorNamespaceParam(t *testing.T) {
 	contains, err := templateContainsTailorNamespaceParam("../../internal/test/fixtures/template-with-tailor-namespace-param.yml")
 	if err != nil {
@@ -122,6 +194,14 @@ func TestCalculateParamFiles(t *testing.T) {
 			fs:            &helper.SomeFilesExistFS{Existing: []string{"foo", "foo.env"}},
 			expected:      []string{"foo.env"},
 		},
+		"nested template maps to param file at same relative path": {
+			namespace:     "foo",
+			templateName:  "backend/bar.yml",
+			paramDir:      "params",
+			paramFileFlag: []string{},
+			fs:            &helper.SomeFilesExistFS{Existing: []string{"params/backend/bar.env", "params/bar.env"}},
+			expected:      []string{"params/backend/bar.env"},
+		},
 		"param env file is given explicitly": {
 			namespace:     "foo",
 			templateName:  "bar.yml",
@@ -148,10 +228,117 @@ func TestCalculateParamFiles(t *testing.T) {
 	}
 }
 
+func TestFindTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailor-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, f := range []string{
+		"shared/route.yml",
+		"app/svc.yml",
+		"app/backend/dc.yaml",
+		"app/backend/README.md",
+		"app/legacy/dc.yml",
+		"app/.hidden/dc.yml",
+		"app/is.yml",
+		"app/is-test.yml",
+		"app/recipients.yml",
+	} {
+		p := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := map[string]struct {
+		dirs      []string
+		recursive bool
+		include   []string
+		exclude   []string
+		renderers []string
+		// The policy is skipped unless keepPolicy is set.
+		keepPolicy bool
+		expected   []string
+	}{
+		"only files in dir": {
+			dirs:     []string{"app"},
+			expected: []string{"app:is-test.yml", "app:is.yml", "app:svc.yml"},
+		},
+		"without skipped files": {
+			dirs:       []string{"app"},
+			keepPolicy: true,
+			expected:   []string{"app:is-test.yml", "app:is.yml", "app:recipients.yml", "app:svc.yml"},
+		},
+		"recursive skips hidden dirs": {
+			dirs:      []string{"app"},
+			recursive: true,
+			expected:  []string{"app:backend/dc.yaml", "app:is-test.yml", "app:is.yml", "app:legacy/dc.yml", "app:svc.yml"},
+		},
+		"multiple dirs with exclude": {
+			dirs:      []string{"shared", "app"},
+			recursive: true,
+			exclude:   []string{"legacy", "*-test.yml"},
+			expected:  []string{"shared:route.yml", "app:backend/dc.yaml", "app:is.yml", "app:svc.yml"},
+		},
+		"include by relative path": {
+			dirs:      []string{"app"},
+			recursive: true,
+			include:   []string{"backend/*"},
+			expected:  []string{"app:backend/README.md", "app:backend/dc.yaml"},
+		},
+		"renderer for dir": {
+			dirs:      []string{"app"},
+			renderers: []string{"backend=kustomize build backend"},
+			expected:  []string{"app:backend (kustomize build backend)", "app:is-test.yml", "app:is.yml", "app:svc.yml"},
+		},
+		"renderer for files": {
+			dirs:      []string{"app"},
+			recursive: true,
+			exclude:   []string{"legacy"},
+			renderers: []string{"*.md=cat $TAILOR_RENDER_PATH", "*.yml=a=b"},
+			expected:  []string{"app:backend/README.md (cat $TAILOR_RENDER_PATH)", "app:backend/dc.yaml", "app:is-test.yml (a=b)", "app:is.yml (a=b)", "app:svc.yml (a=b)"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dirs := []string{}
+			for _, d := range tc.dirs {
+				dirs = append(dirs, filepath.Join(dir, d))
+			}
+			skipFiles := []string{filepath.Join(dir, "app/recipients.yml")}
+			if tc.keepPolicy {
+				skipFiles = []string{}
+			}
+			templates, err := FindTemplates(dirs, tc.recursive, tc.include, tc.exclude, tc.renderers, skipFiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := []string{}
+			for _, template := range templates {
+				rel, _ := filepath.Rel(dir, template.Dir)
+				entry := rel + ":" + filepath.ToSlash(template.Name)
+				if len(template.Renderer) > 0 {
+					entry += " (" + template.Renderer + ")"
+				}
+				actual = append(actual, entry)
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Fatalf("Templates mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestReadParamFileBytes(t *testing.T) {
 	tests := map[string]struct {
-		paramFiles []string
-		expected   string
+		paramFiles       []string
+		expected         string
+		expectedResolved bool
+		expectedPassword string
 	}{
 		"multiple files get concatenated": {
 			paramFiles: []string{"foo.env", "bar.env"},
@@ -161,6 +348,18 @@ func TestReadParamFileBytes(t *testing.T) {
 			paramFiles: []string{"baz-without-eol.env", "bar.env"},
 			expected:   "BAZ=baz\nBAR=bar\n",
 		},
+		"secret references are resolved in place": {
+			paramFiles:       []string{"secret-references.env", "bar.env"},
+			expected:         "FOO=foo\nPASSWORD=czNjcmV0\nTOKEN=dG9rZW4=\nBAR=bar\n",
+			expectedResolved: true,
+			expectedPassword: "czNjcmV0",
+		},
+		"later plain values take precedence over resolved values": {
+			paramFiles:       []string{"secret-references.env", "password.env"},
+			expected:         "FOO=foo\nPASSWORD=czNjcmV0\nTOKEN=dG9rZW4=\nPASSWORD=plain\n",
+			expectedResolved: true,
+			expectedPassword: "plain",
+		},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -168,7 +367,7 @@ func TestReadParamFileBytes(t *testing.T) {
 			for _, f := range tc.paramFiles {
 				actualParamFiles = append(actualParamFiles, "../../internal/test/fixtures/param-files/"+f)
 			}
-			b, err := readParamFileBytes(actualParamFiles, "", "")
+			b, resolved, err := readParamFileBytes(actualParamFiles, "", "", false)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -176,6 +375,16 @@ func TestReadParamFileBytes(t *testing.T) {
 			if diff := cmp.Diff(tc.expected, got); diff != "" {
 				t.Fatalf("Result is not expected (-want +got):\n%s", diff)
 			}
+			if resolved != tc.expectedResolved {
+				t.Fatalf("Expected resolved to be %v, got: %v", tc.expectedResolved, resolved)
+			}
+			values, err := parameterValues([]string{}, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if values["PASSWORD"] != tc.expectedPassword {
+				t.Fatalf("Expected PASSWORD '%s', got: '%s'", tc.expectedPassword, values["PASSWORD"])
+			}
 		})
 	}
 }
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"filippo.io/age"
+)
+
+const (
+	ageIntro            = "age-encryption.org/v1"
+	ageRecipientHRP     = "age"
+	ageIdentityHRP      = "AGE-SECRET-KEY-"
+	ageStanzaPrefix     = "-> "
+	ageMACPrefix        = "---"
+	ageX25519StanzaType = "X25519"
+)
+
+// AgeRecipient is the public part of an X25519 key.
+type AgeRecipient = age.X25519Recipient
+
+// AgeIdentity is the secret part of an X25519 key.
+type AgeIdentity = age.X25519Identity
+
+// GenerateAgeIdentity creates a new random X25519 identity.
+func GenerateAgeIdentity() (*AgeIdentity, error) {
+	return age.GenerateX25519Identity()
+}
+
+// ParseAgeRecipient parses a recipient such as "age1...".
+func ParseAgeRecipient(s string) (*AgeRecipient, error) {
+	r, err := age.ParseX25519Recipient(s)
+	if err != nil {
+		return nil, fmt.Errorf("Malformed age recipient: %s", err)
+	}
+	return r, nil
+}
+
+// ParseAgeIdentity parses an identity such as "AGE-SECRET-KEY-1...".
+func ParseAgeIdentity(s string) (*AgeIdentity, error) {
+	i, err := age.ParseX25519Identity(s)
+	if err != nil {
+		return nil, fmt.Errorf("Malformed age identity: %s", err)
+	}
+	return i, nil
+}
+
+// AgeEncrypt encrypts plaintext for all recipients.
+func AgeEncrypt(plaintext []byte, recipients []*AgeRecipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("No age recipients given")
+	}
+	rs := []age.Recipient{}
+	for _, r := range recipients {
+		rs = append(rs, r)
+	}
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, rs...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// AgeDecrypt decrypts ciphertext with the first matching identity.
+func AgeDecrypt(ciphertext []byte, identities []*AgeIdentity) ([]byte, error) {
+	if len(identities) == 0 {
+		return nil, errors.New("No age identities given")
+	}
+	ids := []age.Identity{}
+	for _, i := range identities {
+		ids = append(ids, i)
+	}
+	r, err := age.Decrypt(bytes.NewReader(ciphertext), ids...)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+// AgeRecipientCount returns the number of X25519 recipients of a value
+// returned by AgeBackend.Encrypt. age does not reveal who the recipients are.
+func AgeRecipientCount(encoded string) (int, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encoded, agePrefix))
+	if err != nil {
+		return 0, fmt.Errorf("Decoding '%s' failed: %s", encoded, err)
+	}
+	lines := strings.Split(string(encrypted), "\n")
+	if lines[0] != ageIntro {
+		return 0, fmt.Errorf("unsupported age format: %s", lines[0])
+	}
+	n := 0
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(line, ageMACPrefix) {
+			return n, nil
+		}
+		if strings.HasPrefix(line, ageStanzaPrefix+ageX25519StanzaType+" ") {
+			n++
+		}
+	}
+	return 0, errors.New("malformed age header")
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAgeKeys(t *testing.T) {
+	identity, err := GenerateAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(identity.String(), "AGE-SECRET-KEY-1") {
+		t.Fatalf("Unexpected identity format: %s", identity)
+	}
+	if !strings.HasPrefix(identity.Recipient().String(), "age1") {
+		t.Fatalf("Unexpected recipient format: %s", identity.Recipient())
+	}
+	parsedIdentity, err := ParseAgeIdentity(identity.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsedIdentity.Recipient().String() != identity.Recipient().String() {
+		t.Fatal("Parsed identity does not match")
+	}
+	parsedRecipient, err := ParseAgeRecipient(identity.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsedRecipient.String() != identity.Recipient().String() {
+		t.Fatal("Parsed recipient does not match")
+	}
+	if _, err := ParseAgeRecipient(identity.String()); err == nil {
+		t.Fatal("Expected identity not to be accepted as recipient")
+	}
+}
+
+func TestAgeEncryptDecrypt(t *testing.T) {
+	alice, _ := GenerateAgeIdentity()
+	bob, _ := GenerateAgeIdentity()
+	eve, _ := GenerateAgeIdentity()
+
+	tests := map[string][]byte{
+		"empty":            {},
+		"short":            []byte("s3cr3t"),
+		"one full chunk":   bytes.Repeat([]byte("a"), 64*1024),
+		"multiple chunks":  bytes.Repeat([]byte("b"), 2*64*1024+17),
+		"long stanza body": bytes.Repeat([]byte("c"), 48),
+	}
+	for name, plaintext := range tests {
+		t.Run(name, func(t *testing.T) {
+			ciphertext, err := AgeEncrypt(plaintext, []*AgeRecipient{alice.Recipient(), bob.Recipient()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(ciphertext, []byte("age-encryption.org/v1\n-> X25519 ")) {
+				t.Fatalf("Unexpected header: %q", ciphertext[:40])
+			}
+			for _, i := range []*AgeIdentity{alice, bob} {
+				decrypted, err := AgeDecrypt(ciphertext, []*AgeIdentity{i})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(plaintext, decrypted) {
+					t.Fatal("Decrypted plaintext does not match")
+				}
+			}
+			if _, err := AgeDecrypt(ciphertext, []*AgeIdentity{eve}); err == nil {
+				t.Fatal("Expected decryption with other identity to fail")
+			}
+			tampered := append([]byte{}, ciphertext...)
+			tampered[len(tampered)-1] ^= 1
+			if _, err := AgeDecrypt(tampered, []*AgeIdentity{alice}); err == nil {
+				t.Fatal("Expected decryption of tampered ciphertext to fail")
+			}
+		})
+	}
+}
+
+// TestAgeKnownAnswer decrypts a file produced by the age reference
+// implementation (testdata/example.age of filippo.io/age).
+func TestAgeKnownAnswer(t *testing.T) {
+	identity, err := ParseAgeIdentity("AGE-SECRET-KEY-184JMZMVQH3E6U0PSL869004Y3U2NYV7R30EU99CSEDNPH02YUVFSZW44VU")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := "age:YWdlLWVuY3J5cHRpb24ub3JnL3YxCi0+IFgyNTUxOSA4aHJsTStaQkczRGQ0ZkYyK2E1ODN6ZFRJV0RrOC9SNDFrQ1lac3Z3VFc0CnlPNFBZZGxNV0RKK0N4Z1VOUnFZNVowVC9tK2czRkNoNWpJeEdMYkNWWGMKLS0tIEkvaW1ldlp6eTgxMjBKU3ptSm5tbi9LTWszcDVBMTFWODNOazQxbTlOUEUKcMXlNiShUgdT+Sxa0Q7KsnO6TWEXgHcT6DggQXod8soIGCJyyPhchXc0oTEaO3XpjQ6v"
+	b := &AgeBackend{Identities: []*AgeIdentity{identity}}
+	decrypted, err := b.Decrypt(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted != "Black lives matter." {
+		t.Fatalf("Unexpected plaintext: %q", decrypted)
+	}
+	n, err := AgeRecipientCount(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("Expected 1 recipient, got %d", n)
+	}
+}
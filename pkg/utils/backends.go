@@ -0,0 +1,236 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+const (
+	// PGPEncryption identifies the OpenPGP backend. Its ciphertexts are not
+	// prefixed to stay compatible with earlier versions.
+	PGPEncryption = "pgp"
+	// AgeEncryption identifies the age (X25519) backend.
+	AgeEncryption = "age"
+
+	agePrefix = AgeEncryption + ":"
+)
+
+// EncryptionBackends lists all supported backends.
+var EncryptionBackends = []string{PGPEncryption, AgeEncryption}
+
+// EncryptionBackend encrypts values for a set of public keys, and decrypts
+// values with a private key.
+type EncryptionBackend interface {
+	// Name identifies the backend (see EncryptionOf).
+	Name() string
+	Encrypt(secret string) (string, error)
+	Decrypt(encoded string) (string, error)
+}
+
+// EncryptionOf returns the name of the backend which encrypted the value.
+func EncryptionOf(encoded string) string {
+	if strings.HasPrefix(encoded, agePrefix) {
+		return AgeEncryption
+	}
+	return PGPEncryption
+}
+
+// PGPBackend encrypts with OpenPGP.
+type PGPBackend struct {
+	PublicEntityList  openpgp.EntityList
+	PrivateEntityList openpgp.EntityList
+}
+
+// Name returns "pgp".
+func (b *PGPBackend) Name() string {
+	return PGPEncryption
+}
+
+// Encrypt encrypts for all public keys.
+func (b *PGPBackend) Encrypt(secret string) (string, error) {
+	if len(b.PublicEntityList) == 0 {
+		return "", errors.New("No PGP public keys found")
+	}
+	return Encrypt(secret, b.PublicEntityList)
+}
+
+// Decrypt decrypts with the private key.
+func (b *PGPBackend) Decrypt(encoded string) (string, error) {
+	if len(b.PrivateEntityList) == 0 {
+		return "", errors.New("No PGP private key given")
+	}
+	return Decrypt(encoded, b.PrivateEntityList)
+}
+
+// AgeBackend encrypts with age, using X25519 keys.
+type AgeBackend struct {
+	Recipients []*AgeRecipient
+	Identities []*AgeIdentity
+}
+
+// Name returns "age".
+func (b *AgeBackend) Name() string {
+	return AgeEncryption
+}
+
+// Encrypt encrypts for all recipients, and returns the base64-encoded
+// ciphertext prefixed with "age:".
+func (b *AgeBackend) Encrypt(secret string) (string, error) {
+	if len(b.Recipients) == 0 {
+		return "", errors.New("No age public keys found")
+	}
+	encrypted, err := AgeEncrypt([]byte(secret), b.Recipients)
+	if err != nil {
+		return "", err
+	}
+	return agePrefix + base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// Decrypt decrypts a value returned by Encrypt.
+func (b *AgeBackend) Decrypt(encoded string) (string, error) {
+	if len(b.Identities) == 0 {
+		return "", errors.New("No age private key given")
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encoded, agePrefix))
+	if err != nil {
+		return "", fmt.Errorf("Decoding '%s' failed: %s", encoded, err)
+	}
+	decrypted, err := AgeDecrypt(encrypted, b.Identities)
+	if err != nil {
+		return "", fmt.Errorf("Decrypting '%s' failed: %s", encoded, err)
+	}
+	return string(decrypted), nil
+}
+
+// NewEncryptionBackends assembles all backends from the given key files. The
+// backend a key belongs to is determined by the content of the key file:
+// age keys are given as "age1..." (public) or "AGE-SECRET-KEY-1..."
+// (private), everything else is expected to be an armored PGP key. The
+// private key is optional.
+func NewEncryptionBackends(publicKeyFiles []string, privateKeyFile string, passphrase string) (map[string]EncryptionBackend, error) {
+	pgpBackend := &PGPBackend{}
+	ageBackend := &AgeBackend{}
+
+	for _, f := range publicKeyFiles {
+		keys, isAge, err := readAgeKeys(f)
+		if err != nil {
+			return nil, err
+		}
+		if isAge {
+			for _, k := range keys {
+				r, err := ParseAgeRecipient(k)
+				if err != nil {
+					return nil, fmt.Errorf("Reading key '%s' failed: %s", f, err)
+				}
+				ageBackend.Recipients = append(ageBackend.Recipients, r)
+			}
+			continue
+		}
+		el, err := GetEntityList([]string{f}, "")
+		if err != nil {
+			return nil, err
+		}
+		pgpBackend.PublicEntityList = append(pgpBackend.PublicEntityList, el...)
+	}
+
+	if len(privateKeyFile) > 0 {
+		keys, isAge, err := readAgeKeys(privateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if isAge {
+			for _, k := range keys {
+				i, err := ParseAgeIdentity(k)
+				if err != nil {
+					return nil, fmt.Errorf("Reading key '%s' failed: %s", privateKeyFile, err)
+				}
+				ageBackend.Identities = append(ageBackend.Identities, i)
+			}
+		} else {
+			el, err := GetEntityList([]string{privateKeyFile}, passphrase)
+			if err != nil {
+				return nil, err
+			}
+			pgpBackend.PrivateEntityList = el
+		}
+	}
+
+	return map[string]EncryptionBackend{
+		PGPEncryption: pgpBackend,
+		AgeEncryption: ageBackend,
+	}, nil
+}
+
+// PublicKeyInfo describes a public key file without using it.
+type PublicKeyInfo struct {
+	// Encryption is the backend the key belongs to.
+	Encryption string
+	// IDs are the IDs of a PGP key and its subkeys.
+	IDs []uint64
+	// Revoked is true if the PGP key has been revoked.
+	Revoked bool
+}
+
+// ReadPublicKeyInfo reads the public key file and describes it.
+func ReadPublicKeyInfo(filename string) (*PublicKeyInfo, error) {
+	_, isAge, err := readAgeKeys(filename)
+	if err != nil {
+		return nil, err
+	}
+	if isAge {
+		return &PublicKeyInfo{Encryption: AgeEncryption}, nil
+	}
+	el, err := GetEntityList([]string{filename}, "")
+	if err != nil {
+		return nil, err
+	}
+	info := &PublicKeyInfo{Encryption: PGPEncryption, IDs: []uint64{}}
+	for _, entity := range el {
+		if len(entity.Revocations) > 0 {
+			info.Revoked = true
+		}
+		info.IDs = append(info.IDs, entity.PrimaryKey.KeyId)
+		for _, subkey := range entity.Subkeys {
+			info.IDs = append(info.IDs, subkey.PublicKey.KeyId)
+		}
+	}
+	return info, nil
+}
+
+// readAgeKeys returns the keys of an age key file, ignoring comments. If the
+// file is not an age key file, isAge is false.
+func readAgeKeys(filename string) ([]string, bool, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, false, fmt.Errorf("Reading key '%s' failed: %s", filename, err)
+	}
+	keys := []string{}
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, ageRecipientHRP+"1") && !strings.HasPrefix(line, ageIdentityHRP+"1") {
+			return nil, false, nil
+		}
+		keys = append(keys, line)
+	}
+	return keys, len(keys) > 0, nil
+}
+
+// PrintAgeKeys writes the identity in the format of age-keygen to
+// privateKeyFilename, and the recipient to publicKeyFilename.
+func PrintAgeKeys(identity *AgeIdentity, comment string, publicKeyFilename string, privateKeyFilename string) error {
+	public := fmt.Sprintf("# %s\n%s\n", comment, identity.Recipient())
+	err := ioutil.WriteFile(publicKeyFilename, []byte(public), 0644)
+	if err != nil {
+		return err
+	}
+	private := fmt.Sprintf("# public key: %s\n%s\n", identity.Recipient(), identity)
+	return ioutil.WriteFile(privateKeyFilename, []byte(private), 0600)
+}
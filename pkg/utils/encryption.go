@@ -161,3 +161,30 @@ func Decrypt(encoded string, entityList openpgp.EntityList) (string, error) {
 	bytes, err := ioutil.ReadAll(md.UnverifiedBody)
 	return string(bytes), err
 }
+
+// PGPRecipientKeyIDs returns the IDs of the keys for which the base64-encoded
+// message is encrypted.
+func PGPRecipientKeyIDs(encoded string) ([]uint64, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Decoding '%s' failed: %s", encoded, err)
+	}
+	ids := []uint64{}
+	packets := packet.NewReader(bytes.NewBuffer(encrypted))
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("Reading '%s' failed: %s", encoded, err)
+		}
+		ek, ok := p.(*packet.EncryptedKey)
+		if !ok {
+			// Encrypted keys precede the encrypted data
+			break
+		}
+		ids = append(ids, ek.KeyId)
+	}
+	return ids, nil
+}